@@ -1,16 +1,23 @@
 package advisor
 
 import (
+	"encoding/json"
+	"math"
 	"strings"
 
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/parser/opcode"
-	_ "github.com/pingcap/tidb/types/parser_driver"
+	"github.com/pingcap/tidb/types"
+	driver "github.com/pingcap/tidb/types/parser_driver"
 	"github.com/qw4990/index_advisor/utils"
 )
 
 // simpleIndexableColumnsVisitor finds all columns that appear in any range-filter, order-by, or group-by clause.
+// JSON arrays used in JSON_CONTAINS or JSON_OVERLAPS are collected as multi-valued index parts, and scalar JSON values
+// are collected as expression index parts only if they are cast like `cast(j->>'$.name' as char(64))` in queries, since
+// an expression index is only used by the same expression and JSON values can't be indexed without a cast.
 type simpleIndexableColumnsVisitor struct {
 	tables      utils.Set[utils.TableSchema]
 	cols        utils.Set[utils.Column] // key = 'schema.table.column'
@@ -34,6 +41,22 @@ func (v *simpleIndexableColumnsVisitor) Enter(n ast.Node) (node ast.Node, skipCh
 		v.collectColumn(x.Expr)
 	case *ast.PatternInExpr: // {col} in (?, ?, ...)
 		v.collectColumn(x.Expr)
+	case *ast.PatternLikeExpr: // {col} like 'abc%'
+		if !x.Not && isConstPrefixPattern(x.Pattern) {
+			v.collectColumn(x.Expr)
+		}
+	case *ast.FuncCallExpr:
+		switch {
+		case x.FnName.L == ast.JSONContains && len(x.Args) >= 2: // json_contains({col}->'$.path', ?), or `? member of ({col}->'$.path')`
+			var path ast.ExprNode
+			if len(x.Args) > 2 {
+				path = x.Args[2]
+			}
+			v.collectMultiValuedColumn(x.Args[0], x.Args[1], path)
+		case x.FnName.L == jsonOverlaps && len(x.Args) == 2: // json_overlaps({col}->'$.path', ?)
+			v.collectMultiValuedColumn(x.Args[0], x.Args[1], nil)
+			v.collectMultiValuedColumn(x.Args[1], x.Args[0], nil)
+		}
 	case *ast.BinaryOperationExpr: // range predicates like `{col} > ?`
 		switch x.Op {
 		case opcode.EQ, opcode.LT, opcode.LE, opcode.GT, opcode.GE: // {col} = ?
@@ -50,24 +73,203 @@ func (v *simpleIndexableColumnsVisitor) collectColumn(n ast.Node) {
 	case *ast.ColumnNameExpr:
 		v.collectColumn(x.Name)
 	case *ast.ColumnName:
-		var schemaName string
-		if x.Schema.L != "" {
-			schemaName = x.Schema.L
-		} else {
-			schemaName = v.currentSQL.SchemaName
-		}
-		possibleColumns, err := v.matchPossibleColumns(schemaName, x.Name.L)
-		if err != nil {
-			// TODO: log or return this error?
-		}
-		for _, c := range possibleColumns {
+		for _, c := range v.possibleColumns(x) {
 			if !v.checkColumnIndexableByType(c) {
 				continue
 			}
 			v.cols.Add(c)
 			v.currentCols.Add(c)
 		}
+	case *ast.FuncCastExpr: // cast({col}->>'$.path' as char(64))
+		if x.FunctionType != ast.CastFunction {
+			return
+		}
+		if f, ok := x.Expr.(*ast.FuncCallExpr); ok {
+			if col, _, ok := extractJSONPath(f); ok {
+				v.collectJSONExpression(x, col)
+			}
+		}
+	}
+}
+
+// collectJSONExpression collects the expression on a JSON column as an expression index part, the expression is kept
+// as it is in the query without the table qualifier to make the index match it.
+func (v *simpleIndexableColumnsVisitor) collectJSONExpression(expr ast.ExprNode, col *ast.ColumnName) {
+	saved := *col
+	col.Schema, col.Table = model.CIStr{}, model.CIStr{}
+	text, err := utils.RestoreIndexExpr(expr)
+	*col = saved
+	if err != nil {
+		return
+	}
+	for _, c := range v.possibleColumns(col) {
+		if c.ColumnType == nil || c.ColumnType.Tp != mysql.TypeJSON {
+			continue
+		}
+		c.Expr = text
+		v.cols.Add(c)
+		v.currentCols.Add(c)
+	}
+}
+
+// collectMultiValuedColumn collects the JSON array referenced by `json_contains(target, candidate[, path])`.
+func (v *simpleIndexableColumnsVisitor) collectMultiValuedColumn(target, candidate, pathExpr ast.ExprNode) {
+	var col *ast.ColumnName
+	var path string
+	switch x := target.(type) {
+	case *ast.ColumnNameExpr: // json_contains({col}, ?[, '$.path'])
+		col, path = x.Name, "$"
+		if pathExpr != nil {
+			p, ok := stringConst(pathExpr)
+			if !ok {
+				return
+			}
+			path = p
+		}
+	case *ast.FuncCallExpr: // json_contains({col}->'$.path', ?)
+		if x.FnName.L != ast.JSONExtract || pathExpr != nil {
+			return
+		}
+		var ok bool
+		if col, path, ok = extractJSONPath(x); !ok {
+			return
+		}
+	default:
+		return
+	}
+	arrayType := arrayElemType(candidate)
+	if f, ok := candidate.(*ast.FuncCallExpr); ok && f.FnName.L == ast.JSONArray && len(f.Args) > 0 {
+		if member, ok := f.Args[0].(*ast.ColumnNameExpr); ok { // `{col} member of (...)`, use the type of the column
+			for _, c := range v.possibleColumns(member.Name) {
+				arrayType = columnElemType(c)
+			}
+		}
+	}
+	for _, c := range v.jsonColumns(col, path) {
+		c.ArrayType = arrayType
+		v.cols.Add(c)
+		v.currentCols.Add(c)
+	}
+}
+
+// jsonColumns returns JSON columns matching x as multi-valued index parts of the JSON path.
+func (v *simpleIndexableColumnsVisitor) jsonColumns(x *ast.ColumnName, path string) (cols []utils.Column) {
+	for _, c := range v.possibleColumns(x) {
+		if c.ColumnType == nil || c.ColumnType.Tp != mysql.TypeJSON {
+			continue
+		}
+		c.JSONPath = path
+		c.MultiValued = true
+		cols = append(cols, c)
+	}
+	return
+}
+
+func (v *simpleIndexableColumnsVisitor) possibleColumns(x *ast.ColumnName) []utils.Column {
+	var schemaName string
+	if x.Schema.L != "" {
+		schemaName = x.Schema.L
+	} else {
+		schemaName = v.currentSQL.SchemaName
+	}
+	possibleColumns, err := v.matchPossibleColumns(schemaName, x.Name.L)
+	if err != nil {
+		// TODO: log or return this error?
+	}
+	return possibleColumns
+}
+
+// extractJSONPath extracts the column and path from `json_extract({col}, '$.path')` or `json_unquote(json_extract({col}, '$.path'))`.
+func extractJSONPath(x *ast.FuncCallExpr) (col *ast.ColumnName, path string, ok bool) {
+	if x.FnName.L == ast.JSONUnquote && len(x.Args) == 1 {
+		inner, isFunc := x.Args[0].(*ast.FuncCallExpr)
+		if !isFunc || inner.FnName.L != ast.JSONExtract {
+			return nil, "", false
+		}
+		x = inner
+	}
+	if x.FnName.L != ast.JSONExtract || len(x.Args) != 2 { // json_extract with multiple paths is not indexable
+		return nil, "", false
+	}
+	colExpr, isCol := x.Args[0].(*ast.ColumnNameExpr)
+	if !isCol {
+		return nil, "", false
+	}
+	path, ok = stringConst(x.Args[1])
+	if !ok {
+		return nil, "", false
+	}
+	return colExpr.Name, path, true
+}
+
+// jsonOverlaps is the name of JSON_OVERLAPS, which is not defined by the parser yet.
+const jsonOverlaps = "json_overlaps"
+
+// arrayElemType infers the element type of a multi-valued index from the candidate value of the predicate,
+// e.g. `signed` for `json_contains(j->'$.ids', '[1, 2]')` and `char(64)` for `json_contains(j->'$.tags', '["a"]')`.
+func arrayElemType(candidate ast.ExprNode) string {
+	switch x := candidate.(type) {
+	case *ast.FuncCallExpr: // json_array(?), rewritten from `? member of (...)`
+		if x.FnName.L == ast.JSONArray && len(x.Args) > 0 {
+			if val, ok := x.Args[0].(*driver.ValueExpr); ok {
+				return jsonElemType(val.GetValue())
+			}
+		}
+	case *driver.ValueExpr: // '[1, 2]'
+		if str, ok := stringConst(x); ok {
+			var val interface{}
+			if err := json.Unmarshal([]byte(str), &val); err == nil {
+				if arr, isArr := val.([]interface{}); isArr && len(arr) > 0 {
+					val = arr[0]
+				}
+				return jsonElemType(val)
+			}
+		}
+	}
+	return "char(64)"
+}
+
+func jsonElemType(val interface{}) string {
+	switch x := val.(type) {
+	case int64, uint64:
+		return "signed"
+	case float64:
+		if x == math.Trunc(x) {
+			return "signed"
+		}
+		return "double"
+	}
+	return "char(64)"
+}
+
+// columnElemType returns the element type of a multi-valued index whose candidate values come from the column.
+func columnElemType(c utils.Column) string {
+	if c.ColumnType != nil {
+		switch c.ColumnType.Tp {
+		case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong:
+			return "signed"
+		case mysql.TypeFloat, mysql.TypeDouble, mysql.TypeNewDecimal:
+			return "double"
+		}
+	}
+	return "char(64)"
+}
+
+// isConstPrefixPattern returns whether this LIKE pattern has a constant prefix, e.g. 'abc%' but not '%abc'.
+func isConstPrefixPattern(pattern ast.ExprNode) bool {
+	p, ok := stringConst(pattern)
+	if !ok {
+		return false
+	}
+	return p == "" || (p[0] != '%' && p[0] != '_')
+}
+
+func stringConst(expr ast.ExprNode) (string, bool) {
+	v, ok := expr.(*driver.ValueExpr)
+	if !ok || v.Kind() != types.KindString {
+		return "", false
 	}
+	return v.GetString(), true
 }
 
 func (v *simpleIndexableColumnsVisitor) checkColumnIndexableByType(c utils.Column) bool {
@@ -119,7 +321,7 @@ func IndexableColumnsSelectionSimple(workloadInfo *utils.WorkloadInfo) error {
 	}
 	sqls := workloadInfo.Queries.ToList()
 	for _, sql := range sqls {
-		stmt, err := utils.ParseOneSQL(sql.Text)
+		stmt, err := utils.ParseQuery(sql.Text)
 		if err != nil {
 			return err
 		}
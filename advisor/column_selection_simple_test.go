@@ -22,13 +22,98 @@ func TestFindIndexableColumnsCase1(t *testing.T) {
 	workload := utils.WorkloadInfo{
 		TableSchemas: utils.ListToSet(tt),
 		Queries: utils.ListToSet(
-			utils.Query{"", "test",
-				"select * from t where a<1 and b>1 and e like 'abc'", 1, nil},
-			utils.Query{"", "test",
-				"select * from t where c in (1, 2, 3) order by d", 1, nil}),
+			utils.Query{Alias: "", SchemaName: "test",
+				Text: "select * from t where a<1 and b>1 and e like 'abc'", Frequency: 1},
+			utils.Query{Alias: "", SchemaName: "test",
+				Text: "select * from t where c in (1, 2, 3) order by d", Frequency: 1}),
 	}
 	must(IndexableColumnsSelectionSimple(&workload))
-	checkIndexableCols(workload.IndexableColumns, []string{"test.t.a", "test.t.b", "test.t.c", "test.t.d"})
+	checkIndexableCols(workload.IndexableColumns, []string{"test.t.a", "test.t.b", "test.t.c", "test.t.d", "test.t.e"})
+}
+
+func TestFindIndexableColumnsLike(t *testing.T) {
+	tt, err := utils.ParseCreateTableStmt("test", "create table t (a varchar(32), b varchar(32), c varchar(32), d varchar(32))")
+	must(err)
+
+	workload := utils.WorkloadInfo{
+		TableSchemas: utils.ListToSet(tt),
+		Queries: utils.ListToSet(
+			utils.Query{Alias: "", SchemaName: "test", Frequency: 1,
+				Text: "select * from t where a like 'abc%' and b like '%abc' and c like '_bc' and d not like 'abc%'"}),
+	}
+	must(IndexableColumnsSelectionSimple(&workload))
+	checkIndexableCols(workload.IndexableColumns, []string{"test.t.a"})
+}
+
+func TestFindIndexableColumnsJSON(t *testing.T) {
+	tt, err := utils.ParseCreateTableStmt("test", "create table t (a int, j json, k json)")
+	must(err)
+
+	workload := utils.WorkloadInfo{
+		TableSchemas: utils.ListToSet(tt),
+		Queries: utils.ListToSet(
+			utils.Query{Alias: "", SchemaName: "test", Frequency: 1, // only the cast expression can be indexed
+				Text: "select * from t where j->>'$.name' = 'abc' and cast(t.k->>'$.age' as signed) > 10"},
+			utils.Query{Alias: "", SchemaName: "test", Frequency: 1,
+				Text: "select * from t where json_contains(j->'$.tags', '[1, 2]') and json_contains(k, '1', '$.ids')"},
+			utils.Query{Alias: "", SchemaName: "test", Frequency: 1,
+				Text: "select * from t where json_contains(j->'$.tags', '[\"a\"]')"},
+			utils.Query{Alias: "", SchemaName: "test", Frequency: 1,
+				Text: "select * from t where a->>'$.x' = 1 and j = '{}'"}), // `a` is not a JSON column, `j` is not indexable
+	}
+	must(IndexableColumnsSelectionSimple(&workload))
+	checkIndexableCols(workload.IndexableColumns, []string{"test.t.(cast(json_unquote(json_extract(`k`, '$.age')) as signed))",
+		"test.t.j->'$.tags'[*] as signed", "test.t.j->'$.tags'[*] as char(64)", "test.t.k->'$.ids'[*] as signed"})
+
+	cols := workload.IndexableColumns.ToList()
+	idx := utils.NewIndexWithColumns(tempIndexName(cols[0]), cols[0])
+	if idx.DDL() != "CREATE INDEX "+idx.IndexName+" ON test.t ((cast(json_unquote(json_extract(`k`, '$.age')) as signed)))" ||
+		!strings.HasPrefix(idx.IndexName, "idx_k_expr_") {
+		t.Errorf("unexpected DDL: %v", idx.DDL())
+	}
+	idx = utils.NewIndexWithColumns(tempIndexName(cols[1]), cols[1])
+	if idx.DDL() != "CREATE INDEX idx_j_tags ON test.t ((cast(json_extract(j, '$.tags') as char(64) array)))" {
+		t.Errorf("unexpected DDL: %v", idx.DDL())
+	}
+}
+
+func TestFindIndexableColumnsMultiValued(t *testing.T) {
+	tt, err := utils.ParseCreateTableStmt("test", "create table t (a int, j json)")
+	must(err)
+
+	cases := []struct {
+		q   string
+		ddl string
+	}{
+		{`select * from t where json_contains(j->'$.tags', '["a", "b"]')`,
+			"CREATE INDEX idx ON test.t ((cast(json_extract(j, '$.tags') as char(64) array)))"},
+		{`select * from t where json_overlaps(j->'$.ids', '[1.5, 2]')`,
+			"CREATE INDEX idx ON test.t ((cast(json_extract(j, '$.ids') as double array)))"},
+		{`select * from t where json_overlaps('[1, 2]', j->'$.ids')`,
+			"CREATE INDEX idx ON test.t ((cast(json_extract(j, '$.ids') as signed array)))"},
+		{`select * from t where 10 MEMBER OF (j->'$.ids')`,
+			"CREATE INDEX idx ON test.t ((cast(json_extract(j, '$.ids') as signed array)))"},
+		{`select * from t where 'abc' member of(j) and a = 1`,
+			"CREATE INDEX idx ON test.t ((cast(json_extract(j, '$') as char(64) array)))"},
+		{`select * from t where t.a member of (j->'$.ids') and c = 'x member of (j)'`,
+			"CREATE INDEX idx ON test.t ((cast(json_extract(j, '$.ids') as signed array)))"},
+	}
+	for _, c := range cases {
+		workload := utils.WorkloadInfo{
+			TableSchemas: utils.ListToSet(tt),
+			Queries:      utils.ListToSet(utils.Query{SchemaName: "test", Text: c.q, Frequency: 1}),
+		}
+		must(IndexableColumnsSelectionSimple(&workload))
+		var ddl []string
+		for _, col := range workload.IndexableColumns.ToList() {
+			if col.MultiValued {
+				ddl = append(ddl, utils.NewIndexWithColumns("idx", col).DDL())
+			}
+		}
+		if len(ddl) != 1 || ddl[0] != c.ddl {
+			t.Errorf("query: %v, expected %v, got %v", c.q, c.ddl, ddl)
+		}
+	}
 }
 
 func TestFindIndexableColumnsCase2(t *testing.T) {
@@ -38,8 +123,8 @@ func TestFindIndexableColumnsCase2(t *testing.T) {
 	must(err)
 	workload := utils.WorkloadInfo{
 		TableSchemas: utils.ListToSet(t1, t2),
-		Queries: utils.ListToSet(utils.Query{"", "test",
-			"select * from t2 tx where a<1", 1, nil}),
+		Queries: utils.ListToSet(utils.Query{Alias: "", SchemaName: "test",
+			Text: "select * from t2 tx where a<1", Frequency: 1}),
 	}
 	must(IndexableColumnsSelectionSimple(&workload))
 	checkIndexableCols(workload.IndexableColumns, []string{"test.t2.a"})
@@ -52,8 +137,8 @@ func TestFindIndexableColumnsCase3(t *testing.T) {
 	must(err)
 	workload := utils.WorkloadInfo{
 		TableSchemas: utils.ListToSet(t1, t2),
-		Queries: utils.ListToSet(utils.Query{"", "db1",
-			"select * from db2.t2 where a2<1", 1, nil}),
+		Queries: utils.ListToSet(utils.Query{Alias: "", SchemaName: "db1",
+			Text: "select * from db2.t2 where a2<1", Frequency: 1}),
 	}
 	must(IndexableColumnsSelectionSimple(&workload))
 	checkIndexableCols(workload.IndexableColumns, []string{"db2.t2.a2"})
@@ -71,7 +156,7 @@ func TestFindIndexableColumnsSimpleTPCH(t *testing.T) {
 	workload := utils.WorkloadInfo{
 		TableSchemas: utils.ListToSet(t1),
 		Queries: utils.ListToSet(
-			utils.Query{"", "tpch", `select
+			utils.Query{Alias: "", SchemaName: "tpch", Text: `select
 	supp_nation,
 	cust_nation,
 	l_year,
@@ -109,7 +194,7 @@ group by
 order by
 	supp_nation,
 	cust_nation,
-	l_year`, 1, nil})}
+	l_year`, Frequency: 1})}
 	must(IndexableColumnsSelectionSimple(&workload))
 	checkIndexableCols(workload.IndexableColumns, []string{"tpch.nation.n_name", "tpch.nation.n_nationkey"})
 }
@@ -16,12 +16,18 @@ type IndexSelectionAlgo func(
 type IndexableColumnsSelectionAlgo func(workloadInfo *utils.WorkloadInfo) error
 
 // WorkloadInfoCompressionAlgo is the interface for workload info compression algorithms.
-type WorkloadInfoCompressionAlgo func(workloadInfo utils.WorkloadInfo) utils.WorkloadInfo
+type WorkloadInfoCompressionAlgo func(
+	workloadInfo utils.WorkloadInfo, // the target workload
+	parameter Parameter, // the input parameters
+	optimizer optimizer.WhatIfOptimizer, // the what-if optimizer
+) (utils.WorkloadInfo, CompressionSummary, error)
 
 var (
 	compressAlgorithms = map[string]WorkloadInfoCompressionAlgo{
-		"none":   NoneWorkloadInfoCompress,
-		"digest": DigestWorkloadInfoCompress,
+		"none":    NoneWorkloadInfoCompress,
+		"digest":  DigestWorkloadInfoCompress,
+		"cluster": ClusterWorkloadInfoCompress,
+		"cost":    CostWorkloadInfoCompress,
 	}
 
 	findIndexableColsAlgorithms = map[string]IndexableColumnsSelectionAlgo{
@@ -37,6 +43,14 @@ var (
 type Parameter struct {
 	MaxNumberIndexes int // the max number of indexes to recommend
 	MaxIndexWidth    int // the max number of columns in recommended indexes
+
+	CompressionAlgo string  // the workload compression algorithm, one of 'none', 'digest', 'cluster' and 'cost', 'none' by default
+	MaxWorkloadSize int     // the max number of queries after 'cluster' or 'cost' compression, 0 means no limitation
+	CostCoverage    float64 // the ratio of the total workload cost to keep after 'cost' compression, (0, 1], 1 by default
+
+	RejectRegression      bool    // reject configurations that regress any query with weighted frequency above RegressionWeightLimit
+	RegressionThreshold   float64 // a query regresses if its cost increases more than this ratio, e.g. 0.05
+	RegressionWeightLimit float64 // only queries with weighted frequency above this limit are protected, 0 protects all queries
 }
 
 func validateParameter(p Parameter) Parameter {
@@ -56,30 +70,60 @@ func validateParameter(p Parameter) Parameter {
 		utils.Warningf("max index width should be at most 5, set from %v to 5", p.MaxIndexWidth)
 		p.MaxIndexWidth = 5
 	}
+	if p.CompressionAlgo == "" {
+		p.CompressionAlgo = "none"
+	}
+	if _, ok := compressAlgorithms[p.CompressionAlgo]; !ok {
+		utils.Warningf("unknown workload compression algorithm %v, set it to none", p.CompressionAlgo)
+		p.CompressionAlgo = "none"
+	}
+	if p.MaxWorkloadSize < 0 {
+		utils.Warningf("max workload size should be at least 0, set from %v to 0", p.MaxWorkloadSize)
+		p.MaxWorkloadSize = 0
+	}
+	if p.CostCoverage <= 0 || p.CostCoverage > 1 {
+		if p.CostCoverage != 0 {
+			utils.Warningf("cost coverage should be in (0, 1], set from %v to 1", p.CostCoverage)
+		}
+		p.CostCoverage = 1
+	}
+	if p.RegressionThreshold < 0 {
+		utils.Warningf("regression threshold should be at least 0, set from %v to 0", p.RegressionThreshold)
+		p.RegressionThreshold = 0
+	}
 	return p
 }
 
-// IndexAdvise is the entry point of index advisor.
-func IndexAdvise(db optimizer.WhatIfOptimizer, workload utils.WorkloadInfo, param Parameter) (utils.Set[utils.Index], error) {
+// IndexAdvise is the entry point of index advisor, it returns recommended indexes and how the workload is compressed.
+func IndexAdvise(db optimizer.WhatIfOptimizer, workload utils.WorkloadInfo, param Parameter) (utils.Set[utils.Index], CompressionSummary, error) {
 	utils.Infof("start index advise for %v queries, %v tables", workload.Queries.Size(), workload.TableSchemas.Size())
 	param = validateParameter(param)
 
-	compress := compressAlgorithms["none"]
+	compress := compressAlgorithms[param.CompressionAlgo]
 	indexable := findIndexableColsAlgorithms["simple"]
 	selection := selectIndexAlgorithms["auto_admin"]
 
-	compressedWorkloadInfo := compress(workload)
+	compressedWorkloadInfo, compression, err := compress(workload, param, db)
+	if err != nil {
+		return nil, compression, err
+	}
 
 	if err := indexable(&compressedWorkloadInfo); err != nil {
-		return nil, err
+		return nil, compression, err
 	}
 	utils.Infof("find %v indexable columns", compressedWorkloadInfo.IndexableColumns.Size())
 
 	checkWorkloadInfo(compressedWorkloadInfo)
 	recommendedIndexes, err := selection(compressedWorkloadInfo, param, db)
 	if err != nil {
-		return nil, err
+		return nil, compression, err
+	}
+	if param.RejectRegression {
+		recommendedIndexes, err = rejectRegressions(workload, param, db, recommendedIndexes)
+		if err != nil {
+			return nil, compression, err
+		}
 	}
 	utils.Infof("finish index advise with %v recommended indexes", recommendedIndexes.Size())
-	return recommendedIndexes, err
+	return recommendedIndexes, compression, err
 }
@@ -45,7 +45,7 @@ func (aa *autoAdmin) calculateBestIndexes(workload utils.WorkloadInfo) (utils.Se
 
 	potentialIndexes := utils.NewSet[utils.Index]() // each indexable column as a single-column index
 	for _, col := range workload.IndexableColumns.ToList() {
-		potentialIndexes.Add(utils.NewIndex(col.SchemaName, col.TableName, tempIndexName(col), col.ColumnName))
+		potentialIndexes.Add(utils.NewIndexWithColumns(tempIndexName(col), col))
 	}
 
 	currentBestIndexes := utils.NewSet[utils.Index]()
@@ -149,13 +149,20 @@ func (aa *autoAdmin) heuristicCoveredIndexes(candidateIndexes utils.Set[utils.In
 		return nil, err
 	}
 
+	// parse select columns of each query block
+	var blockSelectCols []utils.Set[utils.Column]
 	for _, q := range w.Queries.ToList() {
-		// parse select columns
 		selectCols, err := utils.ParseSelectColumnsFromQuery(q)
 		if err != nil {
 			return nil, err
 		}
-		if selectCols == nil || selectCols.Size() == 0 || selectCols.Size() > aa.maxIndexWidth {
+		blockSelectCols = append(blockSelectCols, selectCols...)
+	}
+
+	for _, selectCols := range blockSelectCols {
+		// clustered primary key columns are contained by all secondary indexes, no need to cover them again
+		selectCols = utils.ListToSet(removeHandleColumns(w, selectCols.ToList())...)
+		if selectCols.Size() == 0 || selectCols.Size() > aa.maxIndexWidth {
 			continue
 		}
 		schemaName, tableName := selectCols.ToList()[0].SchemaName, selectCols.ToList()[0].TableName
@@ -172,6 +179,9 @@ func (aa *autoAdmin) heuristicCoveredIndexes(candidateIndexes utils.Set[utils.In
 			if idx.SchemaName != schemaName || idx.TableName != tableName {
 				continue // not for the same table
 			}
+			if idx.IsMultiValued() {
+				continue // multi-valued indexes always need to look up the table, they can't cover any query
+			}
 			if len(idx.Columns)+selectCols.Size() > aa.maxIndexWidth {
 				continue // exceed the max-index-width limitation
 			}
@@ -235,19 +245,21 @@ func (aa *autoAdmin) heuristicMergeIndexes(candidateIndexes utils.Set[utils.Inde
 		return nil, err
 	}
 
+	// get all DNF columns from each query block
+	var blocks []utils.QueryBlock
 	for _, q := range w.Queries.ToList() {
-		// get all DNF columns from the query
-		dnfCols, err := utils.ParseDNFColumnsFromQuery(q)
+		queryBlocks, err := utils.ParseQueryBlocks(q)
 		if err != nil {
 			return nil, err
 		}
-		if dnfCols == nil || dnfCols.Size() == 0 {
+		blocks = append(blocks, queryBlocks...)
+	}
+
+	for _, block := range blocks {
+		dnfCols, orderByCols := block.DNFColumns, block.OrderByColumns
+		if dnfCols.Size() == 0 {
 			continue
 		}
-		orderByCols, err := utils.ParseOrderByColumnsFromQuery(q)
-		if err != nil {
-			return nil, err
-		}
 
 		// create indexes for these DNF columns
 		newIndexes := utils.NewSet[utils.Index]()
@@ -265,7 +277,7 @@ func (aa *autoAdmin) heuristicMergeIndexes(candidateIndexes utils.Set[utils.Inde
 			}
 
 			// index with DNF column + order-by column
-			if len(orderByCols) == 0 {
+			if len(orderByCols) == 0 || orderByCols[0].SchemaName != col.SchemaName || orderByCols[0].TableName != col.TableName {
 				continue
 			}
 			cols := []utils.Column{col}
@@ -273,7 +285,10 @@ func (aa *autoAdmin) heuristicMergeIndexes(candidateIndexes utils.Set[utils.Inde
 			if len(cols) > aa.maxIndexWidth {
 				cols = cols[:aa.maxIndexWidth]
 			}
-			idx = utils.NewIndexWithColumns(tempIndexName(cols...), cols...)
+			idx = trimHandleSuffix(w, utils.NewIndexWithColumns(tempIndexName(cols...), cols...))
+			if len(idx.Columns) == 0 {
+				continue
+			}
 			contained = false
 			for _, existingIndex := range candidateIndexes.ToList() {
 				if existingIndex.PrefixContain(idx) {
@@ -320,23 +335,29 @@ func (aa *autoAdmin) createMultiColumnIndexes(workload utils.WorkloadInfo, index
 		for _, column := range utils.DiffSet(utils.AndSet(tableColsSet, indexableColsSet), indexColsSet).ToList() {
 			cols := append([]utils.Column{}, index.Columns...)
 			cols = append(cols, column)
-			multiColumnCandidates.Add(utils.Index{
+			candidate := trimHandleSuffix(workload, utils.Index{
 				SchemaName: index.SchemaName,
 				TableName:  index.TableName,
 				IndexName:  tempIndexName(cols...),
 				Columns:    cols,
 			})
+			if len(candidate.Columns) <= len(index.Columns) {
+				continue // the new column is a redundant handle column
+			}
+			multiColumnCandidates.Add(candidate)
 		}
 	}
 	return multiColumnCandidates
 }
 
 // filterIndexes filters some obviously unreasonable indexes.
+// Rule 0: trim redundant clustered primary key suffixes, and remove X if it only contains clustered primary key columns.
 // Rule 1: if index X is a prefix of index Y, then remove X.
 // Rule 2: if index X has no any benefit, then remove X.
-// Rule 3: if candidate index X is a prefix of some existing index in the workload, then remove X.
+// Rule 3: if candidate index X is a prefix of some existing visible index in the workload, then remove X.
 // Rule 4(TBD): remove unnecessary suffix columns, e.g. X(a, b, c) to X(a, b) if no query can gain benefit from the suffix column c.
 func (aa *autoAdmin) filterIndexes(workload utils.WorkloadInfo, indexes utils.Set[utils.Index]) (utils.Set[utils.Index], error) {
+	indexes = normalizeIndexes(workload, indexes)
 	indexList := indexes.ToList()
 	filteredIndexes := utils.NewSet[utils.Index]()
 	originalCost, err := evaluateIndexConfCost(workload, aa.optimizer, indexes)
@@ -375,7 +396,7 @@ func (aa *autoAdmin) filterIndexes(workload utils.WorkloadInfo, indexes utils.Se
 		if ok {
 			prefixContain := false
 			for _, existingIndex := range table.Indexes {
-				if existingIndex.PrefixContain(x) {
+				if !existingIndex.Invisible && existingIndex.PrefixContain(x) {
 					prefixContain = true
 				}
 			}
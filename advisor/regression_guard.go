@@ -0,0 +1,87 @@
+package advisor
+
+import (
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+)
+
+// evaluateQueryCosts returns the cost of each query under the index configuration, keyed by Query.Key().
+func evaluateQueryCosts(info utils.WorkloadInfo, optimizer optimizer.WhatIfOptimizer, indexes utils.Set[utils.Index]) (map[string]float64, error) {
+	for _, index := range indexes.ToList() {
+		if err := optimizer.CreateHypoIndex(index); err != nil {
+			return nil, err
+		}
+	}
+	costs := make(map[string]float64, info.Queries.Size())
+	for _, sql := range info.Queries.ToList() {
+		if err := optimizer.Execute(`use ` + sql.SchemaName); err != nil {
+			return nil, err
+		}
+		p, err := optimizer.Explain(sql.Text)
+		if err != nil {
+			return nil, err
+		}
+		costs[sql.Key()] = p.PlanCost()
+	}
+	for _, index := range indexes.ToList() {
+		if err := optimizer.DropHypoIndex(index); err != nil {
+			return nil, err
+		}
+	}
+	return costs, nil
+}
+
+// regressedQueries returns queries whose weighted frequency is above weightLimit and whose cost
+// increases more than regressionThr compared with the original cost.
+func regressedQueries(info utils.WorkloadInfo, oriCosts, optCosts map[string]float64, regressionThr, weightLimit float64) []utils.Query {
+	var regressed []utils.Query
+	for _, q := range info.Queries.ToList() {
+		if q.WeightedFrequency() <= weightLimit {
+			continue
+		}
+		if optCosts[q.Key()] > oriCosts[q.Key()]*(1+regressionThr) {
+			regressed = append(regressed, q)
+		}
+	}
+	return regressed
+}
+
+// rejectRegressions removes indexes from the configuration until no query with weighted frequency above
+// parameter.RegressionWeightLimit regresses more than parameter.RegressionThreshold.
+// Each time, the index whose removal leaves the fewest regressed queries (then the lowest cost) is removed.
+func rejectRegressions(info utils.WorkloadInfo, parameter Parameter, op optimizer.WhatIfOptimizer, indexes utils.Set[utils.Index]) (utils.Set[utils.Index], error) {
+	oriCosts, err := evaluateQueryCosts(info, op, utils.NewSet[utils.Index]())
+	if err != nil {
+		return nil, err
+	}
+	optCosts, err := evaluateQueryCosts(info, op, indexes)
+	if err != nil {
+		return nil, err
+	}
+	regressed := regressedQueries(info, oriCosts, optCosts, parameter.RegressionThreshold, parameter.RegressionWeightLimit)
+	for len(regressed) > 0 && indexes.Size() > 0 {
+		utils.Warningf("regression guard: reject the configuration %v since %v queries regress, e.g. %v",
+			indexes.ToKeyList(), len(regressed), regressed[0].Alias)
+		var bestIndexes utils.Set[utils.Index]
+		var bestRegressed []utils.Query
+		var bestCost float64
+		for _, idx := range indexes.ToList() {
+			candidate := utils.DiffSet(indexes, utils.ListToSet(idx))
+			costs, err := evaluateQueryCosts(info, op, candidate)
+			if err != nil {
+				return nil, err
+			}
+			candidateRegressed := regressedQueries(info, oriCosts, costs, parameter.RegressionThreshold, parameter.RegressionWeightLimit)
+			var cost float64
+			for _, q := range info.Queries.ToList() {
+				cost += costs[q.Key()] * q.WeightedFrequency()
+			}
+			if bestIndexes == nil || len(candidateRegressed) < len(bestRegressed) ||
+				(len(candidateRegressed) == len(bestRegressed) && cost < bestCost) {
+				bestIndexes, bestRegressed, bestCost = candidate, candidateRegressed, cost
+			}
+		}
+		indexes, regressed = bestIndexes, bestRegressed
+	}
+	return indexes, nil
+}
@@ -0,0 +1,104 @@
+package advisor
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+)
+
+// fakeCostOptimizer estimates the cost of each query by its base cost and the deltas of hypothetical indexes.
+type fakeCostOptimizer struct {
+	base   map[string]float64            // query text -> cost without any hypothetical index
+	deltas map[string]map[string]float64 // index key -> query text -> cost delta
+	hypo   map[string]bool
+}
+
+func (o *fakeCostOptimizer) Query(sql string) (*sql.Rows, error) { return nil, nil }
+func (o *fakeCostOptimizer) Execute(sql string) error            { return nil }
+func (o *fakeCostOptimizer) Close() error                        { return nil }
+func (o *fakeCostOptimizer) CreateHypoIndex(index utils.Index) error {
+	o.hypo[index.Key()] = true
+	return nil
+}
+func (o *fakeCostOptimizer) DropHypoIndex(index utils.Index) error {
+	delete(o.hypo, index.Key())
+	return nil
+}
+func (o *fakeCostOptimizer) Explain(query string) (utils.Plan, error) {
+	cost := o.base[query]
+	for key := range o.hypo {
+		cost += o.deltas[key][query]
+	}
+	return utils.Plan{{"Projection_1", "1.00", fmt.Sprintf("%v", cost)}}, nil
+}
+func (o *fakeCostOptimizer) ExplainAnalyze(query string) (utils.Plan, error) { return o.Explain(query) }
+func (o *fakeCostOptimizer) ResetStats()                                     {}
+func (o *fakeCostOptimizer) Stats() optimizer.WhatIfOptimizerStats {
+	return optimizer.WhatIfOptimizerStats{}
+}
+func (o *fakeCostOptimizer) SetDebug(flag bool) {}
+
+func TestRejectRegressions(t *testing.T) {
+	q1 := utils.Query{Alias: "q1", SchemaName: "test", Text: "select * from t where a=1", Frequency: 100}
+	q2 := utils.Query{Alias: "q2", SchemaName: "test", Text: "select * from t where b=1 order by c", Frequency: 1}
+	w := utils.WorkloadInfo{Queries: utils.ListToSet(q1, q2)}
+	ia := utils.NewIndex("test", "t", "idx_a", "a")
+	ib := utils.NewIndex("test", "t", "idx_b", "b")
+	op := &fakeCostOptimizer{
+		base: map[string]float64{q1.Text: 1000, q2.Text: 1000},
+		deltas: map[string]map[string]float64{
+			ia.Key(): {q1.Text: -900},
+			ib.Key(): {q1.Text: 200, q2.Text: -500}, // idx_b lures q1 into a worse plan
+		},
+		hypo: make(map[string]bool),
+	}
+
+	oriCosts, err := evaluateQueryCosts(w, op, utils.NewSet[utils.Index]())
+	must(err)
+	optCosts, err := evaluateQueryCosts(w, op, utils.ListToSet(ia, ib))
+	must(err)
+	regressed := regressedQueries(w, oriCosts, optCosts, 0.05, 0)
+	if len(regressed) != 0 { // 1000 -> 300
+		t.Errorf("unexpected regressed queries %v", regressed)
+	}
+	optCosts, err = evaluateQueryCosts(w, op, utils.ListToSet(ib))
+	must(err)
+	regressed = regressedQueries(w, oriCosts, optCosts, 0.05, 0)
+	if len(regressed) != 1 || regressed[0].Alias != "q1" { // 1000 -> 1200
+		t.Errorf("unexpected regressed queries %v", regressed)
+	}
+	if regressed := regressedQueries(w, oriCosts, optCosts, 0.5, 0); len(regressed) != 0 {
+		t.Errorf("unexpected regressed queries %v", regressed)
+	}
+	if regressed := regressedQueries(w, oriCosts, optCosts, 0.05, 100); len(regressed) != 0 {
+		t.Errorf("unexpected regressed queries %v", regressed)
+	}
+
+	param := Parameter{RejectRegression: true, RegressionThreshold: 0.05}
+	result, err := rejectRegressions(w, param, op, utils.ListToSet(ib))
+	must(err)
+	if result.Size() != 0 {
+		t.Errorf("unexpected indexes %v", result.ToKeyList())
+	}
+	result, err = rejectRegressions(w, param, op, utils.ListToSet(ia, ib))
+	must(err)
+	if result.Size() != 2 {
+		t.Errorf("unexpected indexes %v", result.ToKeyList())
+	}
+
+	op.deltas[ia.Key()][q1.Text] = -100 // q1: 1000 -> 1100 under {idx_a, idx_b}
+	result, err = rejectRegressions(w, param, op, utils.ListToSet(ia, ib))
+	must(err)
+	if result.Size() != 1 || !result.Contains(ia) {
+		t.Errorf("unexpected indexes %v", result.ToKeyList())
+	}
+	param.RegressionWeightLimit = 100 // q1 is not protected
+	result, err = rejectRegressions(w, param, op, utils.ListToSet(ia, ib))
+	must(err)
+	if result.Size() != 2 {
+		t.Errorf("unexpected indexes %v", result.ToKeyList())
+	}
+}
@@ -2,6 +2,7 @@ package advisor
 
 import (
 	"fmt"
+	"hash/fnv"
 	"sort"
 	"strings"
 	"sync/atomic"
@@ -10,6 +11,11 @@ import (
 	"github.com/qw4990/index_advisor/utils"
 )
 
+// EvaluateIndexConfCost returns the cost of the workload with the given hypothetical indexes.
+func EvaluateIndexConfCost(info utils.WorkloadInfo, optimizer optimizer.WhatIfOptimizer, indexes utils.Set[utils.Index]) (utils.IndexConfCost, error) {
+	return evaluateIndexConfCost(info, optimizer, indexes)
+}
+
 // evaluateIndexConfCost evaluates the workload cost under the given indexes.
 func evaluateIndexConfCost(info utils.WorkloadInfo, optimizer optimizer.WhatIfOptimizer, indexes utils.Set[utils.Index]) (utils.IndexConfCost, error) {
 	for _, index := range indexes.ToList() {
@@ -26,7 +32,7 @@ func evaluateIndexConfCost(info utils.WorkloadInfo, optimizer optimizer.WhatIfOp
 		if err != nil {
 			return utils.IndexConfCost{}, err
 		}
-		workloadCost += p.PlanCost() * float64(sql.Frequency)
+		workloadCost += p.PlanCost() * sql.WeightedFrequency()
 	}
 	for _, index := range indexes.ToList() {
 		if err := optimizer.DropHypoIndex(index); err != nil {
@@ -50,7 +56,7 @@ var indexID atomic.Int64
 func tempIndexName(cols ...utils.Column) string {
 	var names []string
 	for _, col := range cols {
-		names = append(names, col.ColumnName)
+		names = append(names, indexNamePart(col))
 	}
 	idxName := fmt.Sprintf("idx_%v", strings.Join(names, "_"))
 	if len(idxName) <= 64 {
@@ -59,6 +65,96 @@ func tempIndexName(cols ...utils.Column) string {
 	return fmt.Sprintf("idx_%v", indexID.Add(1))
 }
 
+// removeHandleColumns removes columns of clustered primary keys, which are implicitly contained by all secondary indexes.
+func removeHandleColumns(w utils.WorkloadInfo, cols []utils.Column) []utils.Column {
+	var result []utils.Column
+	for _, col := range cols {
+		if !isHandleColumn(w, col) {
+			result = append(result, col)
+		}
+	}
+	return result
+}
+
+// trimHandleSuffix removes the trailing clustered primary key columns of the index, since a secondary index
+// implicitly ends with the handle, e.g. (a, id) is equivalent to (a) if id is the clustered primary key.
+func trimHandleSuffix(w utils.WorkloadInfo, idx utils.Index) utils.Index {
+	table, ok := w.TableSchemas.Find(utils.TableSchema{SchemaName: idx.SchemaName, TableName: strings.ToLower(idx.TableName)})
+	if !ok {
+		return idx
+	}
+	handle := table.HandleColumns()
+	for k := utils.Min(len(idx.Columns), len(handle)); k > 0; k-- {
+		// the suffix with k columns is redundant if it's the same as the first k handle columns.
+		suffix, redundant := idx.Columns[len(idx.Columns)-k:], true
+		for i := range suffix {
+			if suffix[i].IsExpression() || suffix[i].Length > 0 || strings.ToLower(suffix[i].ColumnName) != handle[i].ColumnName {
+				redundant = false
+				break
+			}
+		}
+		if !redundant {
+			continue
+		}
+		trimmed := idx
+		trimmed.Columns = append([]utils.Column{}, idx.Columns[:len(idx.Columns)-k]...)
+		if len(trimmed.Columns) > 0 {
+			trimmed.IndexName = tempIndexName(trimmed.Columns...)
+		}
+		return trimmed
+	}
+	return idx
+}
+
+// normalizeIndexes trims redundant handle suffixes of these indexes and removes indexes which only contain handle columns.
+func normalizeIndexes(w utils.WorkloadInfo, indexes utils.Set[utils.Index]) utils.Set[utils.Index] {
+	normalized := utils.NewSet[utils.Index]()
+	for _, idx := range indexes.ToList() {
+		idx = trimHandleSuffix(w, idx)
+		if len(idx.Columns) > 0 {
+			normalized.Add(idx)
+		}
+	}
+	return normalized
+}
+
+// isHandleColumn returns whether this column is a column of the clustered primary key of its table.
+func isHandleColumn(w utils.WorkloadInfo, col utils.Column) bool {
+	if col.IsExpression() || col.Length > 0 {
+		return false
+	}
+	table, ok := w.TableSchemas.Find(utils.TableSchema{SchemaName: col.SchemaName, TableName: strings.ToLower(col.TableName)})
+	if !ok {
+		return false
+	}
+	for _, h := range table.HandleColumns() {
+		if h.ColumnName == strings.ToLower(col.ColumnName) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexNamePart returns the part of an index name for the given column, e.g. `a`, `j_tags` for `j->'$.tags'`, or
+// `j_expr_1a2b3c4d` for an expression on `j`.
+func indexNamePart(col utils.Column) string {
+	if col.Expr != "" {
+		h := fnv.New32a()
+		h.Write([]byte(col.Expr))
+		return fmt.Sprintf("%v_expr_%08x", col.ColumnName, h.Sum32())
+	}
+	if col.JSONPath == "" {
+		return col.ColumnName
+	}
+	path := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(col.JSONPath, "$"))
+	return strings.TrimRight(col.ColumnName+"_"+strings.Trim(path, "_"), "_")
+}
+
 func checkWorkloadInfo(w utils.WorkloadInfo) {
 	for _, col := range w.IndexableColumns.ToList() {
 		if col.SchemaName == "" || col.TableName == "" || col.ColumnName == "" {
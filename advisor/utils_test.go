@@ -0,0 +1,44 @@
+package advisor
+
+import (
+	"testing"
+
+	"github.com/qw4990/index_advisor/utils"
+)
+
+func TestTrimHandleSuffix(t *testing.T) {
+	t1, err := utils.ParseCreateTableStmt("test", "create table t1 (id int primary key, a int, b int)")
+	must(err)
+	t2, err := utils.ParseCreateTableStmt("test", "create table t2 (a int, b int, c int, primary key (a, b) /*T![clustered_index] CLUSTERED */)")
+	must(err)
+	t3, err := utils.ParseCreateTableStmt("test", "create table t3 (a int, b int, primary key (a) /*T![clustered_index] NONCLUSTERED */)")
+	must(err)
+	w := utils.WorkloadInfo{TableSchemas: utils.ListToSet(t1, t2, t3)}
+
+	cases := []struct {
+		index  utils.Index
+		result string
+	}{
+		{utils.NewIndex("test", "t1", "idx", "a", "id"), "test.t1(a)"},
+		{utils.NewIndex("test", "t1", "idx", "a", "b"), "test.t1(a,b)"},
+		{utils.NewIndex("test", "t1", "idx", "id", "a"), "test.t1(id,a)"},
+		{utils.NewIndex("test", "t1", "idx", "id"), "test.t1()"},
+		{utils.NewIndex("test", "t2", "idx", "c", "a", "b"), "test.t2(c)"},
+		{utils.NewIndex("test", "t2", "idx", "c", "a"), "test.t2(c)"},
+		{utils.NewIndex("test", "t2", "idx", "c", "b"), "test.t2(c,b)"}, // (c, b, a, b) is different from (c, a, b)
+		{utils.NewIndex("test", "t3", "idx", "b", "a"), "test.t3(b,a)"}, // the handle is _tidb_rowid
+	}
+	for _, c := range cases {
+		if r := trimHandleSuffix(w, c.index); r.Key() != c.result {
+			t.Errorf("trimHandleSuffix(%v) = %v, expected %v", c.index.Key(), r.Key(), c.result)
+		}
+	}
+
+	normalized := normalizeIndexes(w, utils.ListToSet(
+		utils.NewIndex("test", "t1", "idx_a_id", "a", "id"),
+		utils.NewIndex("test", "t1", "idx_a", "a"),
+		utils.NewIndex("test", "t1", "idx_id", "id")))
+	if keys := normalized.ToKeyList(); len(keys) != 1 || keys[0] != "test.t1(a)" {
+		t.Errorf("unexpected normalized indexes %v", keys)
+	}
+}
@@ -1,19 +1,42 @@
 package advisor
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qw4990/index_advisor/optimizer"
 	"github.com/qw4990/index_advisor/utils"
 )
 
+// CompressionSummary describes how a workload is compressed.
+type CompressionSummary struct {
+	Algo         string
+	NumQueries   int            // the number of queries before compression
+	NumKept      int            // the number of queries after compression
+	CostCoverage float64        // the ratio of the total workload cost covered by kept queries, -1 if it's not estimated
+	Dropped      []DroppedQuery // queries dropped by compression
+}
+
+// DroppedQuery is a query dropped by workload compression.
+type DroppedQuery struct {
+	Alias     string
+	Frequency int
+	Cost      float64 // the estimated cost of the query, PlanCost*Frequency*Weight, 0 if it's not estimated
+}
+
 // NoneWorkloadInfoCompress does nothing.
-func NoneWorkloadInfoCompress(workloadInfo utils.WorkloadInfo) utils.WorkloadInfo {
-	return workloadInfo
+func NoneWorkloadInfoCompress(workloadInfo utils.WorkloadInfo, _ Parameter, _ optimizer.WhatIfOptimizer) (utils.WorkloadInfo, CompressionSummary, error) {
+	n := workloadInfo.Queries.Size()
+	return workloadInfo, CompressionSummary{Algo: "none", NumQueries: n, NumKept: n, CostCoverage: 1}, nil
 }
 
 // DigestWorkloadInfoCompress compresses queries by digest.
-func DigestWorkloadInfoCompress(workloadInfo utils.WorkloadInfo) utils.WorkloadInfo {
+func DigestWorkloadInfoCompress(workloadInfo utils.WorkloadInfo, _ Parameter, _ optimizer.WhatIfOptimizer) (utils.WorkloadInfo, CompressionSummary, error) {
 	compressed := workloadInfo
 	compressed.Queries = compressBySQLDigest(compressed.Queries)
-	return compressed
+	return compressed, CompressionSummary{Algo: "digest", NumQueries: workloadInfo.Queries.Size(),
+		NumKept: compressed.Queries.Size(), CostCoverage: 1}, nil // queries are merged rather than dropped
 }
 
 func compressBySQLDigest(sqls utils.Set[utils.Query]) utils.Set[utils.Query] {
@@ -35,3 +58,203 @@ func compressBySQLDigest(sqls utils.Set[utils.Query]) utils.Set[utils.Query] {
 	}
 	return s
 }
+
+// ClusterWorkloadInfoCompress compresses queries by clustering them with their indexable-column signature, which
+// consists of referenced tables and indexable columns. Each cluster is represented by its most frequent query,
+// whose frequency is set to the summed frequency of the cluster.
+// If there are more clusters than parameter.MaxWorkloadSize, only the most frequent clusters are kept.
+func ClusterWorkloadInfoCompress(workloadInfo utils.WorkloadInfo, parameter Parameter, optimizer optimizer.WhatIfOptimizer) (utils.WorkloadInfo, CompressionSummary, error) {
+	summary := CompressionSummary{Algo: "cluster", NumQueries: workloadInfo.Queries.Size(), CostCoverage: -1}
+	analyzed := workloadInfo
+	analyzed.Queries = workloadInfo.Queries.Clone()
+	if err := IndexableColumnsSelectionSimple(&analyzed); err != nil {
+		return utils.WorkloadInfo{}, summary, err
+	}
+	clusters, err := clusterQueries(analyzed.Queries)
+	if err != nil {
+		return utils.WorkloadInfo{}, summary, err
+	}
+	kept := clusters
+	if parameter.MaxWorkloadSize > 0 && len(kept) > parameter.MaxWorkloadSize {
+		kept = kept[:parameter.MaxWorkloadSize]
+	}
+
+	compressed := workloadInfo
+	compressed.Queries = utils.NewSet[utils.Query]()
+	var totFreq, keptFreq int
+	for i, c := range clusters {
+		totFreq += c.representative.Frequency
+		if i < len(kept) {
+			keptFreq += c.representative.Frequency
+			compressed.Queries.Add(c.representative)
+		}
+	}
+	summary.NumKept = compressed.Queries.Size()
+	utils.Infof("cluster compression: compress %v queries into %v clusters, keep %v representatives covering %.2f%% of the total frequency",
+		workloadInfo.Queries.Size(), len(clusters), len(kept), 100*float64(keptFreq)/float64(utils.Max(totFreq, 1)))
+	if len(kept) == len(clusters) {
+		summary.CostCoverage = 1
+		return compressed, summary, nil
+	}
+
+	// queries in dropped clusters are dropped, and the coverage is computed against all queries in the workload
+	var costs map[string]float64
+	if optimizer != nil {
+		var err error
+		if costs, err = queryCosts(optimizer, workloadInfo.Queries.ToList()); err != nil {
+			return utils.WorkloadInfo{}, summary, err
+		}
+	}
+	var totCost, keptCost float64
+	for i, c := range clusters {
+		for _, q := range c.queries {
+			totCost += costs[q.Key()]
+			if i < len(kept) {
+				keptCost += costs[q.Key()]
+			} else {
+				summary.Dropped = append(summary.Dropped, DroppedQuery{Alias: q.Alias, Frequency: q.Frequency, Cost: costs[q.Key()]})
+			}
+		}
+	}
+	sort.SliceStable(summary.Dropped, func(i, j int) bool { return summary.Dropped[i].Cost > summary.Dropped[j].Cost })
+	if optimizer != nil {
+		summary.CostCoverage = keptCost / utils.Max(totCost, 1e-9)
+		utils.Infof("cluster compression: kept clusters cover %.2f%% of the total estimated workload cost (%.2E/%.2E)",
+			100*summary.CostCoverage, keptCost, totCost)
+	}
+	return compressed, summary, nil
+}
+
+// queryCluster is a group of queries with the same indexable-column signature.
+type queryCluster struct {
+	signature      string
+	representative utils.Query   // the most frequent query, whose frequency is the summed frequency of the cluster
+	queries        []utils.Query // all queries in the cluster
+}
+
+// clusterQueries clusters queries by their signatures, and returns clusters ordered by their frequency.
+func clusterQueries(queries utils.Set[utils.Query]) ([]*queryCluster, error) {
+	clusters := make(map[string]*queryCluster)
+	maxFreq := make(map[string]int)
+	for _, q := range queries.ToList() {
+		sig, err := querySignature(q)
+		if err != nil {
+			return nil, err
+		}
+		c, ok := clusters[sig]
+		if !ok {
+			clusters[sig] = &queryCluster{signature: sig, representative: q, queries: []utils.Query{q}}
+			maxFreq[sig] = q.Frequency
+			continue
+		}
+		freq := c.representative.Frequency + q.Frequency
+		if q.Frequency > maxFreq[sig] {
+			c.representative = q
+			maxFreq[sig] = q.Frequency
+		}
+		c.representative.Frequency = freq
+		c.queries = append(c.queries, q)
+	}
+
+	result := make([]*queryCluster, 0, len(clusters))
+	for _, c := range clusters {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].representative.Frequency != result[j].representative.Frequency {
+			return result[i].representative.Frequency > result[j].representative.Frequency
+		}
+		return result[i].signature < result[j].signature // to make the result stable
+	})
+	return result, nil
+}
+
+// querySignature returns the indexable-column signature of the query, e.g. `test.t1,test.t2|test.t1.a,test.t2.b`.
+func querySignature(q utils.Query) (string, error) {
+	tables, err := utils.CollectTableNamesFromSQL(q.SchemaName, q.Text)
+	if err != nil {
+		return "", err
+	}
+	var cols []string
+	if q.IndexableColumns != nil {
+		cols = q.IndexableColumns.ToKeyList()
+	}
+	return fmt.Sprintf("%v|%v", strings.Join(tables.ToKeyList(), ","), strings.Join(cols, ",")), nil
+}
+
+// queryCosts explains every query without any hypothetical index, and returns their costs (PlanCost*Frequency*Weight).
+func queryCosts(optimizer optimizer.WhatIfOptimizer, queries []utils.Query) (map[string]float64, error) {
+	costs := make(map[string]float64, len(queries))
+	for _, q := range queries {
+		if err := optimizer.Execute(`use ` + q.SchemaName); err != nil {
+			return nil, err
+		}
+		p, err := optimizer.Explain(q.Text)
+		if err != nil {
+			return nil, err
+		}
+		costs[q.Key()] = p.PlanCost() * q.WeightedFrequency()
+	}
+	return costs, nil
+}
+
+// CostWorkloadInfoCompress compresses queries by their costs. It explains every query once without any hypothetical
+// index, and then keeps the most expensive queries (by PlanCost*Frequency*Weight) until parameter.CostCoverage of the
+// total workload cost is covered or parameter.MaxWorkloadSize queries are kept.
+func CostWorkloadInfoCompress(workloadInfo utils.WorkloadInfo, parameter Parameter, optimizer optimizer.WhatIfOptimizer) (utils.WorkloadInfo, CompressionSummary, error) {
+	summary := CompressionSummary{Algo: "cost", NumQueries: workloadInfo.Queries.Size(), CostCoverage: -1}
+	queries := workloadInfo.Queries.ToList()
+	costs, err := queryCosts(optimizer, queries)
+	if err != nil {
+		return utils.WorkloadInfo{}, summary, err
+	}
+	var totCost float64
+	for _, q := range queries {
+		totCost += costs[q.Key()]
+	}
+
+	kept, dropped := truncateQueriesByCost(queries, costs, parameter.CostCoverage, parameter.MaxWorkloadSize)
+	var keptCost float64
+	compressed := workloadInfo
+	compressed.Queries = utils.NewSet[utils.Query]()
+	for _, q := range kept {
+		keptCost += costs[q.Key()]
+		compressed.Queries.Add(q)
+	}
+
+	summary.NumKept = len(kept)
+	summary.CostCoverage = keptCost / utils.Max(totCost, 1e-9)
+	for _, q := range dropped {
+		summary.Dropped = append(summary.Dropped, DroppedQuery{Alias: q.Alias, Frequency: q.Frequency, Cost: costs[q.Key()]})
+	}
+	utils.Infof("cost compression: keep %v of %v queries covering %.2f%% of the total workload cost (%.2E/%.2E), drop %v queries",
+		len(kept), len(queries), 100*summary.CostCoverage, keptCost, totCost, len(dropped))
+	return compressed, summary, nil
+}
+
+// truncateQueriesByCost sorts queries by their costs in descending order, and keeps the most expensive ones
+// until the coverage of the total cost is reached or maxSize queries are kept.
+func truncateQueriesByCost(queries []utils.Query, costs map[string]float64, coverage float64, maxSize int) (kept, dropped []utils.Query) {
+	sorted := make([]utils.Query, len(queries))
+	copy(sorted, queries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return costs[sorted[i].Key()] > costs[sorted[j].Key()]
+	})
+	var totCost float64
+	for _, q := range sorted {
+		totCost += costs[q.Key()]
+	}
+
+	var keptCost float64
+	for i, q := range sorted {
+		if maxSize > 0 && len(kept) >= maxSize {
+			return kept, sorted[i:]
+		}
+		if coverage < 1 && len(kept) > 0 && keptCost >= coverage*totCost {
+			return kept, sorted[i:]
+		}
+		kept = append(kept, q)
+		keptCost += costs[q.Key()]
+	}
+	return kept, nil
+}
@@ -1,6 +1,8 @@
 package advisor
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/qw4990/index_advisor/utils"
@@ -16,3 +18,87 @@ func TestDigestCompression(t *testing.T) {
 		t.Errorf("expect 6, got %v", cs.ToList()[0].Frequency)
 	}
 }
+
+func TestClusterCompression(t *testing.T) {
+	s := utils.NewSet[utils.Query]()
+	s.Add(utils.Query{Alias: "q1", SchemaName: "test", Text: "select * from t1 where a = 1", Frequency: 1})
+	s.Add(utils.Query{Alias: "q2", SchemaName: "test", Text: "select * from t1 where a > 2", Frequency: 5})
+	s.Add(utils.Query{Alias: "q3", SchemaName: "test", Text: "select * from t1 where a in (1, 2)", Frequency: 3})
+	s.Add(utils.Query{Alias: "q4", SchemaName: "test", Text: "select * from t1 where b = 1", Frequency: 2})
+	s.Add(utils.Query{Alias: "q5", SchemaName: "test", Text: "select * from t1, t2 where t1.a = t2.a", Frequency: 1})
+	t1, err := utils.ParseCreateTableStmt("test", "create table t1 (a int, b int)")
+	must(err)
+	t2, err := utils.ParseCreateTableStmt("test", "create table t2 (a int)")
+	must(err)
+	w := utils.WorkloadInfo{Queries: s, TableSchemas: utils.ListToSet(t1, t2)}
+
+	cw, summary, err := ClusterWorkloadInfoCompress(w, Parameter{}, nil)
+	must(err)
+	if summary.NumKept != 3 || summary.CostCoverage != 1 || len(summary.Dropped) != 0 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	if cw.Queries.Size() != 3 {
+		t.Errorf("expect 3 clusters, got %v", cw.Queries.Size())
+	}
+	q := cw.Queries.ToList()[0] // sorted by text
+	if q.Alias != "q2" || q.Frequency != 1+5+3 {
+		t.Errorf("unexpected representative %v with frequency %v", q.Alias, q.Frequency)
+	}
+
+	cw, summary, err = ClusterWorkloadInfoCompress(w, Parameter{MaxWorkloadSize: 2}, nil)
+	must(err)
+	if summary.NumQueries != 5 || summary.NumKept != 2 || len(summary.Dropped) != 1 || summary.Dropped[0].Alias != "q5" {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	var aliases []string
+	for _, q := range cw.Queries.ToList() {
+		aliases = append(aliases, q.Alias)
+	}
+	if len(aliases) != 2 || aliases[0] != "q2" || aliases[1] != "q4" {
+		t.Errorf("unexpected representatives %v", aliases)
+	}
+
+	// the coverage is computed against all queries, including queries represented by q2
+	base := make(map[string]float64)
+	for _, q := range s.ToList() {
+		base[q.Text] = 10
+	}
+	base["select * from t1 where a = 1"] = 50
+	base["select * from t1, t2 where t1.a = t2.a"] = 100
+	_, summary, err = ClusterWorkloadInfoCompress(w, Parameter{MaxWorkloadSize: 2}, &fakeCostOptimizer{base: base, hypo: make(map[string]bool)})
+	must(err)
+	if summary.CostCoverage != 150.0/250 || len(summary.Dropped) != 1 || summary.Dropped[0].Cost != 100 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+}
+
+func TestTruncateQueriesByCost(t *testing.T) {
+	var queries []utils.Query
+	costs := make(map[string]float64)
+	for i, cost := range []float64{10, 50, 30, 5, 5} {
+		q := utils.Query{Alias: fmt.Sprintf("q%v", i+1), Text: fmt.Sprintf("select %v", i+1), Frequency: 1}
+		queries = append(queries, q)
+		costs[q.Key()] = cost
+	}
+
+	aliases := func(qs []utils.Query) string {
+		var result []string
+		for _, q := range qs {
+			result = append(result, q.Alias)
+		}
+		return strings.Join(result, ",")
+	}
+	check := func(coverage float64, maxSize int, expectedKept, expectedDropped string) {
+		kept, dropped := truncateQueriesByCost(queries, costs, coverage, maxSize)
+		if aliases(kept) != expectedKept || aliases(dropped) != expectedDropped {
+			t.Errorf("coverage %v, max size %v: expect %v|%v, got %v|%v", coverage, maxSize,
+				expectedKept, expectedDropped, aliases(kept), aliases(dropped))
+		}
+	}
+	check(1, 0, "q2,q3,q1,q4,q5", "")
+	check(0.8, 0, "q2,q3", "q1,q4,q5")
+	check(0.9, 0, "q2,q3,q1", "q4,q5")
+	check(0.01, 0, "q2", "q3,q1,q4,q5")
+	check(1, 2, "q2,q3", "q1,q4,q5")
+	check(0.9, 4, "q2,q3,q1", "q4,q5")
+}
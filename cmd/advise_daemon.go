@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type adviseDaemonCmdOpt struct {
+	adviseOnlineCmdOpt
+
+	interval         time.Duration
+	historyDir       string
+	benefitChangeThr float64
+	maxRuns          int
+}
+
+func NewAdviseDaemonCmd() *cobra.Command {
+	var opt adviseDaemonCmdOpt
+	cmd := &cobra.Command{
+		Use:   "advise-daemon",
+		Short: "periodically advise indexes for the workload of your online TiDB cluster, use `index_advisor advise-daemon --help` to see more details",
+		Long: `periodically advise indexes for the workload of your online TiDB cluster.
+How it work:
+1. every interval, read all queries from the 'STATEMENT_SUMMARY' system table and advise indexes like 'advise-online'
+2. persist the recommended indexes and their estimated benefit of each run into the history store
+3. emit a new report only when the recommended indexes or their estimated benefit change materially
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			if opt.historyDir == "" {
+				return fmt.Errorf("history-dir is not specified")
+			}
+			if opt.interval <= 0 {
+				return fmt.Errorf("invalid interval %v", opt.interval)
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			return runAdviseDaemon(ctx, opt)
+		},
+	}
+
+	cmd.Flags().IntVar(&opt.maxNumIndexes, "max-num-indexes", 5, "max number of indexes to recommend, 1~20")
+	cmd.Flags().IntVar(&opt.maxIndexWidth, "max-index-width", 3, "the max number of columns in recommended indexes")
+	cmd.Flags().StringVar(&opt.compressAlgo, "compress-algo", "none", "the workload compression algorithm, one of 'none', 'digest', 'cluster', 'cost'")
+	cmd.Flags().IntVar(&opt.maxWorkloadSize, "max-workload-size", 0, "the max number of queries kept after compressing the workload with the 'cluster' or 'cost' algorithm, 0 means no limitation")
+	cmd.Flags().Float64Var(&opt.costCoverage, "cost-coverage", 1, "the ratio of the total workload cost to keep when compressing the workload with the 'cost' algorithm, e.g. '0.9'")
+	cmd.Flags().Float64Var(&opt.regressionThr, "regression-threshold", 0.05, "a query regresses if its cost increases more than this ratio under the recommended indexes, regressed queries are reported in the summary")
+	cmd.Flags().BoolVar(&opt.rejectRegression, "reject-regression", false, "reject index configurations that regress any query with weighted frequency above '--regression-weight-limit'")
+	cmd.Flags().Float64Var(&opt.regressionWeightLimit, "regression-weight-limit", 0, "only queries with weighted frequency(frequency*weight) above this limit are protected by '--reject-regression', 0 protects all queries")
+
+	cmd.Flags().StringVar(&opt.dsn, "dsn", "root:@tcp(127.0.0.1:4000)/test", "dsn")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+
+	cmd.Flags().StringSliceVar(&opt.querySchemas, "query-schemas", []string{}, "a list of schema(database), e.g. 'test1, test2', queries that are running under these schemas will be considered")
+	cmd.Flags().IntVar(&opt.queryExecTimeThreshold, "query-exec-time-threshold", 0, "the threshold of query execution time(in milliseconds), e.g. '300', queries that are running longer than this threshold will be considered")
+	cmd.Flags().IntVar(&opt.queryExecCountThreshold, "query-exec-count-threshold", 0, "the threshold of query execution count, e.g. '20', queries that are executed more than this threshold will be considered")
+	cmd.Flags().StringVar(&opt.timeRange, "time-range", "", "the time range of statement summary windows to consider in each run, usually a duration like '24h'")
+	cmd.Flags().DurationVar(&opt.recencyHalfLife, "recency-half-life", 0, "if specified, e.g. '6h', the execution count of each statement summary window is weighted by 0.5^(age/half-life) to make recent windows more important")
+
+	cmd.Flags().DurationVar(&opt.interval, "interval", time.Hour, "the interval between two runs, e.g. '30m'")
+	cmd.Flags().StringVar(&opt.historyDir, "history-dir", "", "(required) the directory to store the history of all runs and reports, e.g. './advise_history'")
+	cmd.Flags().Float64Var(&opt.benefitChangeThr, "benefit-change-threshold", 0.05, "emit a new report if the estimated cost reduction ratio changes more than this threshold even if the recommended indexes are the same")
+	cmd.Flags().IntVar(&opt.maxRuns, "max-runs", 0, "stop after this number of runs, 0 means running until interrupted")
+	return cmd
+}
+
+// adviseRun is a run of the advisor daemon persisted in the history store.
+type adviseRun struct {
+	Time          time.Time `json:"time"`
+	QueryCount    int       `json:"query_count"`
+	Indexes       []string  `json:"indexes"`    // DDL statements of recommended indexes, sorted
+	IndexKeys     []string  `json:"index_keys"` // keys of recommended indexes, sorted, which don't depend on generated index names
+	OriginalCost  float64   `json:"original_cost"`
+	OptimizedCost float64   `json:"optimized_cost"`
+	Error         string    `json:"error,omitempty"`
+	Report        string    `json:"report,omitempty"` // the report directory if a new report is emitted
+}
+
+// Benefit returns the estimated cost reduction ratio of the recommended indexes.
+func (r adviseRun) Benefit() float64 {
+	if r.OriginalCost <= 0 {
+		return 0
+	}
+	return 1 - r.OptimizedCost/r.OriginalCost
+}
+
+const adviseHistoryFile = "history.jsonl"
+
+// loadAdviseHistory loads all runs from the history store.
+func loadAdviseHistory(historyDir string) ([]adviseRun, error) {
+	f, err := os.Open(path.Join(historyDir, adviseHistoryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var runs []adviseRun
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r adviseRun
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return nil, fmt.Errorf("invalid history record %v: %v", line, err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, scanner.Err()
+}
+
+// appendAdviseHistory appends the run into the history store.
+func appendAdviseHistory(historyDir string, r adviseRun) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path.Join(historyDir, adviseHistoryFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// lastReportedRun returns the last run that emitted a report, nil if there is no such run.
+func lastReportedRun(runs []adviseRun) *adviseRun {
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Report != "" {
+			return &runs[i]
+		}
+	}
+	return nil
+}
+
+// adviseResultChanged returns whether the current run differs from the last reported run materially,
+// which means the recommended indexes are different or the benefit changes more than benefitChangeThr.
+func adviseResultChanged(last *adviseRun, cur adviseRun, benefitChangeThr float64) (bool, string) {
+	if last == nil {
+		return true, "no previous report"
+	}
+	if strings.Join(last.IndexKeys, ";") != strings.Join(cur.IndexKeys, ";") {
+		return true, fmt.Sprintf("recommended indexes change from %v to %v", last.Indexes, cur.Indexes)
+	}
+	if diff := math.Abs(cur.Benefit() - last.Benefit()); diff > benefitChangeThr {
+		return true, fmt.Sprintf("estimated cost reduction ratio changes from %.2f%% to %.2f%%", 100*last.Benefit(), 100*cur.Benefit())
+	}
+	return false, ""
+}
+
+func runAdviseDaemon(ctx context.Context, opt adviseDaemonCmdOpt) error {
+	if err := os.MkdirAll(path.Join(opt.historyDir, "reports"), 0755); err != nil {
+		return err
+	}
+	history, err := loadAdviseHistory(opt.historyDir)
+	if err != nil {
+		return err
+	}
+	utils.Infof("[advise-daemon] start with %v runs in the history, interval %v", len(history), opt.interval)
+
+	ticker := time.NewTicker(opt.interval)
+	defer ticker.Stop()
+	for runs := 1; ; runs++ {
+		r := adviseOnce(opt, lastReportedRun(history))
+		if err := appendAdviseHistory(opt.historyDir, r); err != nil {
+			return err
+		}
+		history = append(history, r)
+		if opt.maxRuns > 0 && runs >= opt.maxRuns {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			utils.Infof("[advise-daemon] stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// adviseOnce runs the advisor once and emits a report if the result changes materially.
+// Errors are recorded in the returned run instead of stopping the daemon.
+func adviseOnce(opt adviseDaemonCmdOpt, lastReported *adviseRun) adviseRun {
+	r := adviseRun{Time: time.Now()}
+	indexes, info, compression, db, err := adviseOnlineMode(opt.adviseOnlineCmdOpt)
+	if db != nil {
+		defer db.Close()
+	}
+	if err != nil {
+		utils.Warningf("[advise-daemon] fail to advise indexes: %v", err)
+		r.Error = err.Error()
+		return r
+	}
+	indexList := indexes.ToList()
+	for _, idx := range indexList {
+		r.Indexes = append(r.Indexes, idx.DDL())
+		r.IndexKeys = append(r.IndexKeys, idx.Key())
+	}
+	sort.Strings(r.Indexes)
+	sort.Strings(r.IndexKeys)
+	r.QueryCount = info.Queries.Size()
+	planChanges, err := getPlanChanges(db, *info, indexList)
+	if err != nil {
+		utils.Warningf("[advise-daemon] fail to estimate the benefit: %v", err)
+		r.Error = err.Error()
+		return r
+	}
+	for _, change := range planChanges {
+		r.OriginalCost += change.OriPlan.PlanCost() * change.SQL.WeightedFrequency()
+		r.OptimizedCost += change.OptPlan.PlanCost() * change.SQL.WeightedFrequency()
+	}
+
+	changed, reason := adviseResultChanged(lastReported, r, opt.benefitChangeThr)
+	if !changed {
+		utils.Infof("[advise-daemon] %v indexes are recommended with %.2f%% cost reduction, no material change since the last report",
+			len(r.Indexes), 100*r.Benefit())
+		return r
+	}
+	reportDir := path.Join(opt.historyDir, "reports", r.Time.Format("20060102150405"))
+	utils.Infof("[advise-daemon] emit a new report into %v since %v", reportDir, reason)
+	if err := outputAdviseResult(indexes, compression, *info, db, reportDir, opt.regressionThr); err != nil {
+		utils.Warningf("[advise-daemon] fail to emit the report: %v", err)
+		r.Error = err.Error()
+		return r
+	}
+	r.Report = reportDir
+	return r
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAdviseResultChanged(t *testing.T) {
+	last := &adviseRun{Indexes: []string{"CREATE INDEX idx_a ON test.t (a)"}, IndexKeys: []string{"test.t(a)"}, OriginalCost: 100, OptimizedCost: 50}
+	cases := []struct {
+		cur     adviseRun
+		changed bool
+	}{
+		{adviseRun{Indexes: []string{"CREATE INDEX idx_a ON test.t (a)"}, IndexKeys: []string{"test.t(a)"}, OriginalCost: 100, OptimizedCost: 52}, false},
+		{adviseRun{Indexes: []string{"CREATE INDEX idx_1 ON test.t (a)"}, IndexKeys: []string{"test.t(a)"}, OriginalCost: 100, OptimizedCost: 50}, false},
+		{adviseRun{Indexes: []string{"CREATE INDEX idx_a ON test.t (a)"}, IndexKeys: []string{"test.t(a)"}, OriginalCost: 200, OptimizedCost: 80}, true},
+		{adviseRun{Indexes: []string{"CREATE INDEX idx_b ON test.t (b)"}, IndexKeys: []string{"test.t(b)"}, OriginalCost: 100, OptimizedCost: 50}, true},
+		{adviseRun{OriginalCost: 100, OptimizedCost: 100}, true},
+	}
+	for i, c := range cases {
+		if changed, reason := adviseResultChanged(last, c.cur, 0.05); changed != c.changed {
+			t.Errorf("case %v: expect %v, got %v(%v)", i, c.changed, changed, reason)
+		}
+	}
+	if changed, _ := adviseResultChanged(nil, adviseRun{}, 0.05); !changed {
+		t.Errorf("the first run should be reported")
+	}
+}
+
+func TestAdviseHistory(t *testing.T) {
+	dir := t.TempDir()
+	runs, err := loadAdviseHistory(dir)
+	must(err)
+	mustTrue(len(runs) == 0, "expect empty history")
+
+	now := time.Now().Truncate(time.Second)
+	must(appendAdviseHistory(dir, adviseRun{Time: now, Indexes: []string{"idx1"}, Report: "r1"}))
+	must(appendAdviseHistory(dir, adviseRun{Time: now.Add(time.Hour), Indexes: []string{"idx1"}}))
+	must(appendAdviseHistory(dir, adviseRun{Time: now.Add(2 * time.Hour), Error: "connection refused"}))
+	runs, err = loadAdviseHistory(dir)
+	must(err)
+	mustTrue(len(runs) == 3 && runs[0].Time.Equal(now), fmt.Sprintf("unexpected history %v", runs))
+	last := lastReportedRun(runs)
+	mustTrue(last != nil && last.Report == "r1", fmt.Sprintf("unexpected last reported run %v", last))
+}
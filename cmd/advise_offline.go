@@ -13,8 +13,15 @@ import (
 )
 
 type adviseOfflineCmdOpt struct {
-	maxNumIndexes int
-	maxIndexWidth int
+	maxNumIndexes   int
+	maxIndexWidth   int
+	compressAlgo    string
+	maxWorkloadSize int
+	costCoverage    float64
+
+	regressionThr         float64
+	rejectRegression      bool
+	regressionWeightLimit float64
 
 	tidbVersion  string
 	queryPath    string
@@ -26,6 +33,10 @@ type adviseOfflineCmdOpt struct {
 	qWhiteList   string
 	qBlackList   string
 	logLevel     string
+
+	validate        bool
+	validateMaxRows int64
+	validateRuns    int
 }
 
 func NewAdviseOfflineCmd() *cobra.Command {
@@ -41,6 +52,8 @@ How it work:
 4. analyze those queries and generate a series of candidate indexes
 5. evaluate those candidate indexes on your online TiDB cluster through a feature named 'hypothetical index' (or 'what-if index')
 6. recommend you the best set of indexes based on the evaluation result
+7. (optional, with '--validate') generate synthetic data matching the statistics, create the recommended indexes physically,
+   and compare the measured execution time of queries before and after creating them with the estimated cost
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			utils.SetLogLevel(opt.logLevel)
@@ -53,78 +66,58 @@ How it work:
 				return err
 			}
 
-			if opt.dirPath != "" {
-				opt.schemaPath = path.Join(opt.dirPath, "schema.sql")
-				opt.statsPath = path.Join(opt.dirPath, "stats")
-				opt.queryPath = path.Join(opt.dirPath, "queries")
-				if exist, isDir := utils.FileExists(opt.queryPath); exist && isDir {
-				} else {
-					opt.queryPath = path.Join(opt.dirPath, "queries.sql")
+			if opt.dirPath != "" { // resolve it here to keep the directory until the validation finishes
+				cleanup, err := resolveOfflineWorkloadDir(&opt)
+				if err != nil {
+					return err
 				}
-				utils.Infof("use schema path: %s", opt.schemaPath)
-				utils.Infof("use stats path: %s", opt.statsPath)
-				utils.Infof("use query path: %s", opt.queryPath)
-			}
-
-			dbName, err := loadSchemaIntoCluster(db, opt.schemaPath)
-			if err != nil {
-				return err
-			}
-			if err := loadStatsIntoCluster(db, opt.statsPath); err != nil {
-				return err
-			}
-			if err := db.Execute(`use ` + dbName); err != nil {
-				return err
-			}
-
-			queries, err := utils.LoadQueries(dbName, opt.queryPath)
-			if err != nil {
-				return err
-			}
-			if opt.qWhiteList != "" || opt.qBlackList != "" {
-				queries = utils.FilterQueries(queries, strings.Split(opt.qWhiteList, ","), strings.Split(opt.qBlackList, ","))
+				defer cleanup()
 			}
 
-			tableNames, err := utils.CollectTableNamesFromQueries(queries)
+			indexes, workload, compression, err := adviseOfflineMode(db, opt)
 			if err != nil {
 				return err
 			}
-			tableSchemas, err := getTableSchemas(db, tableNames)
-			if err != nil {
+			if err := outputAdviseResult(indexes, compression, *workload, db, opt.output, opt.regressionThr); err != nil {
 				return err
 			}
-
-			workload := utils.WorkloadInfo{
-				Queries:      queries,
-				TableSchemas: tableSchemas,
-			}
-
-			// set cost-model-version
-			if err := db.Execute(fmt.Sprintf("set @@tidb_cost_model_version = %v", opt.costModelVer)); err != nil {
+			if !opt.validate {
 				return nil
 			}
 
-			indexes, err := advisor.IndexAdvise(db, workload, advisor.Parameter{
-				MaxNumberIndexes: opt.maxNumIndexes,
-				MaxIndexWidth:    opt.maxIndexWidth,
-			})
+			utils.Infof("validate the recommended indexes with synthetic data")
+			validation, err := validateAdviseResult(db, indexes, *workload, opt.statsPath, opt.validateMaxRows, opt.validateRuns)
 			if err != nil {
 				return err
 			}
-			return outputAdviseResult(indexes, workload, db, opt.output)
+			content := validation.format()
+			fmt.Println(content)
+			if opt.output != "" {
+				return utils.SaveContentTo(path.Join(opt.output, "validation.txt"), content)
+			}
+			return nil
 		},
 	}
 
 	cmd.Flags().IntVar(&opt.maxNumIndexes, "max-num-indexes", 5, "max number of indexes to recommend, 1~20")
 	cmd.Flags().IntVar(&opt.maxIndexWidth, "max-index-width", 3, "the max number of columns in recommended indexes")
+	cmd.Flags().StringVar(&opt.compressAlgo, "compress-algo", "none", "the workload compression algorithm, one of 'none', 'digest', 'cluster', 'cost'")
+	cmd.Flags().IntVar(&opt.maxWorkloadSize, "max-workload-size", 0, "the max number of queries kept after compressing the workload with the 'cluster' or 'cost' algorithm, 0 means no limitation")
+	cmd.Flags().Float64Var(&opt.costCoverage, "cost-coverage", 1, "the ratio of the total workload cost to keep when compressing the workload with the 'cost' algorithm, e.g. '0.9'")
+	cmd.Flags().Float64Var(&opt.regressionThr, "regression-threshold", 0.05, "a query regresses if its cost increases more than this ratio under the recommended indexes, regressed queries are reported in the summary")
+	cmd.Flags().BoolVar(&opt.rejectRegression, "reject-regression", false, "reject index configurations that regress any query with weighted frequency above '--regression-weight-limit'")
+	cmd.Flags().Float64Var(&opt.regressionWeightLimit, "regression-weight-limit", 0, "only queries with weighted frequency(frequency*weight) above this limit are protected by '--reject-regression', 0 protects all queries")
 
 	cmd.Flags().StringVar(&opt.tidbVersion, "tidb-version", "nightly", "tidb version, one of 'nightly', 'v7.3.0'")
-	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "(required) query file or dictionary path, e.g. './examples/tpch_example1/queries' or 'examples/tpch_example2/query.sql'")
+	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "(required) query file or dictionary path, e.g. './examples/tpch_example1/queries', 'examples/tpch_example2/query.sql' or 'queries.json', '.json', '.yaml', '.yml' and '.csv' files are loaded as structured workload files")
 	cmd.Flags().StringVar(&opt.schemaPath, "schema-path", "", "(optional) schema file path, e.g. './examples/tpch_example1/schema.sql'")
 	cmd.Flags().StringVar(&opt.statsPath, "stats-path", "", "(optional) stats dictionary path, e.g. './examples/tpch_example1/stats'")
-	cmd.Flags().StringVar(&opt.dirPath, "dir-path", "", "(optional) the dictionary path that contains queries, schema and stats, e.g. './examples/tpch_example1'")
+	cmd.Flags().StringVar(&opt.dirPath, "dir-path", "", "(optional) the dictionary path that contains queries, schema and stats, or a workload bundle exported by 'workload-export', e.g. './examples/tpch_example1' or './workload.tar.gz'")
 	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result, e.g. './output'")
 	cmd.Flags().StringVar(&opt.costModelVer, "cost-model-ver", "2", "cost model version, 1 or 2")
+	cmd.Flags().BoolVar(&opt.validate, "validate", false, "validate the recommended indexes by executing the workload on synthetic data generated from the statistics")
+	cmd.Flags().Int64Var(&opt.validateMaxRows, "validate-max-rows", 10000, "the max number of synthetic rows generated for each table in the validation, 0 means the same as the statistics")
+	cmd.Flags().IntVar(&opt.validateRuns, "validate-runs", 3, "the number of times each query is executed before and after creating indexes in the validation, the median execution time is used")
 
 	cmd.Flags().StringVar(&opt.qWhiteList, "query-white-list", "", "queries to consider, e.g. 'q1,q2,q6'")
 	cmd.Flags().StringVar(&opt.qBlackList, "query-black-list", "", "queries to ignore, e.g. 'q5,q12'")
@@ -132,6 +125,143 @@ How it work:
 	return cmd
 }
 
+// adviseOfflineMode loads the workload specified by opt into the TiDB instance and advises indexes for it, it also
+// returns how the workload is compressed.
+func adviseOfflineMode(db optimizer.WhatIfOptimizer, opt adviseOfflineCmdOpt) (utils.Set[utils.Index], *utils.WorkloadInfo, advisor.CompressionSummary, error) {
+	if opt.dirPath != "" {
+		cleanup, err := resolveOfflineWorkloadDir(&opt)
+		if err != nil {
+			return nil, nil, advisor.CompressionSummary{}, err
+		}
+		defer cleanup()
+	}
+
+	dbName, dbNames, err := loadSchemaIntoCluster(db, opt.schemaPath)
+	if err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+	if len(dbNames) > 0 {
+		utils.Infof("load %v databases %v, queries without a database use %v by default", len(dbNames), dbNames, dbName)
+	}
+	if err := loadStatsIntoCluster(db, opt.statsPath); err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+	if err := db.Execute(`use ` + dbName); err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+
+	queries, err := utils.LoadQueries(dbName, opt.queryPath)
+	if err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+	if opt.qWhiteList != "" || opt.qBlackList != "" {
+		queries = utils.FilterQueries(queries, strings.Split(opt.qWhiteList, ","), strings.Split(opt.qBlackList, ","))
+	}
+	if len(dbNames) > 0 {
+		queries = filterQueriesByDatabases(queries, dbNames)
+	}
+	queries, err = bindQueryParams(db, queries)
+	if err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+
+	tableNames, err := utils.CollectTableNamesFromQueries(queries)
+	if err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+	tableSchemas, err := getTableSchemas(db, tableNames)
+	if err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+
+	workload := utils.WorkloadInfo{
+		Queries:      queries,
+		TableSchemas: tableSchemas,
+	}
+
+	// set cost-model-version
+	if err := db.Execute(fmt.Sprintf("set @@tidb_cost_model_version = %v", opt.costModelVer)); err != nil {
+		return nil, nil, advisor.CompressionSummary{}, err
+	}
+
+	indexes, compression, err := advisor.IndexAdvise(db, workload, advisor.Parameter{
+		MaxNumberIndexes: opt.maxNumIndexes,
+		MaxIndexWidth:    opt.maxIndexWidth,
+		CompressionAlgo:  opt.compressAlgo,
+		MaxWorkloadSize:  opt.maxWorkloadSize,
+		CostCoverage:     opt.costCoverage,
+
+		RejectRegression:      opt.rejectRegression,
+		RegressionThreshold:   opt.regressionThr,
+		RegressionWeightLimit: opt.regressionWeightLimit,
+	})
+	return indexes, &workload, compression, err
+}
+
+// resolveOfflineWorkloadDir opens the workload directory or bundle specified by '--dir-path' and sets the schema, query
+// and stats paths of opt to files in it, the returned cleanup function removes the extracted bundle.
+func resolveOfflineWorkloadDir(opt *adviseOfflineCmdOpt) (cleanup func(), err error) {
+	dir, removeDir, err := openWorkloadDir(opt.dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			removeDir()
+		}
+	}()
+	manifest, err := utils.LoadWorkloadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil { // exported by workload-export, use files listed in its manifest
+		problems, err := utils.ValidateWorkloadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range problems {
+			utils.Warningf("workload %v: %v", opt.dirPath, p)
+		}
+		opt.schemaPath = path.Join(dir, manifest.SchemaFile)
+		opt.queryPath = path.Join(dir, manifest.QueryFile)
+	} else {
+		opt.schemaPath = path.Join(dir, "schema.sql")
+		opt.queryPath = path.Join(dir, "queries")
+		if exist, isDir := utils.FileExists(opt.queryPath); !exist || !isDir {
+			opt.queryPath = path.Join(dir, "queries.sql")
+			for _, f := range []string{"queries.json", "queries.yaml", "queries.yml"} {
+				if exist, _ := utils.FileExists(path.Join(dir, f)); exist {
+					opt.queryPath = path.Join(dir, f)
+					break
+				}
+			}
+		}
+	}
+	opt.statsPath = path.Join(dir, "stats")
+	opt.dirPath = "" // resolved
+	utils.Infof("use schema path: %s", opt.schemaPath)
+	utils.Infof("use stats path: %s", opt.statsPath)
+	utils.Infof("use query path: %s", opt.queryPath)
+	return removeDir, nil
+}
+
+// filterQueriesByDatabases drops queries whose databases are not in the schema file.
+func filterQueriesByDatabases(queries utils.Set[utils.Query], dbNames []string) utils.Set[utils.Query] {
+	dbs := make(map[string]bool, len(dbNames))
+	for _, name := range dbNames {
+		dbs[strings.ToLower(name)] = true
+	}
+	filtered := utils.NewSet[utils.Query]()
+	for _, q := range queries.ToList() {
+		if !dbs[strings.ToLower(q.SchemaName)] {
+			utils.Warningf("skip query %v since its database %v is not in the schema file", q.Alias, q.SchemaName)
+			continue
+		}
+		filtered.Add(q)
+	}
+	return filtered
+}
+
 func startTiDB(ver string) (*utils.LocalTiDBServer, optimizer.WhatIfOptimizer, error) {
 	s, err := utils.StartLocalTiDBServer(ver)
 	if err != nil {
@@ -146,7 +276,9 @@ func startTiDB(ver string) (*utils.LocalTiDBServer, optimizer.WhatIfOptimizer, e
 	return s, db, nil
 }
 
-func outputAdviseResult(indexes utils.Set[utils.Index], workload utils.WorkloadInfo, optimizer optimizer.WhatIfOptimizer, savePath string) error {
+// outputAdviseResult prints and saves the recommended indexes and plan changes of queries,
+// queries whose cost increases more than regressionThr are reported as regressions.
+func outputAdviseResult(indexes utils.Set[utils.Index], compression advisor.CompressionSummary, workload utils.WorkloadInfo, optimizer optimizer.WhatIfOptimizer, savePath string, regressionThr float64) error {
 	// index DDL statements
 	indexList := indexes.ToList()
 	sort.Slice(indexList, func(i, j int) bool { // to make the result stable
@@ -162,15 +294,16 @@ func outputAdviseResult(indexes utils.Set[utils.Index], workload utils.WorkloadI
 	if err != nil {
 		return err
 	}
-	var originalWorkloadCost, optimizerWorkloadCost float64
+	var originalWorkloadCost, optimizerWorkloadCost float64 // weighted by frequencies, the same as what the advisor minimizes
 	for _, change := range planChanges {
-		originalWorkloadCost += change.OriPlan.PlanCost()
-		optimizerWorkloadCost += change.OptPlan.PlanCost()
+		originalWorkloadCost += change.OriPlan.PlanCost() * change.SQL.WeightedFrequency()
+		optimizerWorkloadCost += change.OptPlan.PlanCost() * change.SQL.WeightedFrequency()
 	}
 
 	// summary content
 	var summaryContent string
 	summaryContent += fmt.Sprintf("Total Queries in the workload: %d\n", workload.Queries.Size())
+	summaryContent += formatCompressionSummary(compression)
 	summaryContent += fmt.Sprintf("Total number of indexes: %d\n", len(indexList))
 	for _, ddlStmt := range indexDDLStmts {
 		summaryContent += fmt.Sprintf("  %s;\n", ddlStmt)
@@ -178,10 +311,30 @@ func outputAdviseResult(indexes utils.Set[utils.Index], workload utils.WorkloadI
 	if len(indexDDLStmts) == 0 {
 		summaryContent += "  (no beneficial index recommended)\n"
 	}
+	var existingIndexes []string
+	for _, table := range workload.TableSchemas.ToList() {
+		for _, idx := range table.Indexes {
+			existingIndexes = append(existingIndexes, fmt.Sprintf("%s.%s: %s", table.SchemaName, table.TableName, idx.Definition()))
+		}
+	}
+	summaryContent += fmt.Sprintf("Total number of existing indexes on related tables: %d\n", len(existingIndexes))
+	for _, idx := range existingIndexes {
+		summaryContent += fmt.Sprintf("  %s\n", idx)
+	}
 	summaryContent += fmt.Sprintf("Total original workload cost: %.2E\n", originalWorkloadCost)
 	summaryContent += fmt.Sprintf("Total optimized workload cost: %.2E\n", optimizerWorkloadCost)
 	summaryContent += fmt.Sprintf("Total cost reduction ratio: %.2f%%\n", 100*(1-optimizerWorkloadCost/originalWorkloadCost))
 
+	regressions := regressedPlanChanges(planChanges, regressionThr)
+	if len(regressions) > 0 {
+		utils.Warningf("%v queries regress more than %.2f%% under the recommended indexes", len(regressions), 100*regressionThr)
+		summaryContent += fmt.Sprintf("WARNING: %d queries regress more than %.2f%% under the recommended indexes:\n", len(regressions), 100*regressionThr)
+		for _, change := range regressions {
+			summaryContent += fmt.Sprintf("  Alias: %s, Frequency: %d, Cost Increase Ratio: %.2E->%.2E(%.2f)\n", change.SQL.Alias, change.SQL.Frequency,
+				change.OriPlan.PlanCost(), change.OptPlan.PlanCost(), change.OptPlan.PlanCost()/change.OriPlan.PlanCost())
+		}
+	}
+
 	n := 10
 	summaryContent += fmt.Sprintf("Top %d queries with the most cost reduction ratio:\n", utils.Min(len(planChanges), n))
 	sort.Slice(planChanges, func(i, j int) bool {
@@ -240,6 +393,9 @@ func outputAdviseResult(indexes utils.Set[utils.Index], workload utils.WorkloadI
 			content += fmt.Sprintf("Original Cost: %.2E\n", change.OriPlan.PlanCost())
 			content += fmt.Sprintf("Optimized Cost: %.2E\n", change.OptPlan.PlanCost())
 			content += fmt.Sprintf("Cost Reduction Ratio: %.2f\n", change.OptPlan.PlanCost()/change.OriPlan.PlanCost())
+			if change.regressed(regressionThr) {
+				content += fmt.Sprintf("WARNING: this query regresses more than %.2f%% under the recommended indexes\n", 100*regressionThr)
+			}
 			content += "\n\n===================== original plan =====================\n"
 			content += change.OriPlan.Format()
 			content += "\n\n===================== optimized plan =====================\n"
@@ -258,12 +414,54 @@ func outputAdviseResult(indexes utils.Set[utils.Index], workload utils.WorkloadI
 	return nil
 }
 
+// formatCompressionSummary formats how the workload is compressed for the summary, it's empty if the workload is not
+// compressed.
+func formatCompressionSummary(s advisor.CompressionSummary) string {
+	if s.Algo == "" || s.Algo == "none" {
+		return ""
+	}
+	content := fmt.Sprintf("Workload compression(%s): keep %d of %d queries", s.Algo, s.NumKept, s.NumQueries)
+	if s.CostCoverage >= 0 {
+		content += fmt.Sprintf(", covering %.2f%% of the total workload cost", 100*s.CostCoverage)
+	}
+	content += "\n"
+	if len(s.Dropped) > 0 {
+		content += fmt.Sprintf("  Dropped %d queries:\n", len(s.Dropped))
+		for _, q := range s.Dropped {
+			content += fmt.Sprintf("    Alias: %s, Frequency: %d, Cost: %.2E\n", q.Alias, q.Frequency, q.Cost)
+		}
+	}
+	return content
+}
+
 type planChange struct {
 	SQL     utils.Query
 	OriPlan utils.Plan
 	OptPlan utils.Plan
 }
 
+// regressed returns whether the cost of the query increases more than regressionThr.
+func (c planChange) regressed(regressionThr float64) bool {
+	return c.OptPlan.PlanCost() > c.OriPlan.PlanCost()*(1+regressionThr)
+}
+
+// regressedPlanChanges returns regressed queries, sorted by their weighted cost increase.
+func regressedPlanChanges(planChanges []planChange, regressionThr float64) []planChange {
+	var regressions []planChange
+	for _, change := range planChanges {
+		if change.regressed(regressionThr) {
+			regressions = append(regressions, change)
+		}
+	}
+	increase := func(c planChange) float64 {
+		return (c.OptPlan.PlanCost() - c.OriPlan.PlanCost()) * c.SQL.WeightedFrequency()
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		return increase(regressions[i]) > increase(regressions[j])
+	})
+	return regressions
+}
+
 func getPlanChanges(optimizer optimizer.WhatIfOptimizer, workload utils.WorkloadInfo, indexList []utils.Index) ([]planChange, error) {
 	sqls := workload.Queries.ToList()
 	var oriPlans, optPlans []utils.Plan
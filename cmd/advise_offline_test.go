@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qw4990/index_advisor/advisor"
+)
+
+func TestFormatCompressionSummary(t *testing.T) {
+	mustTrue(formatCompressionSummary(advisor.CompressionSummary{Algo: "none", NumQueries: 3, NumKept: 3, CostCoverage: 1}) == "")
+
+	content := formatCompressionSummary(advisor.CompressionSummary{Algo: "cost", NumQueries: 3, NumKept: 2, CostCoverage: 0.95,
+		Dropped: []advisor.DroppedQuery{{Alias: "q3", Frequency: 2, Cost: 100}}})
+	mustTrue(strings.HasPrefix(content, "Workload compression(cost): keep 2 of 3 queries, covering 95.00% of the total workload cost\n"), content)
+	mustTrue(strings.Contains(content, "  Dropped 1 queries:\n    Alias: q3, Frequency: 2, Cost: 1.00E+02\n"), content)
+
+	content = formatCompressionSummary(advisor.CompressionSummary{Algo: "cluster", NumQueries: 3, NumKept: 3, CostCoverage: -1})
+	mustTrue(content == "Workload compression(cluster): keep 3 of 3 queries\n", content)
+}
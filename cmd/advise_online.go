@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"errors"
+	"time"
+
 	"github.com/qw4990/index_advisor/advisor"
 	"github.com/qw4990/index_advisor/optimizer"
 	"github.com/qw4990/index_advisor/utils"
@@ -9,8 +11,15 @@ import (
 )
 
 type adviseOnlineCmdOpt struct {
-	maxNumIndexes int
-	maxIndexWidth int
+	maxNumIndexes   int
+	maxIndexWidth   int
+	compressAlgo    string
+	maxWorkloadSize int
+	costCoverage    float64
+
+	regressionThr         float64
+	rejectRegression      bool
+	regressionWeightLimit float64
 
 	dsn      string
 	output   string
@@ -20,6 +29,8 @@ type adviseOnlineCmdOpt struct {
 	queryExecTimeThreshold  int
 	queryExecCountThreshold int
 	queryPath               string
+	timeRange               string
+	recencyHalfLife         time.Duration
 }
 
 func NewAdviseOnlineCmd() *cobra.Command {
@@ -37,16 +48,22 @@ How it work:
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			utils.SetLogLevel(opt.logLevel)
-			indexes, info, db, err := adviseOnlineMode(opt)
+			indexes, info, compression, db, err := adviseOnlineMode(opt)
 			if err != nil {
 				return err
 			}
-			return outputAdviseResult(indexes, *info, db, opt.output)
+			return outputAdviseResult(indexes, compression, *info, db, opt.output, opt.regressionThr)
 		},
 	}
 
 	cmd.Flags().IntVar(&opt.maxNumIndexes, "max-num-indexes", 5, "max number of indexes to recommend, 1~20")
 	cmd.Flags().IntVar(&opt.maxIndexWidth, "max-index-width", 3, "the max number of columns in recommended indexes")
+	cmd.Flags().StringVar(&opt.compressAlgo, "compress-algo", "none", "the workload compression algorithm, one of 'none', 'digest', 'cluster', 'cost'")
+	cmd.Flags().IntVar(&opt.maxWorkloadSize, "max-workload-size", 0, "the max number of queries kept after compressing the workload with the 'cluster' or 'cost' algorithm, 0 means no limitation")
+	cmd.Flags().Float64Var(&opt.costCoverage, "cost-coverage", 1, "the ratio of the total workload cost to keep when compressing the workload with the 'cost' algorithm, e.g. '0.9'")
+	cmd.Flags().Float64Var(&opt.regressionThr, "regression-threshold", 0.05, "a query regresses if its cost increases more than this ratio under the recommended indexes, regressed queries are reported in the summary")
+	cmd.Flags().BoolVar(&opt.rejectRegression, "reject-regression", false, "reject index configurations that regress any query with weighted frequency above '--regression-weight-limit'")
+	cmd.Flags().Float64Var(&opt.regressionWeightLimit, "regression-weight-limit", 0, "only queries with weighted frequency(frequency*weight) above this limit are protected by '--reject-regression', 0 protects all queries")
 
 	cmd.Flags().StringVar(&opt.dsn, "dsn", "root:@tcp(127.0.0.1:4000)/test", "dsn")
 	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result")
@@ -55,36 +72,48 @@ How it work:
 	cmd.Flags().StringSliceVar(&opt.querySchemas, "query-schemas", []string{}, "a list of schema(database), e.g. 'test1, test2', queries that are running under these schemas will be considered")
 	cmd.Flags().IntVar(&opt.queryExecTimeThreshold, "query-exec-time-threshold", 0, "the threshold of query execution time(in milliseconds), e.g. '300', queries that are running longer than this threshold will be considered")
 	cmd.Flags().IntVar(&opt.queryExecCountThreshold, "query-exec-count-threshold", 0, "the threshold of query execution count, e.g. '20', queries that are executed more than this threshold will be considered")
-	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "the path that contains queries, e.g. 'queries.sql', if this variable is specified, the above variables like 'query-*' will be ignored")
+	cmd.Flags().StringVar(&opt.timeRange, "time-range", "", "the time range of statement summary windows to consider, either a duration like '24h' or two timestamps like '2023-08-01 00:00:00,2023-08-02 00:00:00'")
+	cmd.Flags().DurationVar(&opt.recencyHalfLife, "recency-half-life", 0, "if specified, e.g. '6h', the execution count of each statement summary window is weighted by 0.5^(age/half-life) to make recent windows more important")
+	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "the path that contains queries, e.g. 'queries.sql' or 'queries.json', if this variable is specified, the above variables like 'query-*' will be ignored")
 	return cmd
 }
 
-func adviseOnlineMode(opt adviseOnlineCmdOpt) (utils.Set[utils.Index], *utils.WorkloadInfo, optimizer.WhatIfOptimizer, error) {
+func adviseOnlineMode(opt adviseOnlineCmdOpt) (utils.Set[utils.Index], *utils.WorkloadInfo, advisor.CompressionSummary, optimizer.WhatIfOptimizer, error) {
 	db, err := optimizer.NewTiDBWhatIfOptimizer(opt.dsn)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, advisor.CompressionSummary{}, nil, err
 	}
 	if reason := checkOnlineModeSupport(db); reason != "" {
-		return nil, nil, nil, errors.New("online mode is not supported: " + reason)
+		db.Close()
+		return nil, nil, advisor.CompressionSummary{}, nil, errors.New("online mode is not supported: " + reason)
 	}
 
 	info, err := prepareWorkloadOnlineMode(db, opt)
-	if err != nil {
-		return nil, nil, nil, err
+	if err != nil { // e.g. no queries are found, which is routine for the daemon
+		db.Close()
+		return nil, nil, advisor.CompressionSummary{}, nil, err
 	}
 
-	result, err := advisor.IndexAdvise(db, *info, advisor.Parameter{
+	result, compression, err := advisor.IndexAdvise(db, *info, advisor.Parameter{
 		MaxNumberIndexes: opt.maxNumIndexes,
 		MaxIndexWidth:    opt.maxIndexWidth,
+		CompressionAlgo:  opt.compressAlgo,
+		MaxWorkloadSize:  opt.maxWorkloadSize,
+		CostCoverage:     opt.costCoverage,
+
+		RejectRegression:      opt.rejectRegression,
+		RegressionThreshold:   opt.regressionThr,
+		RegressionWeightLimit: opt.regressionWeightLimit,
 	})
-	return result, info, db, err
+	return result, info, compression, db, err
 }
 
 func prepareWorkloadOnlineMode(db optimizer.WhatIfOptimizer, opt adviseOnlineCmdOpt) (*utils.WorkloadInfo, error) {
 	var err error
 	var queries utils.Set[utils.Query]
 	if opt.queryPath == "" {
-		queries, err = readQueriesFromStatementSummary(db, opt.querySchemas, opt.queryExecTimeThreshold, opt.queryExecCountThreshold)
+		queries, err = readQueriesFromStatementSummary(db, opt.querySchemas, opt.queryExecTimeThreshold, opt.queryExecCountThreshold,
+			opt.timeRange, opt.recencyHalfLife)
 		if err != nil {
 			return nil, err
 		}
@@ -105,6 +134,10 @@ func prepareWorkloadOnlineMode(db optimizer.WhatIfOptimizer, opt adviseOnlineCmd
 	if err != nil {
 		return nil, err
 	}
+	queries, err = bindQueryParams(db, queries)
+	if err != nil {
+		return nil, err
+	}
 	tableNames, err := utils.CollectTableNamesFromQueries(queries)
 	if err != nil {
 		return nil, err
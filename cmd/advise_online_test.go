@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/qw4990/index_advisor/optimizer"
 	"github.com/qw4990/index_advisor/utils"
@@ -49,7 +51,7 @@ func TestReadQueries(t *testing.T) {
 	must(db.Execute(`select * from bind_info`))
 
 	check := func(expected []string, opt adviseOnlineCmdOpt) {
-		sqls, _ := readQueriesFromStatementSummary(db, opt.querySchemas, opt.queryExecTimeThreshold, opt.queryExecCountThreshold)
+		sqls, _ := readQueriesFromStatementSummary(db, opt.querySchemas, opt.queryExecTimeThreshold, opt.queryExecCountThreshold, "", 0)
 		sqls, _ = filterSQLAccessingSystemTables(sqls)
 		if sqls.Size() != len(expected) {
 			t.Fatalf("expect %+v, got %+v", expected, sqls)
@@ -133,3 +135,69 @@ func mustTrue(b bool, args ...interface{}) {
 		panic(fmt.Sprintf("%v", args))
 	}
 }
+
+func TestAggregateStmtSummaryRecords(t *testing.T) {
+	records := []stmtSummaryRecord{
+		{"test", "d1", "select * from t where a=1", 10, 1000, "2023-08-01 10:00:00", -600},
+		{"test", "d1", "select * from t where a=1", 10, 1000, "2023-08-01 10:00:00", -600}, // the same window in history
+		{"test", "d1", "select * from t where a=2", 30, 2000, "2023-08-01 09:30:00", 1200},
+		{"test", "d2", "select * from t where b=1", 5, 100, "2023-08-01 10:00:00", -600},
+		{"test2", "d1", "select * from t where a=1", 1, 1000, "2023-08-01 10:00:00", -600},
+	}
+
+	queries := aggregateStmtSummaryRecords(records, 0, 0, 0)
+	if queries.Size() != 3 {
+		t.Errorf("expect 3 queries, got %v", queries.Size())
+	}
+	q, _ := queries.Find(utils.Query{SchemaName: "test", Text: "select * from t where a=1"})
+	if q.Frequency != 10+30 { // aggregated across windows
+		t.Errorf("expect frequency 40, got %v", q.Frequency)
+	}
+	q, _ = queries.Find(utils.Query{SchemaName: "test2", Text: "select * from t where a=1"})
+	if q.Frequency != 1 { // the same text in another schema is another query
+		t.Errorf("expect frequency 1, got %v", q.Frequency)
+	}
+
+	queries = aggregateStmtSummaryRecords(records, 0, 20, 0)
+	if queries.Size() != 1 {
+		t.Errorf("expect 1 query, got %v", queries.Size())
+	}
+
+	queries = aggregateStmtSummaryRecords(records, 0, 0, 20*time.Minute)
+	q, _ = queries.Find(utils.Query{SchemaName: "test", Text: "select * from t where a=1"})
+	if q.Frequency != 10+15 { // the older window is weighted by 0.5
+		t.Errorf("expect frequency 25, got %v", q.Frequency)
+	}
+
+	records = []stmtSummaryRecord{ // prepared statements with redacted arguments in the recent window
+		{"test", "d1", "select * from t where a=?", 10, 1000, "2023-08-01 10:00:00", -600},
+		{"test", "d1", "select * from t where a=2", 30, 2000, "2023-08-01 09:30:00", 1200},
+	}
+	queries = aggregateStmtSummaryRecords(records, 0, 0, 0)
+	if q := queries.ToList()[0]; q.Text != "select * from t where a=2" || q.Frequency != 40 {
+		t.Errorf("unexpected query %v with frequency %v", q.Text, q.Frequency)
+	}
+}
+
+func TestTimeRangeConditions(t *testing.T) {
+	for _, c := range []struct {
+		timeRange string
+		conds     string
+		err       bool
+	}{
+		{"", "", false},
+		{"2h", "SUMMARY_END_TIME >= now() - interval 7200 second", false},
+		{"2023-08-01 00:00:00,2023-08-02 00:00:00", "SUMMARY_END_TIME > '2023-08-01 00:00:00' AND SUMMARY_BEGIN_TIME < '2023-08-02 00:00:00'", false},
+		{"2023-08-01 00:00:00,", "SUMMARY_END_TIME > '2023-08-01 00:00:00'", false},
+		{"2023-08-02 00:00:00,2023-08-01 00:00:00", "", true},
+		{"yesterday", "", true},
+	} {
+		conds, err := timeRangeConditions(c.timeRange)
+		if (err != nil) != c.err {
+			t.Errorf("time range %v: unexpected error %v", c.timeRange, err)
+		}
+		if strings.Join(conds, " AND ") != c.conds {
+			t.Errorf("time range %v: expect %v, got %v", c.timeRange, c.conds, strings.Join(conds, " AND "))
+		}
+	}
+}
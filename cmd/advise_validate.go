@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+)
+
+// queryValidation is the estimated cost and the measured execution time of a query before and after creating the recommended indexes.
+type queryValidation struct {
+	Query   utils.Query
+	OriCost float64
+	OptCost float64
+	OriTime time.Duration
+	OptTime time.Duration
+}
+
+// adviseValidation is the result of validating the recommended indexes by executing the workload on synthetic data.
+type adviseValidation struct {
+	Rows    map[string]int64 // the number of synthetic rows of each table
+	Queries []queryValidation
+}
+
+// validateAdviseResult validates the recommended indexes in the local TiDB server:
+// 1. generate synthetic data matching the statistics files in statsPath into each table, at most maxRows rows per table;
+// 2. reload the statistics files, since the statistics are changed by inserting data;
+// 3. run each query with `EXPLAIN ANALYZE` for runs times before and after creating the recommended indexes physically.
+// New indexes are not analyzed, so the optimizer sees the same statistics as the hypothetical indexes used by the advisor.
+func validateAdviseResult(db optimizer.WhatIfOptimizer, indexes utils.Set[utils.Index], workload utils.WorkloadInfo, statsPath string, maxRows int64, runs int) (*adviseValidation, error) {
+	if runs < 1 {
+		runs = 1
+	}
+	if exist, isDir := utils.FileExists(statsPath); !exist || !isDir {
+		return nil, fmt.Errorf("no stats directory %v to generate synthetic data from", statsPath)
+	}
+	indexList := indexes.ToList()
+	sort.Slice(indexList, func(i, j int) bool { return indexList[i].Key() < indexList[j].Key() })
+	planChanges, err := getPlanChanges(db, workload, indexList)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Execute(`set global tidb_enable_auto_analyze = off`); err != nil {
+		utils.Warningf("fail to disable auto analyze, the loaded statistics may be overwritten: %v", err)
+	}
+	tableStats, err := loadStatsDumpFiles(statsPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &adviseValidation{Rows: make(map[string]int64)}
+	for _, table := range workload.TableSchemas.ToList() {
+		stats, ok := tableStats[strings.ToLower(table.Key())]
+		if !ok || stats.Count == 0 {
+			utils.Warningf("no statistics of %v, skip generating data for it", table.Key())
+			continue
+		}
+		if err := insertSyntheticData(db, table, stats, maxRows); err != nil {
+			return nil, fmt.Errorf("fail to generate data for %v: %v", table.Key(), err)
+		}
+		result.Rows[table.Key()], err = queryInt64(db, fmt.Sprintf("select count(*) from `%v`.`%v`", table.SchemaName, table.TableName))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := loadStatsIntoCluster(db, statsPath); err != nil {
+		return nil, fmt.Errorf("fail to restore the statistics: %v", err)
+	}
+
+	oriTimes, err := measureExecTimes(db, planChanges, runs)
+	if err != nil {
+		return nil, err
+	}
+	var created []utils.Index
+	defer func() { // drop created indexes even if some of them fail to be created
+		for _, idx := range created {
+			if err := db.Execute(fmt.Sprintf("DROP INDEX `%s` ON `%s`.`%s`", idx.IndexName, idx.SchemaName, idx.TableName)); err != nil {
+				utils.Warningf("fail to drop the index %v: %v", idx.IndexName, err)
+			}
+		}
+	}()
+	for _, idx := range indexList {
+		utils.Infof("execute: %s", idx.DDL())
+		if err := db.Execute(idx.DDL()); err != nil {
+			return nil, err
+		}
+		created = append(created, idx)
+	}
+	optTimes, err := measureExecTimes(db, planChanges, runs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, change := range planChanges {
+		result.Queries = append(result.Queries, queryValidation{
+			Query:   change.SQL,
+			OriCost: change.OriPlan.PlanCost(),
+			OptCost: change.OptPlan.PlanCost(),
+			OriTime: oriTimes[i],
+			OptTime: optTimes[i],
+		})
+	}
+	sort.Slice(result.Queries, func(i, j int) bool { return result.Queries[i].Query.Alias < result.Queries[j].Query.Alias })
+	return result, nil
+}
+
+// measureExecTimes runs each query with `EXPLAIN ANALYZE` for runs times and returns the median execution time of each query.
+func measureExecTimes(db optimizer.WhatIfOptimizer, planChanges []planChange, runs int) ([]time.Duration, error) {
+	times := make([]time.Duration, 0, len(planChanges))
+	for _, change := range planChanges {
+		if err := db.Execute(`use ` + change.SQL.SchemaName); err != nil {
+			return nil, err
+		}
+		var execTimes []time.Duration
+		for k := 0; k < runs; k++ {
+			p, err := db.ExplainAnalyze(change.SQL.Text)
+			if err != nil {
+				return nil, fmt.Errorf("fail to execute %v: %v", change.SQL.Alias, err)
+			}
+			execTimes = append(execTimes, p.ExecTime())
+		}
+		sort.Slice(execTimes, func(i, j int) bool { return execTimes[i] < execTimes[j] })
+		times = append(times, execTimes[len(execTimes)/2])
+	}
+	return times, nil
+}
+
+// totals returns the weighted estimated costs and measured execution times of the workload.
+func (v *adviseValidation) totals() (oriCost, optCost float64, oriTime, optTime time.Duration) {
+	for _, q := range v.Queries {
+		w := q.Query.WeightedFrequency()
+		oriCost += q.OriCost * w
+		optCost += q.OptCost * w
+		oriTime += time.Duration(float64(q.OriTime) * w)
+		optTime += time.Duration(float64(q.OptTime) * w)
+	}
+	return
+}
+
+// format formats the validation result, queries that run slower after creating indexes are marked with '!'.
+func (v *adviseValidation) format() string {
+	var buf bytes.Buffer
+	tables := make([]string, 0, len(v.Rows))
+	for t := range v.Rows {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	buf.WriteString("Synthetic rows of tables:\n")
+	for _, t := range tables {
+		fmt.Fprintf(&buf, "  %v: %v\n", t, v.Rows[t])
+	}
+	fmt.Fprintf(&buf, "%-12v %22v %22v %14v %14v\n", "Alias", "Estimated Cost", "Measured Time", "Estimated", "Measured")
+	for _, q := range v.Queries {
+		mark := ""
+		if q.OptTime > q.OriTime {
+			mark = "!"
+		}
+		fmt.Fprintf(&buf, "%-12v %10.2E->%-10.2E %10v->%-10v %14v %14v%v\n", q.Query.Alias, q.OriCost, q.OptCost,
+			q.OriTime.Round(time.Microsecond), q.OptTime.Round(time.Microsecond),
+			formatCostRatio(q.OriCost, q.OptCost), formatCostRatio(float64(q.OriTime), float64(q.OptTime)), mark)
+	}
+	oriCost, optCost, oriTime, optTime := v.totals()
+	fmt.Fprintf(&buf, "Total estimated workload cost: %.2E->%.2E (%v)\n", oriCost, optCost, formatCostRatio(oriCost, optCost))
+	fmt.Fprintf(&buf, "Total measured workload time: %v->%v (%v)\n", oriTime.Round(time.Microsecond), optTime.Round(time.Microsecond),
+		formatCostRatio(float64(oriTime), float64(optTime)))
+	return buf.String()
+}
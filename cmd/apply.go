@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type applyCmdOpt struct {
+	dsn          string
+	ddlPath      string
+	queryPath    string
+	rollbackPath string
+	logLevel     string
+
+	execute          bool
+	invisibleFirst   bool
+	window           string
+	waitWindow       bool
+	maxConcurrentDDL int
+	maxTableRows     int64
+	pollInterval     time.Duration
+}
+
+func NewApplyCmd() *cobra.Command {
+	var opt applyCmdOpt
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "create recommended indexes on your cluster safely, use `index_advisor apply --help` to see more details",
+		Long: `create recommended indexes on your cluster safely.
+How it work:
+1. load indexes from '--ddl-path', which is a DDL file containing 'CREATE INDEX' statements or an output directory containing 'ddl.sql'
+2. check existing indexes and table sizes: indexes whose name already exists or which are covered by existing indexes are skipped,
+   and indexes on tables with more than '--max-table-rows' rows are skipped
+3. print the plan, nothing is changed unless '--execute' is specified
+4. create indexes one at a time, before each one wait until the current time is in '--maintenance-window' and there are
+   less than '--max-concurrent-ddl' running DDL jobs in the cluster
+5. with '--invisible-first', each index is created as INVISIBLE, and only made VISIBLE after some query in '--query-path' uses it
+6. 'DROP INDEX' statements of created indexes are appended into '--rollback-file' after each creation
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			window, err := parseMaintenanceWindow(opt.window)
+			if err != nil {
+				return err
+			}
+			ddlPath := opt.ddlPath
+			if info, err := os.Stat(ddlPath); err != nil {
+				return err
+			} else if info.IsDir() {
+				ddlPath = path.Join(ddlPath, "ddl.sql")
+			}
+			indexes, err := loadIndexesFromFile(ddlPath)
+			if err != nil {
+				return err
+			}
+			if opt.invisibleFirst && opt.queryPath == "" {
+				return fmt.Errorf("'--invisible-first' requires '--query-path' to verify invisible indexes")
+			}
+			var queries utils.Set[utils.Query]
+			if opt.invisibleFirst {
+				_, dbName := utils.GetDBNameFromDSN(opt.dsn)
+				if queries, err = utils.LoadQueries(dbName, opt.queryPath); err != nil {
+					return err
+				}
+			}
+
+			db, err := optimizer.NewTiDBWhatIfOptimizer(opt.dsn)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			steps, err := planApply(db, indexes, opt.maxTableRows)
+			if err != nil {
+				return err
+			}
+			fmt.Println(formatApplyPlan(steps, opt.invisibleFirst))
+			if !opt.execute {
+				fmt.Println("Dry run, use '--execute' to apply the plan above.")
+				return nil
+			}
+			return runApply(db, steps, queries, window, opt)
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.dsn, "dsn", "root:@tcp(127.0.0.1:4000)/test", "dsn")
+	cmd.Flags().StringVar(&opt.ddlPath, "ddl-path", "", "the DDL file containing 'CREATE INDEX' statements, or the output directory of the advisor containing 'ddl.sql'")
+	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "queries used to verify invisible indexes, e.g. './examples/tpch_example1/queries'")
+	cmd.Flags().StringVar(&opt.rollbackPath, "rollback-file", "rollback.sql", "the file to append 'DROP INDEX' statements of created indexes into, statements of previous runs are kept")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	cmd.Flags().BoolVar(&opt.execute, "execute", false, "execute the plan, otherwise only print it")
+	cmd.Flags().BoolVar(&opt.invisibleFirst, "invisible-first", false, "create indexes as INVISIBLE first, and make them VISIBLE after verifying queries in '--query-path' use them")
+	cmd.Flags().StringVar(&opt.window, "maintenance-window", "", "only start creating indexes in this daily window of the local time, e.g. '01:00-05:00', empty means no limitation")
+	cmd.Flags().BoolVar(&opt.waitWindow, "wait-window", true, "wait for the next maintenance window when out of it, otherwise stop")
+	cmd.Flags().IntVar(&opt.maxConcurrentDDL, "max-concurrent-ddl", 1, "only start creating an index when there are less running DDL jobs than this in the cluster, 0 means no limitation")
+	cmd.Flags().Int64Var(&opt.maxTableRows, "max-table-rows", 0, "skip indexes on tables with more rows than this, 0 means no limitation")
+	cmd.Flags().DurationVar(&opt.pollInterval, "poll-interval", 10*time.Second, "the interval to check running DDL jobs")
+	cmd.MarkFlagRequired("ddl-path")
+	return cmd
+}
+
+// applyStep is the plan to create an index.
+type applyStep struct {
+	Index     utils.Index
+	TableRows int64
+	TableSize int64  // bytes of data and indexes of the table
+	Skip      string // the reason to skip this index, empty if it will be created
+}
+
+// planApply checks existing indexes and table sizes, and returns the steps to create these indexes.
+func planApply(db optimizer.WhatIfOptimizer, indexes utils.Set[utils.Index], maxTableRows int64) ([]applyStep, error) {
+	indexList := indexes.ToList()
+	sort.Slice(indexList, func(i, j int) bool { return indexList[i].Key() < indexList[j].Key() })
+	var steps []applyStep
+	for _, idx := range indexList {
+		schema, err := getTableSchema(db, idx.SchemaName, idx.TableName)
+		if err != nil {
+			return nil, err
+		}
+		step := applyStep{Index: idx, Skip: checkExistingIndexes(idx, schema)}
+		r, err := db.Query(tableSizeSQL(idx.SchemaName, idx.TableName))
+		if err != nil {
+			return nil, err
+		}
+		if r.Next() {
+			err = r.Scan(&step.TableRows, &step.TableSize)
+		}
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if step.Skip == "" && maxTableRows > 0 && step.TableRows > maxTableRows {
+			step.Skip = fmt.Sprintf("the table has %v rows, more than %v", step.TableRows, maxTableRows)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// tableSizeSQL returns the query to get the number of rows and bytes of data and indexes of the table.
+func tableSizeSQL(schemaName, tableName string) string {
+	return fmt.Sprintf(`select ifnull(table_rows, 0), ifnull(data_length, 0) + ifnull(index_length, 0) from information_schema.tables
+		where table_schema = %v and table_name = %v`, utils.QuoteSQLString(schemaName), utils.QuoteSQLString(tableName))
+}
+
+// checkExistingIndexes returns the reason to skip the index if it conflicts with or is covered by an existing index.
+func checkExistingIndexes(idx utils.Index, table utils.TableSchema) string {
+	for _, existing := range table.Indexes {
+		if strings.EqualFold(existing.IndexName, idx.IndexName) {
+			return fmt.Sprintf("index name %v already exists", existing.IndexName)
+		}
+	}
+	for _, existing := range table.Indexes {
+		if existing.PrefixContain(idx) {
+			return fmt.Sprintf("covered by the existing index %v", existing.IndexName)
+		}
+	}
+	return ""
+}
+
+// formatApplyPlan formats the plan to create indexes.
+func formatApplyPlan(steps []applyStep, invisibleFirst bool) string {
+	var buf bytes.Buffer
+	buf.WriteString("Apply plan:\n")
+	n := 0
+	for _, step := range steps {
+		if step.Skip != "" {
+			fmt.Fprintf(&buf, "  SKIP %v; -- %v\n", step.Index.DDL(), step.Skip)
+			continue
+		}
+		n++
+		fmt.Fprintf(&buf, "  %v. %v; -- table rows: %v, table size: %.2fMB\n", n, createIndexDDL(step.Index, invisibleFirst),
+			step.TableRows, float64(step.TableSize)/(1<<20))
+		if invisibleFirst {
+			fmt.Fprintf(&buf, "     %v; -- after verifying some query uses it\n", alterIndexVisibilityDDL(step.Index, true))
+		}
+	}
+	fmt.Fprintf(&buf, "Total indexes to create: %v, skipped: %v\n", n, len(steps)-n)
+	return buf.String()
+}
+
+func createIndexDDL(idx utils.Index, invisible bool) string {
+	if invisible {
+		return idx.DDL() + " INVISIBLE"
+	}
+	return idx.DDL()
+}
+
+func alterIndexVisibilityDDL(idx utils.Index, visible bool) string {
+	visibility := "INVISIBLE"
+	if visible {
+		visibility = "VISIBLE"
+	}
+	return fmt.Sprintf("ALTER TABLE `%v`.`%v` ALTER INDEX `%v` %v", idx.SchemaName, idx.TableName, idx.IndexName, visibility)
+}
+
+// appendRollback appends the statement to drop the created index into the rollback script, statements of previous
+// runs are kept, so the script can still roll back all of them after a run is resumed.
+func appendRollback(fpath string, idx utils.Index) error {
+	info, err := os.Stat(fpath)
+	newFile := os.IsNotExist(err) || (err == nil && info.Size() == 0)
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if newFile {
+		buf.WriteString("-- drop indexes created by index_advisor apply\n")
+	}
+	fmt.Fprintf(&buf, "DROP INDEX `%v` ON `%v`.`%v`;\n", idx.IndexName, idx.SchemaName, idx.TableName)
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+// runApply creates indexes one at a time according to the plan.
+func runApply(db optimizer.WhatIfOptimizer, steps []applyStep, queries utils.Set[utils.Query], window *maintenanceWindow, opt applyCmdOpt) error {
+	var created, invisible []utils.Index
+	defer func() {
+		fmt.Printf("Created indexes: %v, kept invisible: %v, rollback script: %v\n", len(created), len(invisible), opt.rollbackPath)
+		for _, idx := range invisible {
+			fmt.Printf("  %v is kept invisible since no query uses it\n", idx.IndexName)
+		}
+	}()
+	for _, step := range steps {
+		if step.Skip != "" {
+			continue
+		}
+		if window != nil && !window.contains(time.Now()) {
+			if !opt.waitWindow {
+				utils.Warningf("out of the maintenance window %v, stop applying", opt.window)
+				return nil
+			}
+			wait := window.untilOpen(time.Now())
+			utils.Infof("out of the maintenance window %v, wait %v", opt.window, wait.Round(time.Second))
+			time.Sleep(wait)
+		}
+		if err := waitForDDLJobs(db, opt.maxConcurrentDDL, opt.pollInterval); err != nil {
+			return err
+		}
+
+		ddl := createIndexDDL(step.Index, opt.invisibleFirst)
+		utils.Infof("execute: %v", ddl)
+		if err := db.Execute(ddl); err != nil {
+			return fmt.Errorf("fail to create the index %v: %v", step.Index.IndexName, err)
+		}
+		created = append(created, step.Index)
+		if err := appendRollback(opt.rollbackPath, step.Index); err != nil {
+			return err
+		}
+		if !opt.invisibleFirst {
+			continue
+		}
+
+		used, err := invisibleIndexUsedBy(db, step.Index, queries)
+		if err != nil {
+			return err
+		}
+		if len(used) == 0 {
+			utils.Warningf("no query uses the invisible index %v, keep it invisible", step.Index.IndexName)
+			invisible = append(invisible, step.Index)
+			continue
+		}
+		utils.Infof("the invisible index %v is used by %v", step.Index.IndexName, strings.Join(used, ", "))
+		ddl = alterIndexVisibilityDDL(step.Index, true)
+		utils.Infof("execute: %v", ddl)
+		if err := db.Execute(ddl); err != nil {
+			return fmt.Errorf("fail to make the index %v visible: %v", step.Index.IndexName, err)
+		}
+	}
+	return nil
+}
+
+// waitForDDLJobs waits until there are less than limit running DDL jobs in the cluster.
+func waitForDDLJobs(db optimizer.WhatIfOptimizer, limit int, pollInterval time.Duration) error {
+	if limit <= 0 {
+		return nil
+	}
+	for {
+		running, err := queryInt64(db, `select count(*) from information_schema.ddl_jobs
+			where state in ('none', 'queueing', 'running', 'rollingback', 'cancelling')`)
+		if err != nil {
+			return err
+		}
+		if running < int64(limit) {
+			return nil
+		}
+		utils.Infof("%v running DDL jobs, wait %v", running, pollInterval)
+		time.Sleep(pollInterval)
+	}
+}
+
+// invisibleIndexUsedBy returns aliases of queries on the index's table whose plans use the invisible index.
+func invisibleIndexUsedBy(db optimizer.WhatIfOptimizer, idx utils.Index, queries utils.Set[utils.Query]) ([]string, error) {
+	if err := db.Execute(`set @@session.tidb_opt_use_invisible_indexes = on`); err != nil {
+		return nil, fmt.Errorf("fail to enable 'tidb_opt_use_invisible_indexes', which is required by '--invisible-first': %v", err)
+	}
+	defer func() {
+		if err := db.Execute(`set @@session.tidb_opt_use_invisible_indexes = off`); err != nil {
+			utils.Warningf("fail to disable 'tidb_opt_use_invisible_indexes': %v", err)
+		}
+	}()
+	var used []string
+	for _, q := range queries.ToList() {
+		tables, err := utils.CollectTableNamesFromSQL(q.SchemaName, q.Text)
+		if err != nil {
+			return nil, err
+		}
+		if !tables.Contains(utils.TableName{SchemaName: idx.SchemaName, TableName: idx.TableName}) {
+			continue
+		}
+		if err := db.Execute(`use ` + q.SchemaName); err != nil {
+			return nil, err
+		}
+		p, err := db.Explain(q.Text)
+		if err != nil {
+			return nil, err
+		}
+		if planUsesIndex(p, idx.IndexName) {
+			used = append(used, q.Alias)
+		}
+	}
+	sort.Strings(used)
+	return used, nil
+}
+
+// planUsesIndex returns whether the plan accesses the index, whose access object is like `table:t, index:idx_a(a)`.
+func planUsesIndex(p utils.Plan, indexName string) bool {
+	target := "index:" + strings.ToLower(indexName) + "("
+	for _, row := range p {
+		obj := row[4] // | id | estRows | estCost | task | access object | operator info |
+		if p.IsExecuted() {
+			obj = row[5]
+		}
+		if strings.Contains(strings.ToLower(obj), target) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceWindow is a daily time window, which may cross midnight, e.g. 22:00-02:00.
+type maintenanceWindow struct {
+	start, end time.Duration // offsets since midnight
+}
+
+// parseMaintenanceWindow parses windows like '01:00-05:00', nil is returned for an empty string.
+func parseMaintenanceWindow(s string) (*maintenanceWindow, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid maintenance window %v, should be like '01:00-05:00'", s)
+	}
+	var offsets [2]time.Duration
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %v: %v", s, err)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if offsets[0] == offsets[1] {
+		return nil, fmt.Errorf("invalid maintenance window %v, the start and end are the same", s)
+	}
+	return &maintenanceWindow{start: offsets[0], end: offsets[1]}, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// contains returns whether t is in the window.
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// untilOpen returns the duration from t to the next start of the window, 0 if t is in the window.
+func (w *maintenanceWindow) untilOpen(t time.Time) time.Duration {
+	if w.contains(t) {
+		return 0
+	}
+	d := w.start - sinceMidnight(t)
+	if d < 0 {
+		d += 24 * time.Hour
+	}
+	return d
+}
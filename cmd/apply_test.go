@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qw4990/index_advisor/utils"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2023, 5, 1, hour, minute, 0, 0, time.Local) }
+
+	w, err := parseMaintenanceWindow("01:00-05:30")
+	must(err)
+	mustTrue(w.contains(at(1, 0)) && w.contains(at(5, 29)), w)
+	mustTrue(!w.contains(at(5, 30)) && !w.contains(at(0, 59)), w)
+	mustTrue(w.untilOpen(at(3, 0)) == 0)
+	mustTrue(w.untilOpen(at(0, 30)) == 30*time.Minute, w.untilOpen(at(0, 30)))
+	mustTrue(w.untilOpen(at(6, 0)) == 19*time.Hour, w.untilOpen(at(6, 0)))
+
+	w, err = parseMaintenanceWindow("22:00-02:00") // cross midnight
+	must(err)
+	mustTrue(w.contains(at(23, 0)) && w.contains(at(1, 59)) && !w.contains(at(2, 0)) && !w.contains(at(12, 0)), w)
+	mustTrue(w.untilOpen(at(12, 0)) == 10*time.Hour, w.untilOpen(at(12, 0)))
+
+	w, err = parseMaintenanceWindow("")
+	mustTrue(w == nil && err == nil)
+	for _, s := range []string{"01:00", "1-5", "01:00-01:00", "25:00-02:00"} {
+		_, err = parseMaintenanceWindow(s)
+		mustTrue(err != nil, s)
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	table, err := utils.ParseCreateTableStmt("test", "create table t (a int, b int, c int, key idx_ab(a, b))")
+	must(err)
+	mustTrue(checkExistingIndexes(utils.NewIndex("test", "t", "idx_a", "a"), table) == "covered by the existing index idx_ab")
+	mustTrue(checkExistingIndexes(utils.NewIndex("test", "t", "IDX_AB", "c"), table) == "index name idx_ab already exists")
+	mustTrue(checkExistingIndexes(utils.NewIndex("test", "t", "idx_abc", "a", "b", "c"), table) == "")
+
+	steps := []applyStep{
+		{Index: utils.NewIndex("test", "t", "idx_abc", "a", "b", "c"), TableRows: 1000, TableSize: 1 << 20},
+		{Index: utils.NewIndex("test", "t", "idx_a", "a"), Skip: "covered by the existing index idx_ab"},
+	}
+	plan := formatApplyPlan(steps, true)
+	mustTrue(strings.Contains(plan, "1. CREATE INDEX idx_abc ON test.t (a, b, c) INVISIBLE; -- table rows: 1000, table size: 1.00MB"), plan)
+	mustTrue(strings.Contains(plan, "ALTER TABLE `test`.`t` ALTER INDEX `idx_abc` VISIBLE"), plan)
+	mustTrue(strings.Contains(plan, "SKIP CREATE INDEX idx_a ON test.t (a); -- covered by the existing index idx_ab"), plan)
+	mustTrue(strings.Contains(plan, "Total indexes to create: 1, skipped: 1"), plan)
+	mustTrue(!strings.Contains(formatApplyPlan(steps, false), "INVISIBLE"))
+
+	// a resumed run appends into the rollback script of the previous run
+	rollbackPath := path.Join(t.TempDir(), "rollback.sql")
+	must(appendRollback(rollbackPath, steps[0].Index))
+	must(appendRollback(rollbackPath, utils.NewIndex("test", "t2", "idx_b", "b")))
+	data, err := os.ReadFile(rollbackPath)
+	must(err)
+	mustTrue(string(data) == "-- drop indexes created by index_advisor apply\n"+
+		"DROP INDEX `idx_abc` ON `test`.`t`;\nDROP INDEX `idx_b` ON `test`.`t2`;\n", string(data))
+
+	q := tableSizeSQL("test", "it's")
+	_, err = utils.ParseOneSQL(q)
+	must(err)
+	mustTrue(strings.Contains(q, "table_schema = 'test' and table_name = 'it''s'"), q)
+
+	p := utils.Plan{
+		{"IndexLookUp_10", "10.00", "100.00", "root", "", ""},
+		{"├─IndexRangeScan_8(Build)", "10.00", "50.00", "cop[tikv]", "table:t, index:idx_abc(a, b, c)", "range:[1,1]"},
+		{"└─TableRowIDScan_9(Probe)", "10.00", "50.00", "cop[tikv]", "table:t", "keep order:false"},
+	}
+	mustTrue(planUsesIndex(p, "IDX_ABC") && !planUsesIndex(p, "idx_ab"))
+}
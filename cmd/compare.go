@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type compareCmdOpt struct {
+	whatIfCmdOpt
+
+	indexFiles    []string
+	regressionThr float64
+	output        string
+}
+
+func NewCompareCmd() *cobra.Command {
+	var opt compareCmdOpt
+	cmd := &cobra.Command{
+		Use:   "compare",
+		Short: "compare the estimated cost of the workload under different index configurations, use `index_advisor compare --help` to see more details",
+		Long: `compare the estimated cost of the workload under different index configurations.
+How it work:
+1. connect to your TiDB cluster through the DSN, or start a local TiDB server and load the schema and statistics like 'advise-offline' if '--dsn' is not specified
+2. load the workload and all index configurations, each configuration is a DDL file containing 'CREATE INDEX' statements
+3. create indexes of each configuration as hypothetical indexes and estimate the cost of each query, no index is created physically
+4. report the cost of each query and the whole workload under each configuration side by side,
+   queries whose cost increases compared with the current indexes are marked as regressions
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			opt.indexFiles = append(opt.indexFiles, args...)
+			if len(opt.indexFiles) < 2 {
+				return fmt.Errorf("at least two index configurations are required, but got %v", len(opt.indexFiles))
+			}
+			db, defaultSchema, cleanup, err := openWhatIfOptimizer(&opt.whatIfCmdOpt)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			if opt.queryPath == "" {
+				return fmt.Errorf("query-path is not specified")
+			}
+			workload, err := loadWhatIfWorkload(db, defaultSchema, opt.queryPath)
+			if err != nil {
+				return err
+			}
+
+			var configs []indexConf
+			for _, f := range opt.indexFiles {
+				indexes, err := loadIndexesFromFile(f)
+				if err != nil {
+					return err
+				}
+				configs = append(configs, indexConf{Name: strings.TrimSuffix(path.Base(f), path.Ext(f)), Indexes: indexes.ToList()})
+			}
+			result, err := compareIndexConfs(db, *workload, configs)
+			if err != nil {
+				return err
+			}
+			content := result.format(opt.regressionThr)
+			fmt.Fprint(cmd.OutOrStdout(), content)
+			if opt.output != "" {
+				if err := utils.PrepareDir(opt.output); err != nil {
+					return err
+				}
+				if err := utils.SaveContentTo(path.Join(opt.output, "compare.txt"), content); err != nil {
+					return err
+				}
+				return utils.SaveContentTo(path.Join(opt.output, "compare.csv"), result.csv(opt.regressionThr))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opt.indexFiles, "index-files", nil, "DDL files of index configurations to compare, e.g. 'conf1.sql,conf2.sql', they can also be passed as arguments")
+	cmd.Flags().Float64Var(&opt.regressionThr, "regression-threshold", 0.05, "a query regresses under a configuration if its cost increases more than this ratio compared with the current indexes")
+	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result ('compare.txt' and 'compare.csv')")
+	cmd.Flags().StringVar(&opt.dsn, "dsn", "", "the DSN of the TiDB cluster to connect, e.g. 'root:@tcp(127.0.0.1:4000)/test', a local TiDB server is started if it's empty")
+	cmd.Flags().StringVar(&opt.tidbVersion, "tidb-version", "nightly", "the version of the local TiDB server")
+	cmd.Flags().StringVar(&opt.schemaPath, "schema-path", "", "(optional) schema file path loaded into the local TiDB server, e.g. './examples/tpch_example1/schema.sql'")
+	cmd.Flags().StringVar(&opt.statsPath, "stats-path", "", "(optional) stats dictionary path loaded into the local TiDB server, e.g. './examples/tpch_example1/stats'")
+	cmd.Flags().StringVar(&opt.dirPath, "dir-path", "", "(optional) the dictionary path that contains queries, schema and stats, or a workload bundle exported by 'workload-export'")
+	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "the workload to compare on, e.g. './examples/tpch_example1/queries', it can be omitted if '--dir-path' is specified")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	return cmd
+}
+
+// indexConf is an index configuration to compare.
+type indexConf struct {
+	Name    string
+	Indexes []utils.Index
+}
+
+// indexConfComparison is the estimated cost of each query under the current indexes and each index configuration.
+type indexConfComparison struct {
+	Queries  []utils.Query
+	Confs    []string
+	Original []float64   // the cost of each query under the current indexes
+	Costs    [][]float64 // Costs[i][j] is the cost of the j-th query under the i-th configuration
+}
+
+// compareIndexConfs estimates the cost of each query under each index configuration with hypothetical indexes.
+func compareIndexConfs(db optimizer.WhatIfOptimizer, workload utils.WorkloadInfo, confs []indexConf) (*indexConfComparison, error) {
+	queries := workload.Queries.ToList()
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Alias < queries[j].Alias })
+	workload.Queries = utils.ListToSet(queries...)
+	result := &indexConfComparison{Queries: queries}
+	for _, conf := range confs {
+		utils.Infof("estimate the workload cost with %v indexes in %v", len(conf.Indexes), conf.Name)
+		planChanges, err := getPlanChanges(db, workload, conf.Indexes)
+		if err != nil {
+			return nil, fmt.Errorf("fail to evaluate %v: %v", conf.Name, err)
+		}
+		oriCosts := make(map[string]float64, len(planChanges))
+		optCosts := make(map[string]float64, len(planChanges))
+		for _, change := range planChanges {
+			oriCosts[change.SQL.Key()] = change.OriPlan.PlanCost()
+			optCosts[change.SQL.Key()] = change.OptPlan.PlanCost()
+		}
+		costs := make([]float64, len(queries))
+		for j, q := range queries {
+			costs[j] = optCosts[q.Key()]
+		}
+		if result.Original == nil {
+			result.Original = make([]float64, len(queries))
+			for j, q := range queries {
+				result.Original[j] = oriCosts[q.Key()]
+			}
+		}
+		result.Confs = append(result.Confs, conf.Name)
+		result.Costs = append(result.Costs, costs)
+	}
+	return result, nil
+}
+
+// totalCost returns the weighted workload cost of the costs of queries.
+func (c *indexConfComparison) totalCost(costs []float64) float64 {
+	var total float64
+	for j, q := range c.Queries {
+		total += costs[j] * q.WeightedFrequency()
+	}
+	return total
+}
+
+// regressed returns whether the j-th query regresses under the i-th configuration.
+func (c *indexConfComparison) regressed(i, j int, regressionThr float64) bool {
+	return c.Costs[i][j] > c.Original[j]*(1+regressionThr)
+}
+
+// format formats the comparison as a table, regressed queries are marked with '!'.
+func (c *indexConfComparison) format(regressionThr float64) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%-12v %14v", "Alias", "Current")
+	for _, name := range c.Confs {
+		fmt.Fprintf(&buf, " %14v", name)
+	}
+	buf.WriteString("\n")
+	regressions := make([][]string, len(c.Confs))
+	for j, q := range c.Queries {
+		fmt.Fprintf(&buf, "%-12v %14.2E", q.Alias, c.Original[j])
+		for i := range c.Confs {
+			mark := " "
+			if c.regressed(i, j, regressionThr) {
+				mark = "!"
+				regressions[i] = append(regressions[i], q.Alias)
+			}
+			fmt.Fprintf(&buf, " %13.2E%v", c.Costs[i][j], mark)
+		}
+		buf.WriteString("\n")
+	}
+	original := c.totalCost(c.Original)
+	fmt.Fprintf(&buf, "%-12v %14.2E", "Weighted", original)
+	for i := range c.Confs {
+		fmt.Fprintf(&buf, " %14.2E", c.totalCost(c.Costs[i]))
+	}
+	buf.WriteString("\n\n")
+	for i, name := range c.Confs {
+		total := c.totalCost(c.Costs[i])
+		fmt.Fprintf(&buf, "%v: total weighted cost %.2E (%v compared with the current indexes)", name, total, formatCostRatio(original, total))
+		if len(regressions[i]) > 0 {
+			fmt.Fprintf(&buf, ", %v queries regress: %v", len(regressions[i]), strings.Join(regressions[i], ", "))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// csv formats the comparison as CSV.
+func (c *indexConfComparison) csv(regressionThr float64) string {
+	header := []string{"alias", "frequency", "current"}
+	for _, name := range c.Confs {
+		header = append(header, name, name+"_regressed")
+	}
+	records := [][]string{header}
+	for j, q := range c.Queries {
+		record := []string{q.Alias, strconv.Itoa(q.Frequency), strconv.FormatFloat(c.Original[j], 'f', -1, 64)}
+		for i := range c.Confs {
+			record = append(record, strconv.FormatFloat(c.Costs[i][j], 'f', -1, 64), strconv.FormatBool(c.regressed(i, j, regressionThr)))
+		}
+		records = append(records, record)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(records)
+	return buf.String()
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qw4990/index_advisor/utils"
+)
+
+func TestIndexConfComparison(t *testing.T) {
+	c := &indexConfComparison{
+		Queries:  []utils.Query{{Alias: "q1", Frequency: 1}, {Alias: "q2", Frequency: 10}},
+		Confs:    []string{"conf1", "conf2"},
+		Original: []float64{100, 10},
+		Costs:    [][]float64{{50, 10.4}, {20, 20}},
+	}
+	mustTrue(c.totalCost(c.Original) == 200, c.totalCost(c.Original))
+	mustTrue(c.totalCost(c.Costs[1]) == 220, c.totalCost(c.Costs[1]))
+	mustTrue(!c.regressed(0, 1, 0.05), "q2 under conf1 should not regress")
+	mustTrue(c.regressed(1, 1, 0.05), "q2 under conf2 should regress")
+
+	content := c.format(0.05)
+	for _, expected := range []string{
+		"conf1: total weighted cost 1.54E+02 (-23.00% compared with the current indexes)\n",
+		"conf2: total weighted cost 2.20E+02 (+10.00% compared with the current indexes), 1 queries regress: q2\n",
+		"2.00E+01!",
+	} {
+		mustTrue(strings.Contains(content, expected), expected, content)
+	}
+	mustTrue(strings.Contains(c.csv(0.05), "q2,10,10,10.4,false,20,true\n"), c.csv(0.05))
+}
@@ -0,0 +1,984 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type datagenCmdOpt struct {
+	schemaPath string
+	statsPath  string
+	dirPath    string
+
+	output     string
+	dsn        string
+	loadSchema bool
+	loadStats  bool
+
+	maxRows   int64
+	batchSize int
+	seed      int64
+	logLevel  string
+}
+
+func NewDatagenCmd() *cobra.Command {
+	var opt datagenCmdOpt
+	cmd := &cobra.Command{
+		Use:   "datagen",
+		Short: "generate synthetic data from the schema and statistics, use `index_advisor datagen --help` to see more details",
+		Long: `generate synthetic data from the schema and statistics, which can reproduce production plans locally without copying data.
+How it work:
+1. read the schema file and stats files, which are in the same format as 'advise-offline'
+2. generate rows of each table reproducing the distribution of each column (null count, NDV, histogram buckets and TopN values),
+   columns of composite indexes are generated jointly from the statistics of the index to keep the correlation between them,
+   and columns of primary and unique keys are generated without duplicates
+3. write rows into CSV files (named '{db}.{table}.csv') or insert them into a TiDB cluster through the DSN,
+   statistics are loaded into the cluster after inserting so that the optimizer sees the production statistics
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			if opt.output == "" && opt.dsn == "" {
+				return fmt.Errorf("either output or dsn should be specified")
+			}
+			if opt.dirPath != "" {
+				dir, cleanup, err := openWorkloadDir(opt.dirPath)
+				if err != nil {
+					return err
+				}
+				defer cleanup()
+				opt.schemaPath = path.Join(dir, "schema.sql")
+				manifest, err := utils.LoadWorkloadManifest(dir)
+				if err != nil {
+					return err
+				}
+				if manifest != nil {
+					opt.schemaPath = path.Join(dir, manifest.SchemaFile)
+				}
+				opt.statsPath = path.Join(dir, "stats")
+			}
+			if opt.schemaPath == "" || opt.statsPath == "" {
+				return fmt.Errorf("schema-path and stats-path should be specified")
+			}
+			return runDatagen(opt)
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.schemaPath, "schema-path", "", "schema file path, e.g. './examples/tpch_example1/schema.sql'")
+	cmd.Flags().StringVar(&opt.statsPath, "stats-path", "", "stats dictionary path, e.g. './examples/tpch_example1/stats'")
+	cmd.Flags().StringVar(&opt.dirPath, "dir-path", "", "(optional) the dictionary path that contains schema and stats, or a workload bundle exported by 'workload-export'")
+	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to write CSV files, one file for each table")
+	cmd.Flags().StringVar(&opt.dsn, "dsn", "", "the DSN of the TiDB cluster to insert rows into, e.g. 'root:@tcp(127.0.0.1:4000)/test'")
+	cmd.Flags().BoolVar(&opt.loadSchema, "load-schema", true, "load the schema into the cluster before inserting rows, disable it if tables already exist")
+	cmd.Flags().BoolVar(&opt.loadStats, "load-stats", true, "load the statistics into the cluster after inserting rows")
+	cmd.Flags().Int64Var(&opt.maxRows, "max-rows", 0, "the max number of rows generated for each table, 0 means the same as the statistics")
+	cmd.Flags().IntVar(&opt.batchSize, "batch-size", 256, "the number of rows in each INSERT statement")
+	cmd.Flags().Int64Var(&opt.seed, "seed", 1, "the random seed, the same seed generates the same data")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	return cmd
+}
+
+func runDatagen(opt datagenCmdOpt) error {
+	tables, err := utils.LoadTableSchemasFromFile(opt.schemaPath)
+	if err != nil {
+		return err
+	}
+	tableStats, err := loadStatsDumpFiles(opt.statsPath)
+	if err != nil {
+		return err
+	}
+
+	var db optimizer.WhatIfOptimizer
+	if opt.dsn != "" {
+		if db, err = optimizer.NewTiDBWhatIfOptimizer(opt.dsn); err != nil {
+			return err
+		}
+		defer db.Close()
+		if opt.loadSchema {
+			if _, _, err := loadSchemaIntoCluster(db, opt.schemaPath); err != nil {
+				return err
+			}
+		}
+	}
+	if opt.output != "" {
+		if err := utils.PrepareDir(opt.output); err != nil {
+			return err
+		}
+	}
+
+	tableList := tables.ToList()
+	sort.Slice(tableList, func(i, j int) bool { return tableList[i].Key() < tableList[j].Key() })
+	for _, table := range tableList {
+		stats, ok := tableStats[strings.ToLower(table.Key())]
+		if !ok {
+			utils.Warningf("no statistics of %v, skip generating data for it", table.Key())
+			continue
+		}
+		g, err := newStatsDataGenerator(table, stats, opt.maxRows, opt.seed)
+		if err != nil {
+			return fmt.Errorf("fail to generate data for %v: %v", table.Key(), err)
+		}
+		utils.Infof("generate %v rows for %v (%v rows in statistics)", g.rows, table.Key(), stats.Count)
+		if opt.output != "" {
+			fpath := path.Join(opt.output, fmt.Sprintf("%v.%v.csv", table.SchemaName, table.TableName))
+			if err := g.writeCSV(fpath, opt.batchSize); err != nil {
+				return err
+			}
+		}
+		if db != nil {
+			if err := g.generate(opt.batchSize, func(rows [][]datagenValue) error {
+				return db.Execute(g.insertStmt(rows))
+			}); err != nil {
+				return fmt.Errorf("fail to insert data into %v: %v", table.Key(), err)
+			}
+			count, err := queryInt64(db, fmt.Sprintf("select count(*) from `%v`.`%v`", table.SchemaName, table.TableName))
+			if err != nil {
+				return err
+			}
+			utils.Infof("%v rows in %v after inserting", count, table.Key())
+		}
+	}
+	if db != nil && opt.loadStats {
+		return loadStatsIntoCluster(db, opt.statsPath)
+	}
+	return nil
+}
+
+// loadStatsDumpFiles loads all stats files in the directory, keyed by lower-case `db.table`.
+func loadStatsDumpFiles(statsDirPath string) (map[string]*statsDumpTable, error) {
+	files, err := os.ReadDir(statsDirPath)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*statsDumpTable)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(path.Join(statsDirPath, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		stats := new(statsDumpTable)
+		if err := json.Unmarshal(data, stats); err != nil {
+			return nil, fmt.Errorf("invalid stats file %v: %v", f.Name(), err)
+		}
+		result[strings.ToLower(stats.DatabaseName+"."+stats.TableName)] = stats
+	}
+	return result, nil
+}
+
+// datagenValue is a generated value, Str is the raw value shown in statistics, e.g. '2023-01-01' for a date.
+type datagenValue struct {
+	Str  string
+	Null bool
+}
+
+// statsDataGenerator generates synthetic rows of a table that match its statistics:
+// the row count, null counts, histogram buckets (with their repeats) and TopN values of each column.
+// Values inside a bucket are interpolated between its bounds for numeric and time columns,
+// and derived from its bounds for string columns, so the NDV is roughly kept.
+// Columns of composite indexes are generated jointly: the leading column is generated from its own statistics,
+// and the following columns are taken from the nearest value tuple in the TopN and bucket bounds of the index.
+// Columns of single-column primary and unique keys are generated without replacement, and rows violating composite
+// unique keys are regenerated, so no row is rejected by the database.
+type statsDataGenerator struct {
+	table   utils.TableSchema
+	stats   *statsDumpTable
+	columns []utils.Column // columns to generate, generated columns are skipped
+	rows    int64
+	seed    int64
+	rand    *rand.Rand
+
+	topN   map[string][]datagenTopN // TopN values of each column
+	groups []indexTupleGroup
+
+	uniqueValues map[int][]datagenValue // distinct values of single-column unique keys in random order, keyed by column offsets
+	uniqueTuples []uniqueTupleKey       // composite unique keys
+	generated    int64                  // the number of generated rows
+	dropped      int64                  // the number of rows dropped since they violate composite unique keys
+}
+
+// uniqueTupleKey is a composite unique key, rows with duplicate tuples are regenerated.
+type uniqueTupleKey struct {
+	columns []int // offsets of key columns in the generator columns
+	seen    map[string]bool
+}
+
+type datagenTopN struct {
+	Value datagenValue
+	Count int64
+}
+
+// indexTupleGroup is a group of columns generated jointly from the statistics of a composite index.
+type indexTupleGroup struct {
+	index   string
+	columns []int            // offsets of index columns in the generator columns
+	tuples  [][]datagenValue // value tuples in the TopN and bucket bounds of the index, sorted by the leading column
+}
+
+// newStatsDataGenerator creates a generator for the table, at most maxRows rows are generated,
+// 0 means generating the same number of rows as the statistics.
+func newStatsDataGenerator(table utils.TableSchema, stats *statsDumpTable, maxRows int64, seed int64) (*statsDataGenerator, error) {
+	generated, err := generatedColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	g := &statsDataGenerator{
+		table: table,
+		stats: stats,
+		rows:  stats.Count,
+		seed:  seed,
+		rand:  rand.New(rand.NewSource(seed)),
+		topN:  make(map[string][]datagenTopN),
+	}
+	if maxRows > 0 && g.rows > maxRows {
+		g.rows = maxRows
+	}
+	for _, col := range table.Columns {
+		if !generated[col.ColumnName] {
+			g.columns = append(g.columns, col)
+		}
+	}
+	for _, col := range g.columns {
+		cs := g.columnStats(col)
+		if cs == nil || cs.CMSketch == nil {
+			continue
+		}
+		for _, t := range cs.CMSketch.TopN {
+			v, err := decodeDatagenValues([]utils.Column{col}, t.Data)
+			if err != nil || len(v) != 1 {
+				utils.Warningf("skip TopN values of %v.%v: %v", table.Key(), col.ColumnName, err)
+				delete(g.topN, col.ColumnName)
+				break
+			}
+			g.topN[col.ColumnName] = append(g.topN[col.ColumnName], datagenTopN{Value: v[0], Count: int64(t.Count)})
+		}
+	}
+	g.groups = g.indexTupleGroups()
+	g.initUniqueKeys()
+	return g, nil
+}
+
+// initUniqueKeys prepares distinct values of single-column unique keys and the states of composite unique keys.
+func (g *statsDataGenerator) initUniqueKeys() {
+	offsets := make(map[string]int, len(g.columns))
+	for i, col := range g.columns {
+		offsets[col.ColumnName] = i
+	}
+	g.uniqueValues = make(map[int][]datagenValue)
+	var composites [][]int
+	for _, idx := range g.table.Indexes {
+		if !idx.Primary && !idx.Unique {
+			continue
+		}
+		var cols []int
+		for _, col := range idx.Columns {
+			offset, ok := offsets[col.ColumnName]
+			if !ok || col.JSONPath != "" || col.Expr != "" || col.Length > 0 {
+				cols = nil // keys on generated columns, expressions or prefixes are not guaranteed
+				break
+			}
+			cols = append(cols, offset)
+		}
+		switch {
+		case len(cols) == 1:
+			if _, ok := g.uniqueValues[cols[0]]; !ok {
+				g.uniqueValues[cols[0]] = g.distinctValues(g.columns[cols[0]])
+			}
+		case len(cols) > 1:
+			composites = append(composites, cols)
+		}
+	}
+	for _, cols := range composites {
+		covered := false // a composite key containing a unique column is always unique
+		for _, offset := range cols {
+			_, ok := g.uniqueValues[offset]
+			covered = covered || ok
+		}
+		if !covered {
+			g.uniqueTuples = append(g.uniqueTuples, uniqueTupleKey{columns: cols, seen: make(map[string]bool)})
+		}
+	}
+}
+
+// distinctValues returns g.rows distinct values of the unique column in random order. Values are spread over NULLs,
+// TopN values and histogram buckets in proportion to their row counts, and values in a bucket are evenly spaced
+// between its bounds. Values that still collide are replaced with values out of the statistics.
+func (g *statsDataGenerator) distinctValues(col utils.Column) []datagenValue {
+	type segment struct {
+		count        int64
+		null         bool
+		value        *datagenValue // a TopN value
+		lower, upper string        // bounds of a bucket
+	}
+	var segments []segment
+	if cs := g.columnStats(col); cs != nil {
+		if cs.NullCount > 0 && (col.ColumnType == nil || !mysql.HasNotNullFlag(col.ColumnType.Flag)) {
+			segments = append(segments, segment{count: cs.NullCount, null: true})
+		}
+		for i := range g.topN[col.ColumnName] {
+			t := g.topN[col.ColumnName][i]
+			segments = append(segments, segment{count: t.Count, value: &t.Value})
+		}
+		if cs.Histogram != nil {
+			var prev int64
+			for _, b := range cs.Histogram.Buckets {
+				segments = append(segments, segment{count: b.Count - prev, lower: string(b.LowerBound), upper: string(b.UpperBound)})
+				prev = b.Count
+			}
+		}
+	}
+	var total int64
+	for _, seg := range segments {
+		total += seg.count
+	}
+
+	values := make([]datagenValue, 0, g.rows)
+	if total <= 0 {
+		for k := int64(0); k < g.rows; k++ {
+			values = append(values, sequenceValue(col, k))
+		}
+	}
+	var cum int64
+	for _, seg := range segments {
+		if total <= 0 {
+			break
+		}
+		// the cumulative rounding makes the numbers of values sum up to g.rows
+		begin := int64(math.Round(float64(cum) * float64(g.rows) / float64(total)))
+		cum += seg.count
+		n := int64(math.Round(float64(cum)*float64(g.rows)/float64(total))) - begin
+		switch {
+		case n <= 0:
+		case seg.null:
+			for k := int64(0); k < n; k++ {
+				values = append(values, datagenValue{Null: true})
+			}
+		case seg.value != nil:
+			for k := int64(0); k < n; k++ { // a unique value appears only once, copies are replaced by distinct values below
+				values = append(values, *seg.value)
+			}
+		default:
+			for k := int64(0); k < n; k++ {
+				values = append(values, interpolateValue(col, seg.lower, seg.upper, k, n))
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(values))
+	maxNum, nextK, unresolved := math.Inf(-1), g.rows, 0
+	for _, v := range values {
+		if f, err := strconv.ParseFloat(v.Str, 64); err == nil && !v.Null && f > maxNum {
+			maxNum = f
+		}
+	}
+	for i, v := range values {
+		if v.Null || !seen[v.Str] {
+			seen[v.Str] = true
+			continue
+		}
+		if isNumericColumn(col) && !math.IsInf(maxNum, -1) {
+			maxNum = math.Floor(maxNum) + 1
+			values[i] = datagenValue{Str: strconv.FormatFloat(maxNum, 'f', 0, 64)}
+			seen[values[i].Str] = true
+			continue
+		}
+		for attempts := 0; attempts < 1000 && seen[v.Str]; attempts++ {
+			v = sequenceValue(col, nextK)
+			nextK++
+		}
+		if seen[v.Str] {
+			unresolved++
+		}
+		values[i] = v
+		seen[v.Str] = true
+	}
+	if unresolved > 0 {
+		utils.Warningf("%v duplicate values of the unique column %v.%v can't be resolved", unresolved, g.table.Key(), col.ColumnName)
+	}
+	g.rand.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+	return values
+}
+
+// generatedColumns returns names of generated columns in the table, which can't be inserted.
+func generatedColumns(table utils.TableSchema) (map[string]bool, error) {
+	generated := make(map[string]bool)
+	if table.CreateStmtText == "" {
+		return generated, nil
+	}
+	stmt, err := utils.ParseOneSQL(table.CreateStmtText)
+	if err != nil {
+		return nil, err
+	}
+	createTable, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, fmt.Errorf("invalid create table statement %v", table.CreateStmtText)
+	}
+	for _, colDef := range createTable.Cols {
+		for _, opt := range colDef.Options {
+			if opt.Tp == ast.ColumnOptionGenerated {
+				generated[colDef.Name.Name.L] = true
+			}
+		}
+	}
+	return generated, nil
+}
+
+// indexTupleGroups returns groups of columns of composite indexes with statistics, each column belongs to at most one group.
+func (g *statsDataGenerator) indexTupleGroups() []indexTupleGroup {
+	offsets := make(map[string]int, len(g.columns))
+	for i, col := range g.columns {
+		offsets[col.ColumnName] = i
+	}
+	grouped := make(map[int]bool)
+	var groups []indexTupleGroup
+	for _, idx := range g.table.Indexes {
+		if len(idx.Columns) < 2 {
+			continue
+		}
+		var is *statsDumpColumn
+		for name, s := range g.stats.Indices {
+			if strings.EqualFold(name, idx.IndexName) {
+				is = s
+			}
+		}
+		if is == nil {
+			continue
+		}
+		group := indexTupleGroup{index: idx.IndexName}
+		var cols []utils.Column
+		for _, col := range idx.Columns {
+			offset, ok := offsets[col.ColumnName]
+			if !ok || grouped[offset] || col.JSONPath != "" || col.Expr != "" || col.Length > 0 {
+				group.columns = nil
+				break
+			}
+			group.columns = append(group.columns, offset)
+			cols = append(cols, g.columns[offset])
+		}
+		if len(group.columns) == 0 {
+			continue
+		}
+
+		var keys [][]byte
+		if is.CMSketch != nil {
+			for _, t := range is.CMSketch.TopN {
+				keys = append(keys, t.Data)
+			}
+		}
+		if is.Histogram != nil {
+			for _, b := range is.Histogram.Buckets {
+				keys = append(keys, b.LowerBound, b.UpperBound)
+			}
+		}
+		for _, key := range keys {
+			tuple, err := decodeDatagenValues(cols, key)
+			if err != nil {
+				utils.Warningf("skip the statistics of index %v.%v: %v", g.table.Key(), idx.IndexName, err)
+				group.tuples = nil
+				break
+			}
+			if len(tuple) >= 2 && !tuple[0].Null {
+				group.tuples = append(group.tuples, tuple)
+			}
+		}
+		if len(group.tuples) == 0 {
+			continue
+		}
+		lead := cols[0]
+		sort.SliceStable(group.tuples, func(i, j int) bool { return compareDatagenValues(lead, group.tuples[i][0], group.tuples[j][0]) < 0 })
+		for _, offset := range group.columns {
+			grouped[offset] = true
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// decodeDatagenValues decodes values of these columns from the key encoded in statistics, the key may contain a prefix of columns.
+func decodeDatagenValues(cols []utils.Column, key []byte) ([]datagenValue, error) {
+	var values []datagenValue
+	for i := 0; len(key) > 0 && i < len(cols); i++ {
+		var d types.Datum
+		var err error
+		key, d, err = codec.DecodeOne(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := datumToDatagenValue(cols[i], d)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func datumToDatagenValue(col utils.Column, d types.Datum) (datagenValue, error) {
+	if d.IsNull() {
+		return datagenValue{Null: true}, nil
+	}
+	if col.ColumnType != nil {
+		switch col.ColumnType.Tp {
+		case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeTimestamp:
+			if d.Kind() == types.KindUint64 { // times are encoded as packed uint64
+				var t types.Time
+				if err := t.FromPackedUint(d.GetUint64()); err != nil {
+					return datagenValue{}, err
+				}
+				t.SetType(col.ColumnType.Tp)
+				return datagenValue{Str: t.String()}, nil
+			}
+		case mysql.TypeDuration:
+			if d.Kind() == types.KindInt64 { // durations are encoded as nanoseconds
+				return datagenValue{Str: types.Duration{Duration: time.Duration(d.GetInt64())}.String()}, nil
+			}
+		}
+	}
+	s, err := d.ToString()
+	return datagenValue{Str: s}, err
+}
+
+// compareDatagenValues compares two non-null values of the column, numerically if possible.
+func compareDatagenValues(col utils.Column, a, b datagenValue) int {
+	if isNumericColumn(col) {
+		fa, err1 := strconv.ParseFloat(a.Str, 64)
+		fb, err2 := strconv.ParseFloat(b.Str, 64)
+		if err1 == nil && err2 == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a.Str, b.Str)
+}
+
+func isNumericColumn(col utils.Column) bool {
+	if col.ColumnType == nil {
+		return false
+	}
+	switch col.ColumnType.Tp {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear,
+		mysql.TypeFloat, mysql.TypeDouble, mysql.TypeNewDecimal, mysql.TypeBit:
+		return true
+	}
+	return false
+}
+
+// columnStats returns the statistics of the column, nil if there is no statistics.
+func (g *statsDataGenerator) columnStats(col utils.Column) *statsDumpColumn {
+	for name, c := range g.stats.Columns {
+		if strings.EqualFold(name, col.ColumnName) {
+			return c
+		}
+	}
+	return nil
+}
+
+// nextRow returns values of a new row, in the order of g.columns, false is returned if the row can't satisfy
+// composite unique keys after several retries.
+func (g *statsDataGenerator) nextRow() ([]datagenValue, bool) {
+	defer func() { g.generated++ }()
+	for retry := 0; retry < 10; retry++ {
+		row := g.randomRow()
+		if g.checkUniqueTuples(row) {
+			return row, true
+		}
+	}
+	g.dropped++
+	return nil, false
+}
+
+// checkUniqueTuples returns whether the row satisfies composite unique keys, and records its tuples if so.
+func (g *statsDataGenerator) checkUniqueTuples(row []datagenValue) bool {
+	keys := make([]string, len(g.uniqueTuples))
+	for i, key := range g.uniqueTuples {
+		var parts []string
+		for _, offset := range key.columns {
+			if row[offset].Null { // NULLs never violate unique keys
+				parts = nil
+				break
+			}
+			parts = append(parts, row[offset].Str)
+		}
+		if parts == nil {
+			continue
+		}
+		keys[i] = strings.Join(parts, "\x00")
+		if key.seen[keys[i]] {
+			return false
+		}
+	}
+	for i, key := range g.uniqueTuples {
+		if keys[i] != "" {
+			key.seen[keys[i]] = true
+		}
+	}
+	return true
+}
+
+// randomRow returns values of a new row without checking composite unique keys.
+func (g *statsDataGenerator) randomRow() []datagenValue {
+	row := make([]datagenValue, len(g.columns))
+	filled := make([]bool, len(g.columns))
+	for _, group := range g.groups {
+		lead := g.columns[group.columns[0]]
+		v := g.genValue(lead)
+		row[group.columns[0]], filled[group.columns[0]] = v, true
+		if v.Null {
+			continue
+		}
+		tuple := group.nearest(lead, v, g.rand)
+		for k := 1; k < len(group.columns) && k < len(tuple); k++ {
+			row[group.columns[k]], filled[group.columns[k]] = tuple[k], true
+		}
+	}
+	for i, col := range g.columns {
+		if values, ok := g.uniqueValues[i]; ok {
+			row[i] = values[g.generated]
+		} else if !filled[i] {
+			row[i] = g.genValue(col)
+		}
+	}
+	return row
+}
+
+// nearest returns a tuple whose leading value is the largest one not greater than v, ties are broken randomly.
+func (group indexTupleGroup) nearest(lead utils.Column, v datagenValue, r *rand.Rand) []datagenValue {
+	tuples := group.tuples
+	end := sort.Search(len(tuples), func(i int) bool { return compareDatagenValues(lead, tuples[i][0], v) > 0 })
+	if end == 0 { // v is less than all tuples, use the smallest ones
+		for end < len(tuples) && compareDatagenValues(lead, tuples[end][0], tuples[0][0]) == 0 {
+			end++
+		}
+	}
+	begin := end - 1
+	for begin > 0 && compareDatagenValues(lead, tuples[begin-1][0], tuples[end-1][0]) == 0 {
+		begin--
+	}
+	return tuples[begin+r.Intn(end-begin)]
+}
+
+func (g *statsDataGenerator) genValue(col utils.Column) datagenValue {
+	cs := g.columnStats(col)
+	if cs == nil {
+		return g.randomValue(col, g.stats.Count)
+	}
+	var buckets []statsDumpBucket // counts of buckets are cumulative
+	var histRows int64
+	if cs.Histogram != nil && len(cs.Histogram.Buckets) > 0 {
+		buckets = cs.Histogram.Buckets
+		histRows = buckets[len(buckets)-1].Count
+	}
+	topN := g.topN[col.ColumnName]
+	var topNRows int64
+	for _, t := range topN {
+		topNRows += t.Count
+	}
+	total := cs.NullCount + topNRows + histRows
+	if total <= 0 {
+		return g.randomValue(col, cs.ndv(g.stats.Count))
+	}
+	r := g.rand.Int63n(total)
+	if r < cs.NullCount {
+		if col.ColumnType != nil && mysql.HasNotNullFlag(col.ColumnType.Flag) {
+			return g.randomValue(col, cs.ndv(g.stats.Count))
+		}
+		return datagenValue{Null: true}
+	}
+	r -= cs.NullCount
+	for _, t := range topN {
+		if r < t.Count {
+			return t.Value
+		}
+		r -= t.Count
+	}
+	if histRows == 0 {
+		return g.randomValue(col, cs.ndv(g.stats.Count))
+	}
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].Count > r })
+	b := buckets[i]
+	lower, upper := string(b.LowerBound), string(b.UpperBound)
+	if r >= b.Count-b.Repeats || lower == upper {
+		return datagenValue{Str: upper}
+	}
+	bucketRows := b.Count
+	if i > 0 {
+		bucketRows -= buckets[i-1].Count
+	}
+	bucketNDV := b.NDV
+	if bucketNDV <= 0 {
+		bucketNDV = int64(math.Ceil(float64(cs.ndv(g.stats.Count)) * float64(bucketRows) / float64(histRows)))
+	}
+	return g.interpolate(col, lower, upper, bucketNDV)
+}
+
+// ndv returns the number of distinct values of the column, at least 1.
+func (c *statsDumpColumn) ndv(total int64) int64 {
+	if c.Histogram != nil && c.Histogram.NDV > 0 {
+		return c.Histogram.NDV
+	}
+	if total > 0 {
+		return total
+	}
+	return 1
+}
+
+// interpolate returns a value between lower and upper, the bucket has about bucketNDV distinct values.
+func (g *statsDataGenerator) interpolate(col utils.Column, lower, upper string, bucketNDV int64) datagenValue {
+	if bucketNDV < 2 {
+		bucketNDV = 2
+	}
+	return interpolateValue(col, lower, upper, g.rand.Int63n(bucketNDV), bucketNDV)
+}
+
+// interpolateValue returns the k-th of n values evenly spaced between lower and upper, different k's get different
+// values if there are enough distinct values between the bounds.
+func interpolateValue(col utils.Column, lower, upper string, k, n int64) datagenValue {
+	frac := 0.0
+	if n > 1 {
+		frac = float64(k) / float64(n-1)
+	}
+	if col.ColumnType == nil {
+		return datagenValue{Str: lower}
+	}
+	switch col.ColumnType.Tp {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear:
+		lo, err1 := strconv.ParseFloat(lower, 64)
+		up, err2 := strconv.ParseFloat(upper, 64)
+		if err1 != nil || err2 != nil {
+			break
+		}
+		return datagenValue{Str: strconv.FormatFloat(math.Round(lo+frac*(up-lo)), 'f', 0, 64)}
+	case mysql.TypeFloat, mysql.TypeDouble, mysql.TypeNewDecimal:
+		lo, err1 := strconv.ParseFloat(lower, 64)
+		up, err2 := strconv.ParseFloat(upper, 64)
+		if err1 != nil || err2 != nil {
+			break
+		}
+		decimal := col.ColumnType.Decimal
+		if decimal < 0 || decimal > 10 {
+			decimal = 6
+		}
+		return datagenValue{Str: strconv.FormatFloat(lo+frac*(up-lo), 'f', decimal, 64)}
+	case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeTimestamp:
+		lo, err1 := parseStatsTime(lower)
+		up, err2 := parseStatsTime(upper)
+		if err1 != nil || err2 != nil {
+			break
+		}
+		t := lo.Add(time.Duration(frac * float64(up.Sub(lo))))
+		if col.ColumnType.Tp == mysql.TypeDate {
+			return datagenValue{Str: t.Format("2006-01-02")}
+		}
+		return datagenValue{Str: t.Format("2006-01-02 15:04:05")}
+	case mysql.TypeVarchar, mysql.TypeString, mysql.TypeVarString, mysql.TypeBlob, mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob:
+		if k == 0 {
+			return datagenValue{Str: lower}
+		}
+		v := fmt.Sprintf("%v_%v", lower, k) // larger than lower and usually less than upper
+		if flen := col.ColumnType.Flen; flen > 0 && len(v) > flen {
+			return datagenValue{Str: upper}
+		}
+		return datagenValue{Str: v}
+	}
+	if frac < 0.5 {
+		return datagenValue{Str: lower}
+	}
+	return datagenValue{Str: upper}
+}
+
+// randomValue returns a random value of the column when there is no statistics, about ndv distinct values are generated.
+func (g *statsDataGenerator) randomValue(col utils.Column, ndv int64) datagenValue {
+	if ndv <= 0 {
+		ndv = 1000
+	}
+	return sequenceValue(col, g.rand.Int63n(ndv))
+}
+
+// sequenceValue returns the k-th value of the column, different k's usually get different values.
+func sequenceValue(col utils.Column, k int64) datagenValue {
+	if col.ColumnType == nil {
+		return datagenValue{Str: strconv.FormatInt(k, 10)}
+	}
+	switch col.ColumnType.Tp {
+	case mysql.TypeTiny:
+		return datagenValue{Str: strconv.FormatInt(k%128, 10)}
+	case mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeFloat, mysql.TypeDouble, mysql.TypeNewDecimal:
+		return datagenValue{Str: strconv.FormatInt(k, 10)}
+	case mysql.TypeYear:
+		return datagenValue{Str: strconv.FormatInt(1970+k%100, 10)}
+	case mysql.TypeDate:
+		return datagenValue{Str: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(k%10000)).Format("2006-01-02")}
+	case mysql.TypeDatetime, mysql.TypeTimestamp:
+		return datagenValue{Str: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(k) * time.Second).Format("2006-01-02 15:04:05")}
+	case mysql.TypeDuration:
+		return datagenValue{Str: time.Time{}.Add(time.Duration(k%86400) * time.Second).Format("15:04:05")}
+	case mysql.TypeJSON:
+		return datagenValue{Str: fmt.Sprintf(`{"k": %v}`, k)}
+	case mysql.TypeEnum, mysql.TypeSet:
+		if len(col.ColumnType.Elems) > 0 {
+			return datagenValue{Str: col.ColumnType.Elems[k%int64(len(col.ColumnType.Elems))]}
+		}
+	case mysql.TypeBit:
+		return datagenValue{Str: strconv.FormatInt(k%2, 10)}
+	}
+	v := fmt.Sprintf("v%v", k)
+	if flen := col.ColumnType.Flen; flen > 0 && len(v) > flen {
+		v = v[:flen]
+	}
+	return datagenValue{Str: v}
+}
+
+// sqlLiteral returns the SQL literal of the value of the column.
+func sqlLiteral(col utils.Column, v datagenValue) string {
+	if v.Null {
+		return "NULL"
+	}
+	if isNumericColumn(col) {
+		if _, err := strconv.ParseFloat(v.Str, 64); err == nil {
+			return v.Str
+		}
+	}
+	return utils.QuoteSQLString(strings.ReplaceAll(v.Str, `\`, `\\`))
+}
+
+func parseStatsTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %v", s)
+}
+
+// insertStmt returns the `INSERT IGNORE` statement of these rows, rows violating unique keys are ignored.
+func (g *statsDataGenerator) insertStmt(rows [][]datagenValue) string {
+	names := make([]string, 0, len(g.columns))
+	for _, col := range g.columns {
+		names = append(names, "`"+col.ColumnName+"`")
+	}
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		literals := make([]string, 0, len(row))
+		for i, v := range row {
+			literals = append(literals, sqlLiteral(g.columns[i], v))
+		}
+		values = append(values, "("+strings.Join(literals, ", ")+")")
+	}
+	return fmt.Sprintf("INSERT IGNORE INTO `%v`.`%v` (%v) VALUES %v", g.table.SchemaName, g.table.TableName,
+		strings.Join(names, ", "), strings.Join(values, ", "))
+}
+
+// writeCSV writes all rows into the CSV file with a header line, NULL values are written as `\N`.
+func (g *statsDataGenerator) writeCSV(fpath string, batchSize int) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	header := make([]string, 0, len(g.columns))
+	for _, col := range g.columns {
+		header = append(header, col.ColumnName)
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := g.generate(batchSize, func(rows [][]datagenValue) error {
+		for _, row := range rows {
+			record := make([]string, 0, len(row))
+			for _, v := range row {
+				if v.Null {
+					record = append(record, `\N`)
+				} else {
+					record = append(record, v.Str)
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// generate generates all rows and passes them to fn in batches, each call generates the same rows.
+func (g *statsDataGenerator) generate(batchSize int, fn func(rows [][]datagenValue) error) error {
+	if batchSize <= 0 {
+		batchSize = 256
+	}
+	g.rand = rand.New(rand.NewSource(g.seed))
+	g.generated, g.dropped = 0, 0
+	for _, key := range g.uniqueTuples {
+		for k := range key.seen {
+			delete(key.seen, k)
+		}
+	}
+	batch := make([][]datagenValue, 0, batchSize)
+	for i := int64(0); i < g.rows; i++ {
+		if row, ok := g.nextRow(); ok {
+			batch = append(batch, row)
+		}
+		if len(batch) > 0 && (len(batch) == batchSize || i == g.rows-1) {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if g.dropped > 0 {
+		utils.Warningf("%v rows of %v are dropped since they violate unique keys", g.dropped, g.table.Key())
+	}
+	return nil
+}
+
+// insertSyntheticData inserts synthetic rows of the table matching the statistics into the cluster.
+func insertSyntheticData(db optimizer.WhatIfOptimizer, table utils.TableSchema, stats *statsDumpTable, maxRows int64) error {
+	g, err := newStatsDataGenerator(table, stats, maxRows, 1)
+	if err != nil {
+		return err
+	}
+	utils.Infof("generate %v synthetic rows for %v.%v (%v rows in statistics)", g.rows, table.SchemaName, table.TableName, stats.Count)
+	if err := g.generate(256, func(rows [][]datagenValue) error {
+		return db.Execute(g.insertStmt(rows))
+	}); err != nil {
+		return err
+	}
+	count, err := queryInt64(db, fmt.Sprintf("select count(*) from `%v`.`%v`", table.SchemaName, table.TableName))
+	if err != nil {
+		return err
+	}
+	if count < g.rows-g.dropped {
+		utils.Warningf("only %v of %v generated rows are inserted into %v.%v", count, g.rows-g.dropped, table.SchemaName, table.TableName)
+	}
+	return nil
+}
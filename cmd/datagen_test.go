@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tipb/go-tipb"
+	"github.com/qw4990/index_advisor/utils"
+)
+
+func TestStatsDataGenerator(t *testing.T) {
+	table, err := utils.ParseCreateTableStmt("test", "create table t (a int not null, b varchar(10), c date, d int as (a+1), e double)")
+	must(err)
+	stats := &statsDumpTable{
+		DatabaseName: "test",
+		TableName:    "t",
+		Count:        1000,
+		Columns: map[string]*statsDumpColumn{
+			"a": {Histogram: &statsDumpHistogram{NDV: 200, Buckets: []statsDumpBucket{
+				{Count: 500, LowerBound: []byte("1"), UpperBound: []byte("100"), Repeats: 100},
+				{Count: 1000, LowerBound: []byte("101"), UpperBound: []byte("200"), Repeats: 1},
+			}}},
+			"b": {NullCount: 500, Histogram: &statsDumpHistogram{NDV: 10, Buckets: []statsDumpBucket{
+				{Count: 500, LowerBound: []byte("aaa"), UpperBound: []byte("zzz"), Repeats: 1},
+			}}},
+			"c": {Histogram: &statsDumpHistogram{NDV: 30, Buckets: []statsDumpBucket{
+				{Count: 1000, LowerBound: []byte("2023-01-01"), UpperBound: []byte("2023-01-31"), Repeats: 1},
+			}}},
+		},
+	}
+	g, err := newStatsDataGenerator(table, stats, 0, 1)
+	must(err)
+	mustTrue(g.rows == 1000, g.rows)
+	mustTrue(len(g.columns) == 4, g.columns) // the generated column d is skipped
+
+	var rows [][]datagenValue
+	must(g.generate(300, func(batch [][]datagenValue) error {
+		for _, row := range batch {
+			rows = append(rows, append([]datagenValue{}, row...))
+		}
+		return nil
+	}))
+	mustTrue(len(rows) == 1000, len(rows))
+
+	var aRepeats, bNulls int
+	for _, row := range rows {
+		a, err := strconv.Atoi(row[0].Str)
+		must(err)
+		mustTrue(a >= 1 && a <= 200, row)
+		if a == 100 {
+			aRepeats++
+		}
+		if row[1].Null {
+			bNulls++
+		} else {
+			mustTrue(row[1].Str >= "aaa" && row[1].Str <= "zzz", row)
+		}
+		mustTrue(row[2].Str >= "2023-01-01" && row[2].Str <= "2023-01-31", row)
+		_, err = strconv.ParseFloat(row[3].Str, 64) // no statistics
+		must(err)
+	}
+	mustTrue(aRepeats > 50 && aRepeats < 150, aRepeats)
+	mustTrue(bNulls > 400 && bNulls < 600, bNulls)
+
+	g, err = newStatsDataGenerator(table, stats, 10, 1)
+	must(err)
+	mustTrue(g.rows == 10, g.rows)
+	stmt := g.insertStmt(rows[:2])
+	mustTrue(strings.HasPrefix(stmt, "INSERT IGNORE INTO `test`.`t` (`a`, `b`, `c`, `e`) VALUES ("), stmt)
+	mustTrue(sqlLiteral(table.Columns[1], datagenValue{Str: `it's\`}) == `'it''s\\'`)
+	mustTrue(sqlLiteral(table.Columns[0], datagenValue{Str: "12"}) == "12")
+	mustTrue(sqlLiteral(table.Columns[0], datagenValue{Null: true}) == "NULL")
+
+	fpath := path.Join(t.TempDir(), "test.t.csv")
+	must(g.writeCSV(fpath, 3))
+	data, err := os.ReadFile(fpath)
+	must(err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	mustTrue(len(lines) == 11 && lines[0] == "a,b,c,e", lines)
+}
+
+func TestStatsDataGeneratorTopNAndIndex(t *testing.T) {
+	table, err := utils.ParseCreateTableStmt("test", "create table t (a int, b varchar(20), c datetime, key idx_ab(a, b))")
+	must(err)
+	encode := func(vals ...interface{}) []byte {
+		key, err := codec.EncodeKey(nil, nil, types.MakeDatums(vals...)...)
+		must(err)
+		return key
+	}
+	packed, err := types.NewTime(types.FromDate(2023, 5, 1, 10, 0, 0, 0), mysql.TypeDatetime, 0).ToPackedUint()
+	must(err)
+	stats := &statsDumpTable{
+		DatabaseName: "test",
+		TableName:    "t",
+		Count:        1000,
+		Columns: map[string]*statsDumpColumn{
+			"a": { // 900 rows of a=7, 100 rows in [10, 20]
+				CMSketch: &tipb.CMSketch{TopN: []*tipb.CMSketchTopN{{Data: encode(7), Count: 900}}},
+				Histogram: &statsDumpHistogram{NDV: 12, Buckets: []statsDumpBucket{
+					{Count: 100, LowerBound: []byte("10"), UpperBound: []byte("20"), Repeats: 1},
+				}},
+			},
+			"c": {CMSketch: &tipb.CMSketch{TopN: []*tipb.CMSketchTopN{{Data: encode(packed), Count: 1000}}}},
+		},
+		Indices: map[string]*statsDumpColumn{
+			"idx_ab": { // b is determined by a
+				CMSketch: &tipb.CMSketch{TopN: []*tipb.CMSketchTopN{{Data: encode(7, "seven"), Count: 900}}},
+				Histogram: &statsDumpHistogram{NDV: 2, Buckets: []statsDumpBucket{
+					{Count: 100, LowerBound: encode(10, "ten"), UpperBound: encode(20, "twenty"), Repeats: 1},
+				}},
+			},
+		},
+	}
+	g, err := newStatsDataGenerator(table, stats, 0, 1)
+	must(err)
+	mustTrue(len(g.groups) == 1 && len(g.groups[0].tuples) == 3, g.groups)
+	mustTrue(len(g.topN["c"]) == 1 && g.topN["c"][0].Value.Str == "2023-05-01 10:00:00", g.topN["c"])
+
+	var sevens int
+	must(g.generate(100, func(rows [][]datagenValue) error {
+		for _, row := range rows {
+			a, err := strconv.Atoi(row[0].Str)
+			must(err)
+			switch {
+			case a == 7:
+				sevens++
+				mustTrue(row[1].Str == "seven", row)
+			case a >= 10 && a < 20:
+				mustTrue(row[1].Str == "ten", row)
+			case a == 20:
+				mustTrue(row[1].Str == "twenty", row)
+			default:
+				t.Errorf("unexpected row %v", row)
+			}
+			mustTrue(row[2].Str == "2023-05-01 10:00:00", row)
+		}
+		return nil
+	}))
+	mustTrue(sevens > 850 && sevens < 950, sevens)
+}
+
+func TestStatsDataGeneratorUniqueKeys(t *testing.T) {
+	table, err := utils.ParseCreateTableStmt("test", "create table t (id int, u varchar(20), a int, b int, "+
+		"primary key (id) clustered, unique key uk_u(u), unique key uk_ab(a, b))")
+	must(err)
+	stats := &statsDumpTable{
+		DatabaseName: "test",
+		TableName:    "t",
+		Count:        10000,
+		Columns: map[string]*statsDumpColumn{
+			"id": {Histogram: &statsDumpHistogram{NDV: 10000, Buckets: []statsDumpBucket{
+				{Count: 5000, LowerBound: []byte("1"), UpperBound: []byte("5000"), Repeats: 1},
+				{Count: 10000, LowerBound: []byte("5001"), UpperBound: []byte("10000"), Repeats: 1},
+			}}},
+			"u": {NullCount: 1000, Histogram: &statsDumpHistogram{NDV: 9000, Buckets: []statsDumpBucket{
+				{Count: 9000, LowerBound: []byte("a"), UpperBound: []byte("z"), Repeats: 1},
+			}}},
+			"a": {Histogram: &statsDumpHistogram{NDV: 10, Buckets: []statsDumpBucket{
+				{Count: 10000, LowerBound: []byte("1"), UpperBound: []byte("10"), Repeats: 1},
+			}}},
+			"b": {Histogram: &statsDumpHistogram{NDV: 2000, Buckets: []statsDumpBucket{
+				{Count: 10000, LowerBound: []byte("1"), UpperBound: []byte("2000"), Repeats: 1},
+			}}},
+		},
+	}
+	g, err := newStatsDataGenerator(table, stats, 0, 1)
+	must(err)
+	mustTrue(len(g.uniqueValues) == 2 && len(g.uniqueTuples) == 1, g.uniqueValues, g.uniqueTuples)
+
+	collect := func() [][]datagenValue {
+		var rows [][]datagenValue
+		must(g.generate(300, func(batch [][]datagenValue) error {
+			for _, row := range batch {
+				rows = append(rows, append([]datagenValue{}, row...))
+			}
+			return nil
+		}))
+		return rows
+	}
+	rows := collect()
+	mustTrue(int64(len(rows))+g.dropped == 10000 && g.dropped < 100, len(rows), g.dropped)
+	ids, us, abs := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	var nulls int
+	for _, row := range rows {
+		id, err := strconv.Atoi(row[0].Str)
+		must(err)
+		mustTrue(id >= 1 && id <= 10000 && !ids[row[0].Str], row)
+		ids[row[0].Str] = true
+		if row[1].Null {
+			nulls++
+		} else {
+			mustTrue(!us[row[1].Str], row)
+			us[row[1].Str] = true
+		}
+		ab := row[2].Str + "," + row[3].Str
+		mustTrue(!abs[ab], row)
+		abs[ab] = true
+	}
+	mustTrue(nulls > 900 && nulls <= 1000, nulls)
+
+	again := collect() // each call generates the same rows
+	mustTrue(len(again) == len(rows) && again[0][0] == rows[0][0] && again[len(rows)-1][3] == rows[len(rows)-1][3])
+}
+
+func TestStatsDataGeneratorUniqueTopN(t *testing.T) {
+	table, err := utils.ParseCreateTableStmt("test", "create table t (id int, primary key (id) clustered)")
+	must(err)
+	topN, err := codec.EncodeKey(nil, nil, types.NewIntDatum(7))
+	must(err)
+	stats := &statsDumpTable{ // the count is larger than the histogram total, which is normal after ANALYZE
+		DatabaseName: "test",
+		TableName:    "t",
+		Count:        2000,
+		Columns: map[string]*statsDumpColumn{
+			"id": {
+				CMSketch: &tipb.CMSketch{TopN: []*tipb.CMSketchTopN{{Data: topN, Count: 1}}},
+				Histogram: &statsDumpHistogram{NDV: 999, Buckets: []statsDumpBucket{
+					{Count: 999, LowerBound: []byte("1"), UpperBound: []byte("1000"), Repeats: 1},
+				}},
+			},
+		},
+	}
+	g, err := newStatsDataGenerator(table, stats, 0, 1)
+	must(err)
+	ids := make(map[string]bool)
+	must(g.generate(256, func(rows [][]datagenValue) error {
+		for _, row := range rows {
+			mustTrue(!ids[row[0].Str], row)
+			ids[row[0].Str] = true
+		}
+		return nil
+	}))
+	mustTrue(len(ids) == 2000 && ids["7"], len(ids))
+}
@@ -42,7 +42,7 @@ func TestOnlineModeSimple(t *testing.T) {
 	must(db.Execute(`select a from t where a=1`))
 	must(db.Execute(`select a, b from t where a=1 and b=1`))
 
-	_, _, _, err = adviseOnlineMode(adviseOnlineCmdOpt{
+	_, _, _, _, err = adviseOnlineMode(adviseOnlineCmdOpt{
 		maxNumIndexes:           5,
 		maxIndexWidth:           3,
 		dsn:                     server.DSN(),
@@ -55,7 +55,7 @@ func TestOnlineModeSimple(t *testing.T) {
 	})
 	mustTrue(strings.Contains(err.Error(), "query-schemas is not specified"), err.Error())
 
-	_, _, _, err = adviseOnlineMode(adviseOnlineCmdOpt{
+	_, _, _, _, err = adviseOnlineMode(adviseOnlineCmdOpt{
 		maxNumIndexes:           5,
 		maxIndexWidth:           3,
 		dsn:                     server.DSN(),
@@ -68,7 +68,7 @@ func TestOnlineModeSimple(t *testing.T) {
 	})
 	mustTrue(strings.Contains(err.Error(), "no queries are found"), err.Error())
 
-	result, _, _, err := adviseOnlineMode(adviseOnlineCmdOpt{
+	result, _, _, _, err := adviseOnlineMode(adviseOnlineCmdOpt{
 		maxNumIndexes:           1,
 		maxIndexWidth:           3,
 		dsn:                     server.DSN(),
@@ -104,7 +104,7 @@ func TestOnlineModeCrossDBQuery(t *testing.T) {
 	must(db.Execute(`select a from t2 where a=1 and b=1`))
 	must(db.Execute(`select * from t2, db1.t1 where t1.a=t2.a and t2.b=1`))
 
-	result, _, _, err := adviseOnlineMode(adviseOnlineCmdOpt{
+	result, _, _, _, err := adviseOnlineMode(adviseOnlineCmdOpt{
 		maxNumIndexes:           5,
 		maxIndexWidth:           3,
 		dsn:                     server.DSN(),
@@ -118,7 +118,7 @@ func TestOnlineModeCrossDBQuery(t *testing.T) {
 	must(err)
 	checkAdviseResult(result, []string{"CREATE INDEX idx_a_b ON db1.t1 (a, b)"})
 
-	result, _, _, err = adviseOnlineMode(adviseOnlineCmdOpt{
+	result, _, _, _, err = adviseOnlineMode(adviseOnlineCmdOpt{
 		maxNumIndexes:           5,
 		maxIndexWidth:           3,
 		dsn:                     server.DSN(),
@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/qw4990/index_advisor/optimizer"
@@ -15,104 +22,248 @@ import (
 
 type evaluateCmdOpt struct {
 	dsn          string
-	analyze      bool
+	explainOnly  bool
 	qWhiteList   string
 	qBlackList   string
 	queryPath    string
 	indexDirPath string
 	output       string
+	logLevel     string
+
+	warmups     int
+	iterations  int
+	concurrency int
+	timeout     time.Duration
+	alpha       float64
 }
 
 func NewEvaluateCmd() *cobra.Command {
 	var opt evaluateCmdOpt
 	cmd := &cobra.Command{
-		Use:    "evaluate",
-		Short:  "exec all queries in the specified workload (only for test)",
-		Long:   `exec all queries in the specified workload and collect their plans and execution times (only for test)`,
-		Hidden: true,
+		Use:   "evaluate",
+		Short: "benchmark the workload under the current indexes and each index configuration, use `index_advisor evaluate --help` to see more details",
+		Long: `benchmark the workload under the current indexes and each index configuration.
+How it work:
+1. connect to your TiDB cluster through the DSN and load the workload
+2. run the workload under the current indexes as the baseline: each query is run '--warmups' times to warm caches,
+   and then '--iterations' times by '--concurrency' connections, queries running longer than '--timeout' are interrupted
+3. for each index configuration (a DDL file containing 'CREATE INDEX' statements), create and analyze its indexes physically,
+   run the workload in the same way, and drop these indexes
+4. report p50/p95/p99 latencies of each query, and compare each configuration with the baseline by the Mann-Whitney U test,
+   results are saved into 'summary.txt' and the machine-readable 'result.json'
+`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
 			_, dbName := utils.GetDBNameFromDSN(opt.dsn)
 			if dbName == "" {
 				return fmt.Errorf("invalid dsn: %s, no database name", opt.dsn)
 			}
+			if opt.iterations < 1 || opt.concurrency < 1 || opt.warmups < 0 {
+				return fmt.Errorf("invalid warmups %v, iterations %v or concurrency %v", opt.warmups, opt.iterations, opt.concurrency)
+			}
 
 			queries, err := utils.LoadQueries(dbName, opt.queryPath)
 			if err != nil {
 				return err
 			}
-
 			if opt.qWhiteList != "" || opt.qBlackList != "" {
 				queries = utils.FilterQueries(queries, strings.Split(opt.qWhiteList, ","), strings.Split(opt.qBlackList, ","))
 			}
+			queryList := queries.ToList()
+			sort.Slice(queryList, func(i, j int) bool { return queryList[i].Alias < queryList[j].Alias })
 
 			db, err := optimizer.NewTiDBWhatIfOptimizer(opt.dsn)
 			if err != nil {
 				return err
 			}
+			defer db.Close()
+			if opt.explainOnly {
+				return explainQueries(db, queries)
+			}
 
-			sqls := queries.ToList()
-			sort.Slice(sqls, func(i, j int) bool {
-				return sqls[i].Alias < sqls[j].Alias
-			})
-
-			if opt.indexDirPath == "" {
-				if opt.analyze {
-					return explainQueries(db, queries)
-				} else {
-					return executeQueries(db, queries, opt.output)
+			indexFiles := args
+			if opt.indexDirPath != "" {
+				entries, err := os.ReadDir(opt.indexDirPath)
+				if err != nil {
+					return err
+				}
+				for _, entry := range entries {
+					if strings.HasSuffix(entry.Name(), ".sql") {
+						indexFiles = append(indexFiles, path.Join(opt.indexDirPath, entry.Name()))
+					}
+				}
+			}
+			var confs []indexConf
+			for _, f := range indexFiles {
+				indexes, err := loadIndexesFromFile(f)
+				if err != nil {
+					return err
 				}
+				confs = append(confs, indexConf{Name: strings.TrimSuffix(path.Base(f), path.Ext(f)), Indexes: indexes.ToList()})
 			}
 
-			indexFiles, err := os.ReadDir(opt.indexDirPath)
+			pool, err := sql.Open("mysql", opt.dsn)
 			if err != nil {
 				return err
 			}
-			for _, indexFile := range indexFiles {
-				if !strings.HasSuffix(indexFile.Name(), ".sql") {
-					continue
-				}
-				utils.Infof("execute queries with index %s", indexFile.Name())
-				indexConfPath := path.Join(opt.indexDirPath, indexFile.Name())
-				if err := executeQueriesWithIndexes(db, queries, indexConfPath, opt.output); err != nil {
-					return err
-				}
-				utils.Infof("finish executing queries with index %s", indexFile.Name())
+			defer pool.Close()
+			pool.SetMaxOpenConns(opt.concurrency)
+			pool.SetMaxIdleConns(opt.concurrency)
+
+			result, err := benchmarkIndexConfs(db, pool, queryList, confs, opt)
+			if err != nil {
+				return err
+			}
+			summary := result.format(opt.alpha)
+			fmt.Println(summary)
+			if opt.output == "" {
+				return nil
+			}
+			if err := utils.SaveContentTo(path.Join(opt.output, "summary.txt"), summary); err != nil {
+				return err
 			}
-			return nil
+			data, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return err
+			}
+			return utils.SaveContentTo(path.Join(opt.output, "result.json"), string(data))
 		},
 	}
 
 	cmd.Flags().StringVar(&opt.dsn, "dsn", "root:@tcp(127.0.0.1:4000)/test", "dsn")
-	cmd.Flags().BoolVar(&opt.analyze, "analyze", true, "whether to use `explain analyze`")
-	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "")
-	cmd.Flags().StringVar(&opt.indexDirPath, "index-dir", "", "")
+	cmd.Flags().BoolVar(&opt.explainOnly, "explain-only", false, "only print the estimated cost of each query instead of running them")
+	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "the workload to benchmark, e.g. './examples/tpch_example1/queries'")
+	cmd.Flags().StringVar(&opt.indexDirPath, "index-dir", "", "the directory of index configurations, each '.sql' file containing 'CREATE INDEX' statements is a configuration, they can also be passed as arguments")
 	cmd.Flags().StringVar(&opt.qWhiteList, "query-white-list", "", "queries to consider, e.g. 'q1,q2,q6'")
 	cmd.Flags().StringVar(&opt.qBlackList, "query-black-list", "", "queries to ignore, e.g. 'q5,q12'")
-	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result")
+	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result ('summary.txt', 'result.json' and plans of queries under each configuration)")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	cmd.Flags().IntVar(&opt.warmups, "warmups", 1, "the number of times to run each query before measuring to warm caches")
+	cmd.Flags().IntVar(&opt.iterations, "iterations", 5, "the number of measured runs of each query")
+	cmd.Flags().IntVar(&opt.concurrency, "concurrency", 1, "the number of connections running queries concurrently")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", time.Minute, "the timeout of each query, e.g. '30s', 0 means no timeout")
+	cmd.Flags().Float64Var(&opt.alpha, "alpha", 0.05, "the significance level to compare each configuration with the baseline")
 	return cmd
 }
 
-func executeQueriesWithIndexes(db optimizer.WhatIfOptimizer, queries utils.Set[utils.Query], indexConfPath, savePath string) error {
-	// load indexes from indexConfPath into the cluster
-	stmts, err := utils.ParseStmtsFromFile(indexConfPath)
-	if err != nil {
-		return err
+// benchmarkResult is the result of benchmarking the workload under all index configurations, which is saved as 'result.json'.
+type benchmarkResult struct {
+	Warmups     int               `json:"warmups"`
+	Iterations  int               `json:"iterations"`
+	Concurrency int               `json:"concurrency"`
+	Timeout     string            `json:"timeout"`
+	Configs     []benchmarkConfig `json:"configs"` // the first one is the baseline with the current indexes
+}
+
+type benchmarkConfig struct {
+	Name        string            `json:"name"`
+	Indexes     []string          `json:"indexes"`
+	Queries     []queryBenchmark  `json:"queries"`
+	Comparisons []queryComparison `json:"comparisons,omitempty"` // compared with the baseline
+}
+
+// queryBenchmark is the measured latencies of a query, failed and timed out runs are not counted in latencies.
+type queryBenchmark struct {
+	Alias       string    `json:"alias"`
+	LatenciesMs []float64 `json:"latencies_ms"`
+	P50Ms       float64   `json:"p50_ms"`
+	P95Ms       float64   `json:"p95_ms"`
+	P99Ms       float64   `json:"p99_ms"`
+	MeanMs      float64   `json:"mean_ms"`
+	Errors      int       `json:"errors"`
+	Timeouts    int       `json:"timeouts"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// queryComparison compares latencies of a query under a configuration with the baseline.
+type queryComparison struct {
+	Alias         string  `json:"alias"`
+	BaselineP50Ms float64 `json:"baseline_p50_ms"`
+	P50Ms         float64 `json:"p50_ms"`
+	Change        float64 `json:"change"`  // the relative change of p50 latency, negative means faster
+	PValue        float64 `json:"p_value"` // the p-value of the two-sided Mann-Whitney U test
+}
+
+// benchmarkIndexConfs benchmarks the workload under the current indexes and each index configuration.
+func benchmarkIndexConfs(db optimizer.WhatIfOptimizer, pool *sql.DB, queries []utils.Query, confs []indexConf, opt evaluateCmdOpt) (*benchmarkResult, error) {
+	result := &benchmarkResult{
+		Warmups:     opt.warmups,
+		Iterations:  opt.iterations,
+		Concurrency: opt.concurrency,
+		Timeout:     opt.timeout.String(),
 	}
-	indexes := utils.NewSet[utils.Index]()
-	tableNames := utils.NewSet[utils.TableName]()
-	for _, stmt := range stmts {
-		index, err := utils.ParseCreateIndexStmt(stmt)
+	if opt.output != "" {
+		if err := utils.PrepareDir(opt.output); err != nil {
+			return nil, err
+		}
+	}
+	run := func(name string, indexes []utils.Index) error {
+		conf := benchmarkConfig{Name: name, Indexes: []string{}}
+		for _, idx := range indexes {
+			conf.Indexes = append(conf.Indexes, idx.DDL())
+		}
+		if opt.output != "" {
+			if err := savePlans(db, queries, path.Join(opt.output, name)); err != nil {
+				return err
+			}
+		}
+		utils.Infof("benchmark %v queries under %v", len(queries), name)
+		conf.Queries = benchmarkQueries(pool, queries, opt)
+		result.Configs = append(result.Configs, conf)
+		return nil
+	}
+
+	if err := run("baseline", nil); err != nil {
+		return nil, err
+	}
+	for _, conf := range confs {
+		if err := createIndexConf(db, conf.Indexes); err != nil {
+			return nil, err
+		}
+		err := run(conf.Name, conf.Indexes)
+		if dropErr := dropIndexConf(db, conf.Indexes); err == nil {
+			err = dropErr
+		}
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	baseline := result.Configs[0]
+	for i := 1; i < len(result.Configs); i++ {
+		conf := &result.Configs[i]
+		for j, q := range conf.Queries {
+			base := baseline.Queries[j]
+			c := queryComparison{Alias: q.Alias, BaselineP50Ms: base.P50Ms, P50Ms: q.P50Ms, PValue: mannWhitneyU(base.LatenciesMs, q.LatenciesMs)}
+			if base.P50Ms > 0 {
+				c.Change = q.P50Ms/base.P50Ms - 1
+			}
+			conf.Comparisons = append(conf.Comparisons, c)
 		}
-		indexes.Add(index)
-		tableNames.Add(utils.TableName{SchemaName: index.SchemaName, TableName: index.TableName})
 	}
-	for _, index := range indexes.ToList() {
+	return result, nil
+}
+
+// createIndexConf creates and analyzes indexes of the configuration physically.
+// If it fails, indexes that have been created are dropped, so the next configuration starts from the baseline.
+func createIndexConf(db optimizer.WhatIfOptimizer, indexes []utils.Index) (err error) {
+	var created []utils.Index
+	defer func() {
+		if err == nil {
+			return
+		}
+		if dropErr := dropIndexConf(db, created); dropErr != nil {
+			utils.Warningf("fail to drop created indexes: %v", dropErr)
+		}
+	}()
+	tableNames := utils.NewSet[utils.TableName]()
+	for _, index := range indexes {
+		tableNames.Add(utils.TableName{SchemaName: index.SchemaName, TableName: index.TableName})
 		utils.Infof("execute: %s", index.DDL())
 		if err := db.Execute(index.DDL()); err != nil {
 			return err
 		}
+		created = append(created, index)
 	}
 	for _, t := range tableNames.ToList() {
 		analyzeStmt := fmt.Sprintf("ANALYZE TABLE %s.%s", t.SchemaName, t.TableName)
@@ -121,16 +272,12 @@ func executeQueriesWithIndexes(db optimizer.WhatIfOptimizer, queries utils.Set[u
 			return err
 		}
 	}
+	return nil
+}
 
-	// run queries
-	baseName := path.Base(indexConfPath)
-	baseName = strings.TrimSuffix(baseName, path.Ext(baseName))
-	if err := executeQueries(db, queries, path.Join(savePath, baseName)); err != nil {
-		return err
-	}
-
-	// remove indexes in indexConfPath
-	for _, index := range indexes.ToList() {
+// dropIndexConf drops indexes of the configuration.
+func dropIndexConf(db optimizer.WhatIfOptimizer, indexes []utils.Index) error {
+	for _, index := range indexes {
 		dropStmt := fmt.Sprintf("DROP INDEX %s ON %s.%s", index.IndexName, index.SchemaName, index.TableName)
 		utils.Infof("execute: %s", dropStmt)
 		if err := db.Execute(dropStmt); err != nil {
@@ -140,6 +287,257 @@ func executeQueriesWithIndexes(db optimizer.WhatIfOptimizer, queries utils.Set[u
 	return nil
 }
 
+// savePlans saves the plan of each query into the directory.
+func savePlans(db optimizer.WhatIfOptimizer, queries []utils.Query, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, q := range queries {
+		if err := db.Execute(`use ` + q.SchemaName); err != nil {
+			return err
+		}
+		p, err := db.Explain(q.Text)
+		if err != nil {
+			return fmt.Errorf("fail to explain %v: %v", q.Alias, err)
+		}
+		content := fmt.Sprintf("Alias: %s\nQuery:\n%s\n\n%s\n", q.Alias, q.Text, p.Format())
+		if err := utils.SaveContentTo(path.Join(dir, q.Alias+".txt"), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchmarkQueries warms up and runs all queries with opt.concurrency connections.
+func benchmarkQueries(pool *sql.DB, queries []utils.Query, opt evaluateCmdOpt) []queryBenchmark {
+	results := make([]queryBenchmark, len(queries))
+	for i, q := range queries {
+		results[i].Alias = q.Alias
+		results[i].LatenciesMs = []float64{}
+	}
+
+	// warm up all queries before measuring, then measure them, each phase runs queries concurrently
+	phase := func(times int, record bool) {
+		tasks := make(chan int)
+		go func() {
+			for k := 0; k < times; k++ {
+				for i := range queries {
+					tasks <- i
+				}
+			}
+			close(tasks)
+		}()
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for w := 0; w < opt.concurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn := &benchmarkConn{pool: pool, timeout: opt.timeout}
+				defer conn.close()
+				for i := range tasks {
+					latency, err := conn.run(queries[i])
+					if !record {
+						continue
+					}
+					mu.Lock()
+					r := &results[i]
+					switch {
+					case err == nil:
+						r.LatenciesMs = append(r.LatenciesMs, float64(latency)/float64(time.Millisecond))
+					case isQueryTimeout(err):
+						r.Timeouts++
+					default:
+						r.Errors++
+						r.LastError = err.Error()
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	phase(opt.warmups, false)
+	phase(opt.iterations, true)
+
+	for i := range results {
+		r := &results[i]
+		if r.Errors > 0 || r.Timeouts > 0 {
+			utils.Warningf("%v: %v errors, %v timeouts, last error: %v", r.Alias, r.Errors, r.Timeouts, r.LastError)
+		}
+		r.P50Ms, r.P95Ms, r.P99Ms = percentile(r.LatenciesMs, 50), percentile(r.LatenciesMs, 95), percentile(r.LatenciesMs, 99)
+		for _, l := range r.LatenciesMs {
+			r.MeanMs += l / float64(len(r.LatenciesMs))
+		}
+	}
+	return results
+}
+
+// benchmarkConn is a connection to run queries, it's re-established after a query is interrupted.
+type benchmarkConn struct {
+	pool    *sql.DB
+	timeout time.Duration
+	conn    *sql.Conn
+	schema  string
+}
+
+func (c *benchmarkConn) run(q utils.Query) (time.Duration, error) {
+	if c.conn == nil {
+		conn, err := c.pool.Conn(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		c.conn, c.schema = conn, ""
+		if c.timeout > 0 { // let the server interrupt the query, the client context may not stop it
+			if _, err := c.conn.ExecContext(context.Background(), fmt.Sprintf("set @@max_execution_time = %v", c.timeout.Milliseconds())); err != nil {
+				utils.Warningf("fail to set max_execution_time: %v", err)
+			}
+		}
+	}
+	if c.schema != q.SchemaName {
+		if _, err := c.conn.ExecContext(context.Background(), "use "+q.SchemaName); err != nil {
+			c.close()
+			return 0, err
+		}
+		c.schema = q.SchemaName
+	}
+
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout+time.Second) // a little longer than max_execution_time
+		defer cancel()
+	}
+	begin := time.Now()
+	rows, err := c.conn.QueryContext(ctx, q.Text)
+	if err == nil {
+		for rows.Next() { // drain all rows
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	latency := time.Since(begin)
+	if err != nil && (ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded)) {
+		c.close() // the connection is broken after the context is canceled
+		return latency, context.DeadlineExceeded
+	}
+	return latency, err
+}
+
+func (c *benchmarkConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// isQueryTimeout returns whether the query is interrupted by the timeout.
+func isQueryTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "maximum statement execution time exceeded")
+}
+
+// percentile returns the p-th percentile of values with the nearest-rank method, 0 if there is no value.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test with the normal approximation,
+// which tests whether values in a and b come from the same distribution without assuming normality.
+func mannWhitneyU(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type sample struct {
+		v     float64
+		first bool
+	}
+	samples := make([]sample, 0, len(a)+len(b))
+	for _, v := range a {
+		samples = append(samples, sample{v, true})
+	}
+	for _, v := range b {
+		samples = append(samples, sample{v, false})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].v < samples[j].v })
+
+	var rankSum, tieCorrection float64
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].v == samples[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // the average rank of ties, ranks start from 1
+		for k := i; k < j; k++ {
+			if samples[k].first {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		tieCorrection += t*t*t - t
+		i = j
+	}
+	n := n1 + n2
+	u := rankSum - n1*(n1+1)/2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieCorrection/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (u - n1*n2/2) / sigma
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// format formats the benchmark result, significant changes compared with the baseline are marked
+// with '+' (faster) and '!' (slower).
+func (r *benchmarkResult) format(alpha float64) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Warmups: %v, Iterations: %v, Concurrency: %v, Timeout: %v\n", r.Warmups, r.Iterations, r.Concurrency, r.Timeout)
+	for _, conf := range r.Configs {
+		fmt.Fprintf(&buf, "\n===================== %v (%v indexes) =====================\n", conf.Name, len(conf.Indexes))
+		for _, ddl := range conf.Indexes {
+			fmt.Fprintf(&buf, "  %v;\n", ddl)
+		}
+		fmt.Fprintf(&buf, "%-12v %12v %12v %12v %8v", "Alias", "P50(ms)", "P95(ms)", "P99(ms)", "Err/TO")
+		if len(conf.Comparisons) > 0 {
+			fmt.Fprintf(&buf, " %10v %8v", "P50 Change", "P-Value")
+		}
+		buf.WriteString("\n")
+		var totalP50, baselineP50 float64
+		for j, q := range conf.Queries {
+			totalP50 += q.P50Ms
+			fmt.Fprintf(&buf, "%-12v %12.2f %12.2f %12.2f %8v", q.Alias, q.P50Ms, q.P95Ms, q.P99Ms, fmt.Sprintf("%v/%v", q.Errors, q.Timeouts))
+			if len(conf.Comparisons) > 0 {
+				c := conf.Comparisons[j]
+				baselineP50 += c.BaselineP50Ms
+				mark := ""
+				if c.PValue < alpha {
+					mark = "+"
+					if c.Change > 0 {
+						mark = "!"
+					}
+				}
+				fmt.Fprintf(&buf, " %+9.2f%% %8.3f%v", 100*c.Change, c.PValue, mark)
+			}
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "Total P50 latency: %.2fms", totalP50)
+		if len(conf.Comparisons) > 0 {
+			fmt.Fprintf(&buf, " (%v compared with the baseline)", formatCostRatio(baselineP50, totalP50))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
 func explainQueries(db optimizer.WhatIfOptimizer, queries utils.Set[utils.Query]) error {
 	queryList := queries.ToList()
 	var totCost float64
@@ -164,47 +562,3 @@ func explainQueries(db optimizer.WhatIfOptimizer, queries utils.Set[utils.Query]
 	}
 	return nil
 }
-
-func executeQueries(db optimizer.WhatIfOptimizer, queries utils.Set[utils.Query], savePath string) error {
-	queryList := queries.ToList()
-	sort.Slice(queryList, func(i, j int) bool {
-		return queryList[i].Alias < queryList[j].Alias
-	})
-
-	os.MkdirAll(savePath, 0777)
-	summaryContent := ""
-	var totExecTime time.Duration
-	for _, sql := range queryList {
-		var execTimes []time.Duration
-		var plans []utils.Plan
-		for k := 0; k < 3; k++ {
-			p, err := db.ExplainAnalyze(sql.Text)
-			if err != nil {
-				return err
-			}
-			plans = append(plans, p)
-			execTimes = append(execTimes, p.ExecTime())
-			fmt.Println(">> ", k, sql.Alias, p.ExecTime())
-		}
-		sort.Slice(execTimes, func(i, j int) bool {
-			return execTimes[i] < execTimes[j]
-		})
-		avgTime := execTimes[1]
-		totExecTime += avgTime
-
-		content := fmt.Sprintf("Alias: %s\n", sql.Alias)
-		content += fmt.Sprintf("AvgTime: %v\n", avgTime)
-		content += fmt.Sprintf("ExecTimes: %v\n", execTimes)
-		content += fmt.Sprintf("Query:\n %s\n\n", sql.Text)
-		for _, p := range plans {
-			content += fmt.Sprintf("%v\n", p.Format())
-		}
-		utils.SaveContentTo(fmt.Sprintf("%v/%v.txt", savePath, sql.Alias), content)
-
-		summaryContent += fmt.Sprintf("%v %v\n", sql.Alias, avgTime)
-		fmt.Println(sql.Alias, avgTime)
-	}
-	fmt.Println("TotalExecutionTime:", totExecTime)
-	summaryContent += fmt.Sprintf("TotalExecutionTime: %v\n", totExecTime)
-	return utils.SaveContentTo(fmt.Sprintf("%v/summary.txt", savePath), summaryContent)
-}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBenchmarkStatistics(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3, 10, 9, 8, 7, 6}
+	mustTrue(percentile(values, 50) == 5, percentile(values, 50))
+	mustTrue(percentile(values, 95) == 10, percentile(values, 95))
+	mustTrue(percentile(values, 10) == 1, percentile(values, 10))
+	mustTrue(percentile(nil, 50) == 0)
+	mustTrue(values[0] == 5, values) // not sorted in place
+
+	p := mannWhitneyU([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10})
+	mustTrue(math.Abs(p-0.009) < 0.001, p)
+	p = mannWhitneyU([]float64{10, 11, 12, 13}, []float64{10, 11, 12, 13})
+	mustTrue(p > 0.99, p)
+	mustTrue(mannWhitneyU([]float64{3, 3, 3}, []float64{3, 3}) == 1)
+	mustTrue(mannWhitneyU(nil, []float64{1}) == 1)
+}
+
+func TestBenchmarkResultFormat(t *testing.T) {
+	r := &benchmarkResult{Warmups: 1, Iterations: 5, Concurrency: 2, Timeout: "1m0s", Configs: []benchmarkConfig{
+		{Name: "baseline", Queries: []queryBenchmark{{Alias: "q1", P50Ms: 100}, {Alias: "q2", P50Ms: 10}}},
+		{Name: "conf1", Indexes: []string{"CREATE INDEX idx_a ON test.t (a)"},
+			Queries: []queryBenchmark{{Alias: "q1", P50Ms: 10}, {Alias: "q2", P50Ms: 20, Timeouts: 1}},
+			Comparisons: []queryComparison{
+				{Alias: "q1", BaselineP50Ms: 100, P50Ms: 10, Change: -0.9, PValue: 0.01},
+				{Alias: "q2", BaselineP50Ms: 10, P50Ms: 20, Change: 1, PValue: 0.01},
+			}},
+	}}
+	content := r.format(0.05)
+	lines := strings.Split(content, "\n")
+	var q1, q2 string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "q1") && strings.Contains(l, "-90.00%") {
+			q1 = l
+		}
+		if strings.HasPrefix(l, "q2") && strings.Contains(l, "+100.00%") {
+			q2 = l
+		}
+	}
+	mustTrue(strings.HasSuffix(q1, "+"), content)
+	mustTrue(strings.HasSuffix(q2, "!") && strings.Contains(q2, "0/1"), content)
+	mustTrue(strings.Contains(content, "Total P50 latency: 30.00ms (-72.73% compared with the baseline)"), content)
+	mustTrue(!strings.Contains(r.format(0.001), "!"), r.format(0.001))
+}
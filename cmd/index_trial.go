@@ -0,0 +1,481 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type indexTrialCmdOpt struct {
+	dsn      string
+	indexes  []string
+	output   string
+	logLevel string
+
+	baseline       time.Duration
+	duration       time.Duration
+	pollInterval   time.Duration
+	regressionThr  float64
+	minExecCount   int
+	restoreVisible bool
+}
+
+func NewIndexTrialCmd() *cobra.Command {
+	var opt indexTrialCmdOpt
+	cmd := &cobra.Command{
+		Use:   "index-trial",
+		Short: "make indexes invisible for a trial period before dropping them, use `index_advisor index-trial --help` to see more details",
+		Long: `make indexes invisible for a trial period before dropping them.
+How it work:
+1. snapshot the latency of each statement digest on tables of these indexes from the statement summary in the recent '--baseline' period
+2. make these indexes INVISIBLE, and observe the workload for '--duration'
+3. every '--poll-interval', snapshot the latency of each digest in statement summary windows starting after the trial begins,
+   the trial stops early if any digest's average latency increases more than '--regression-threshold'
+4. the verdict is 'go' if no digest regresses and all digests using these indexes in the baseline are observed in the trial,
+   otherwise 'no-go' and these indexes are made VISIBLE again
+5. after a 'go' verdict, these indexes are kept INVISIBLE and their 'DROP INDEX' statements are written into 'drop.sql'
+Only statement summary windows beginning after the trial starts are observed, so '--duration' should cover several
+windows, whose length is 'tidb_stmt_summary_refresh_interval'.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			_, dbName := utils.GetDBNameFromDSN(opt.dsn)
+			specs := append(opt.indexes, args...)
+			if len(specs) == 0 {
+				return fmt.Errorf("no index is specified")
+			}
+			if opt.duration <= 0 || opt.pollInterval <= 0 {
+				return fmt.Errorf("invalid duration %v or poll interval %v", opt.duration, opt.pollInterval)
+			}
+
+			db, err := optimizer.NewTiDBWhatIfOptimizer(opt.dsn)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			var indexes []utils.Index
+			for _, spec := range specs {
+				idx, err := findTrialIndex(db, dbName, spec)
+				if err != nil {
+					return err
+				}
+				indexes = append(indexes, idx)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			result, err := runIndexTrial(ctx, db, indexes, opt)
+			if err != nil {
+				return err
+			}
+			content := result.format()
+			fmt.Println(content)
+			if opt.output == "" {
+				return nil
+			}
+			if err := os.MkdirAll(opt.output, 0755); err != nil {
+				return err
+			}
+			if err := utils.SaveContentTo(path.Join(opt.output, "trial.txt"), content); err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := utils.SaveContentTo(path.Join(opt.output, "trial.json"), string(data)); err != nil {
+				return err
+			}
+			if result.Verdict != indexTrialGo {
+				return nil
+			}
+			var drops []string
+			for _, idx := range indexes {
+				drops = append(drops, fmt.Sprintf("DROP INDEX `%v` ON `%v`.`%v`;", idx.IndexName, idx.SchemaName, idx.TableName))
+			}
+			return utils.SaveContentTo(path.Join(opt.output, "drop.sql"), strings.Join(drops, "\n")+"\n")
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.dsn, "dsn", "root:@tcp(127.0.0.1:4000)/test", "dsn")
+	cmd.Flags().StringSliceVar(&opt.indexes, "indexes", nil, "indexes to trial, e.g. 'db.t.idx_a, t.idx_b', the database in the DSN is used if not specified, they can also be passed as arguments")
+	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result ('trial.txt', 'trial.json' and 'drop.sql' after a 'go' verdict)")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	cmd.Flags().DurationVar(&opt.baseline, "baseline", 24*time.Hour, "the period before the trial to snapshot the baseline latency of each digest")
+	cmd.Flags().DurationVar(&opt.duration, "duration", 2*time.Hour, "the period to observe the workload with these indexes invisible")
+	cmd.Flags().DurationVar(&opt.pollInterval, "poll-interval", time.Minute, "the interval to check the latency of each digest during the trial")
+	cmd.Flags().Float64Var(&opt.regressionThr, "regression-threshold", 0.2, "a digest regresses if its average latency increases more than this ratio compared with the baseline")
+	cmd.Flags().IntVar(&opt.minExecCount, "min-exec-count", 10, "digests executed less than this number of times in the baseline or the trial are not judged")
+	cmd.Flags().BoolVar(&opt.restoreVisible, "restore-visible", false, "make these indexes VISIBLE again even after a 'go' verdict")
+	return cmd
+}
+
+// findTrialIndex finds the index specified like 'db.t.idx' or 't.idx', which should be a visible secondary index.
+func findTrialIndex(db optimizer.WhatIfOptimizer, defaultSchema, spec string) (utils.Index, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ".")
+	switch len(parts) {
+	case 2:
+		parts = append([]string{defaultSchema}, parts...)
+	case 3:
+	default:
+		return utils.Index{}, fmt.Errorf("invalid index %v, should be like 'db.t.idx' or 't.idx'", spec)
+	}
+	if parts[0] == "" {
+		return utils.Index{}, fmt.Errorf("invalid index %v, no database name", spec)
+	}
+	schema, err := getTableSchema(db, parts[0], parts[1])
+	if err != nil {
+		return utils.Index{}, err
+	}
+	for _, idx := range schema.Indexes {
+		if !strings.EqualFold(idx.IndexName, parts[2]) {
+			continue
+		}
+		if idx.Primary {
+			return utils.Index{}, fmt.Errorf("the primary key %v can not be invisible", spec)
+		}
+		if idx.Invisible {
+			return utils.Index{}, fmt.Errorf("the index %v is already invisible", spec)
+		}
+		return idx, nil
+	}
+	return utils.Index{}, fmt.Errorf("index %v does not exist", spec)
+}
+
+const (
+	indexTrialGo   = "go"
+	indexTrialNoGo = "no-go"
+
+	digestTrialOK         = "ok"
+	digestTrialRegressed  = "regressed"
+	digestTrialUnobserved = "unobserved" // used these indexes in the baseline but not executed enough in the trial
+	digestTrialNew        = "new"        // not executed enough in the baseline
+)
+
+// indexTrialResult is the result of an invisible-index trial, which is saved as 'trial.json'.
+type indexTrialResult struct {
+	Indexes []string           `json:"indexes"`
+	Start   string             `json:"start"` // the server time
+	End     string             `json:"end"`
+	Verdict string             `json:"verdict"`
+	Reasons []string           `json:"reasons,omitempty"`
+	Digests []indexTrialDigest `json:"digests"`
+}
+
+// indexTrialDigest compares the latency of a digest in the trial with the baseline.
+type indexTrialDigest struct {
+	SchemaName        string  `json:"schema_name"`
+	Digest            string  `json:"digest"`
+	Text              string  `json:"text"`
+	UsedIndexes       bool    `json:"used_indexes"` // whether its plans used the trial indexes in the baseline
+	BaselineExecCount int     `json:"baseline_exec_count"`
+	BaselineLatencyMs float64 `json:"baseline_latency_ms"`
+	TrialExecCount    int     `json:"trial_exec_count"`
+	TrialLatencyMs    float64 `json:"trial_latency_ms"`
+	Status            string  `json:"status"`
+}
+
+// digestLatency is the aggregated latency of a digest in statement summary windows.
+type digestLatency struct {
+	SchemaName string
+	Digest     string
+	Text       string
+	ExecCount  int
+	LatencyMs  float64 // the average latency
+	IndexNames []string
+}
+
+// runIndexTrial makes indexes invisible, observes the workload and returns the verdict. Indexes are made visible
+// again if the verdict is 'no-go' or on any error.
+func runIndexTrial(ctx context.Context, db optimizer.WhatIfOptimizer, indexes []utils.Index, opt indexTrialCmdOpt) (result *indexTrialResult, err error) {
+	if refresh, err := queryInt64(db, `select @@global.tidb_stmt_summary_refresh_interval`); err == nil &&
+		opt.duration < 2*time.Duration(refresh)*time.Second {
+		utils.Warningf("the trial duration %v is shorter than two statement summary windows (%vs), few digests may be observed", opt.duration, refresh)
+	}
+	var startStr string
+	if err := queryRows(db, `select now()`, func(rows *sql.Rows) error { return rows.Scan(&startStr) }); err != nil {
+		return nil, err
+	}
+	start, err := time.Parse(stmtSummaryTimeLayout, startStr)
+	if err != nil {
+		return nil, err
+	}
+	tables := utils.NewSet[utils.TableName]()
+	for _, idx := range indexes {
+		tables.Add(utils.TableName{SchemaName: idx.SchemaName, TableName: idx.TableName})
+	}
+	baseline, err := snapshotDigestLatency(db, tables, []string{
+		fmt.Sprintf("SUMMARY_BEGIN_TIME >= '%v'", start.Add(-opt.baseline).Format(stmtSummaryTimeLayout)),
+		fmt.Sprintf("SUMMARY_END_TIME <= '%v'", startStr)})
+	if err != nil {
+		return nil, err
+	}
+
+	var invisible []utils.Index
+	defer func() {
+		if result != nil && result.Verdict == indexTrialGo && !opt.restoreVisible {
+			return
+		}
+		for _, idx := range invisible {
+			ddl := alterIndexVisibilityDDL(idx, true)
+			utils.Infof("execute: %v", ddl)
+			if visibleErr := db.Execute(ddl); visibleErr != nil {
+				utils.Errorf("fail to make the index %v visible, please run '%v' manually: %v", idx.IndexName, ddl, visibleErr)
+			}
+		}
+	}()
+	result = &indexTrialResult{Start: startStr}
+	for _, idx := range indexes {
+		result.Indexes = append(result.Indexes, fmt.Sprintf("%v.%v.%v", idx.SchemaName, idx.TableName, idx.IndexName))
+		ddl := alterIndexVisibilityDDL(idx, false)
+		utils.Infof("execute: %v", ddl)
+		if err := db.Execute(ddl); err != nil {
+			return nil, err
+		}
+		invisible = append(invisible, idx)
+	}
+
+	trialConds := []string{fmt.Sprintf("SUMMARY_BEGIN_TIME >= '%v'", startStr)}
+	deadline := time.Now().Add(opt.duration)
+	ticker := time.NewTicker(opt.pollInterval)
+	defer ticker.Stop()
+	interrupted := false
+	for !interrupted {
+		select {
+		case <-ctx.Done():
+			interrupted = true
+		case <-ticker.C:
+		}
+		trial, err := snapshotDigestLatency(db, tables, trialConds)
+		if err != nil {
+			return nil, err
+		}
+		verdict, reasons, digests := judgeIndexTrial(baseline, trial, indexes, opt.regressionThr, opt.minExecCount)
+		result.Verdict, result.Reasons, result.Digests = verdict, reasons, digests
+		if interrupted {
+			result.Verdict = indexTrialNoGo
+			result.Reasons = append([]string{"the trial is interrupted"}, result.Reasons...)
+			break
+		}
+		regressed := false
+		for _, d := range digests {
+			regressed = regressed || d.Status == digestTrialRegressed
+		}
+		if regressed {
+			utils.Warningf("some digests regress, stop the trial")
+			break
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		utils.Infof("%v digests are observed in the trial, %v left", len(trial), time.Until(deadline).Round(time.Second))
+	}
+	if err := queryRows(db, `select now()`, func(rows *sql.Rows) error { return rows.Scan(&result.End) }); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+const stmtSummaryTimeLayout = "2006-01-02 15:04:05"
+
+// snapshotDigestLatency aggregates the latency of each digest on these tables in statement summary windows matching conds.
+func snapshotDigestLatency(db optimizer.WhatIfOptimizer, tables utils.Set[utils.TableName], conds []string) (map[string]*digestLatency, error) {
+	var records []stmtSummaryRecord
+	indexNames := make(map[string][]string)
+	for _, table := range []string{
+		`information_schema.statements_summary`,
+		`information_schema.statements_summary_history`,
+	} {
+		q := fmt.Sprintf(`select SCHEMA_NAME, DIGEST, DIGEST_TEXT, EXEC_COUNT, AVG_LATENCY, SUMMARY_BEGIN_TIME,
+       ifnull(TABLE_NAMES, ''), ifnull(INDEX_NAMES, '') from %v where %v`, table, strings.Join(conds, " AND "))
+		err := queryRows(db, q, func(rows *sql.Rows) error {
+			var r stmtSummaryRecord
+			var execCount, avgLat, tableNames, indexNameList string
+			if err := rows.Scan(&r.SchemaName, &r.Digest, &r.Text, &execCount, &avgLat, &r.BeginTime, &tableNames, &indexNameList); err != nil {
+				return err
+			}
+			if !stmtOnTables(tables, tableNames) {
+				return nil
+			}
+			var err error
+			if r.ExecCount, err = strconv.Atoi(execCount); err != nil {
+				return err
+			}
+			if r.AvgLatency, err = strconv.ParseFloat(avgLat, 64); err != nil {
+				return err
+			}
+			records = append(records, r)
+			if indexNameList != "" {
+				key := r.SchemaName + "|" + r.Digest
+				indexNames[key] = append(indexNames[key], strings.Split(indexNameList, ",")...)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := aggregateDigestLatency(records)
+	for key, names := range indexNames {
+		if d, ok := result[key]; ok {
+			d.IndexNames = names
+		}
+	}
+	return result, nil
+}
+
+// stmtOnTables returns whether the statement accesses any of these tables, tableNames is like 'db.t1,db.t2'.
+func stmtOnTables(tables utils.Set[utils.TableName], tableNames string) bool {
+	for _, name := range strings.Split(tableNames, ",") {
+		parts := strings.SplitN(strings.TrimSpace(name), ".", 2)
+		if len(parts) == 2 && tables.Contains(utils.TableName{SchemaName: parts[0], TableName: parts[1]}) {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateDigestLatency aggregates statement summary records by digest and schema, the key is 'schema|digest'.
+func aggregateDigestLatency(records []stmtSummaryRecord) map[string]*digestLatency {
+	result := make(map[string]*digestLatency)
+	keys, groups := groupStmtSummaryRecords(records)
+	for _, key := range keys {
+		var d *digestLatency
+		for _, r := range groups[key] {
+			if r.ExecCount == 0 {
+				continue
+			}
+			if d == nil {
+				d = &digestLatency{SchemaName: r.SchemaName, Digest: r.Digest, Text: r.Text}
+				result[key] = d
+			}
+			totLatency := d.LatencyMs*float64(d.ExecCount) + r.AvgLatency/1e6*float64(r.ExecCount)
+			d.ExecCount += r.ExecCount
+			d.LatencyMs = totLatency / float64(d.ExecCount)
+		}
+	}
+	return result
+}
+
+// usesIndexes returns whether the digest used any of these indexes, whose index names are like 't:idx_a'.
+func (d *digestLatency) usesIndexes(indexes []utils.Index) bool {
+	for _, name := range d.IndexNames {
+		for _, idx := range indexes {
+			if strings.EqualFold(strings.TrimSpace(name), idx.TableName+":"+idx.IndexName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// judgeIndexTrial compares the latency of each digest in the trial with the baseline and returns the verdict.
+func judgeIndexTrial(baseline, trial map[string]*digestLatency, indexes []utils.Index, regressionThr float64, minExecCount int) (verdict string, reasons []string, digests []indexTrialDigest) {
+	var regressed, unobserved []string
+	for key, b := range baseline {
+		if b.ExecCount < minExecCount {
+			continue
+		}
+		d := indexTrialDigest{
+			SchemaName:        b.SchemaName,
+			Digest:            b.Digest,
+			Text:              b.Text,
+			UsedIndexes:       b.usesIndexes(indexes),
+			BaselineExecCount: b.ExecCount,
+			BaselineLatencyMs: b.LatencyMs,
+			Status:            digestTrialOK,
+		}
+		if t, ok := trial[key]; ok {
+			d.TrialExecCount, d.TrialLatencyMs = t.ExecCount, t.LatencyMs
+		}
+		switch {
+		case d.TrialExecCount < minExecCount:
+			if !d.UsedIndexes {
+				continue
+			}
+			d.Status = digestTrialUnobserved
+			unobserved = append(unobserved, d.Digest)
+		case d.TrialLatencyMs > d.BaselineLatencyMs*(1+regressionThr):
+			d.Status = digestTrialRegressed
+			regressed = append(regressed, d.Digest)
+		}
+		digests = append(digests, d)
+	}
+	for key, t := range trial {
+		if b, ok := baseline[key]; (ok && b.ExecCount >= minExecCount) || t.ExecCount < minExecCount {
+			continue
+		}
+		digests = append(digests, indexTrialDigest{
+			SchemaName:     t.SchemaName,
+			Digest:         t.Digest,
+			Text:           t.Text,
+			TrialExecCount: t.ExecCount,
+			TrialLatencyMs: t.LatencyMs,
+			Status:         digestTrialNew,
+		})
+	}
+	statusOrder := map[string]int{digestTrialRegressed: 0, digestTrialUnobserved: 1, digestTrialOK: 2, digestTrialNew: 3}
+	sort.Slice(digests, func(i, j int) bool {
+		if statusOrder[digests[i].Status] != statusOrder[digests[j].Status] {
+			return statusOrder[digests[i].Status] < statusOrder[digests[j].Status]
+		}
+		return digests[i].SchemaName+digests[i].Digest < digests[j].SchemaName+digests[j].Digest
+	})
+
+	if len(regressed) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%v digests regress more than %.2f%%", len(regressed), regressionThr*100))
+	}
+	if len(unobserved) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%v digests using these indexes in the baseline are not observed in the trial", len(unobserved)))
+	}
+	if len(reasons) > 0 {
+		return indexTrialNoGo, reasons, digests
+	}
+	return indexTrialGo, nil, digests
+}
+
+// format formats the trial result, the digest is truncated to 16 characters.
+func (r *indexTrialResult) format() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Verdict: %v\n", r.Verdict)
+	for _, reason := range r.Reasons {
+		fmt.Fprintf(&buf, "  %v\n", reason)
+	}
+	fmt.Fprintf(&buf, "Indexes: %v\n", strings.Join(r.Indexes, ", "))
+	fmt.Fprintf(&buf, "Trial: %v -> %v\n", r.Start, r.End)
+	fmt.Fprintf(&buf, "%-16v %-12v %22v %22v %10v  %v\n", "Digest", "Status", "Baseline(count/avg)", "Trial(count/avg)", "Change", "Text")
+	for _, d := range r.Digests {
+		digest := d.Digest
+		if len(digest) > 16 {
+			digest = digest[:16]
+		}
+		status := d.Status
+		if d.UsedIndexes {
+			status += "*"
+		}
+		text := d.Text
+		if len(text) > 60 {
+			text = text[:57] + "..."
+		}
+		fmt.Fprintf(&buf, "%-16v %-12v %22v %22v %10v  %v\n", digest, status,
+			fmt.Sprintf("%v/%.2fms", d.BaselineExecCount, d.BaselineLatencyMs),
+			fmt.Sprintf("%v/%.2fms", d.TrialExecCount, d.TrialLatencyMs),
+			formatCostRatio(d.BaselineLatencyMs, d.TrialLatencyMs), text)
+	}
+	buf.WriteString("* the digest used these indexes in the baseline\n")
+	return buf.String()
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qw4990/index_advisor/utils"
+)
+
+func TestIndexTrialSnapshot(t *testing.T) {
+	tables := utils.NewSet[utils.TableName]()
+	tables.Add(utils.TableName{SchemaName: "test", TableName: "t"})
+	mustTrue(stmtOnTables(tables, "test.t2,TEST.T"))
+	mustTrue(!stmtOnTables(tables, "test.t2") && !stmtOnTables(tables, ""))
+
+	latencies := aggregateDigestLatency([]stmtSummaryRecord{
+		{SchemaName: "test", Digest: "d1", ExecCount: 10, AvgLatency: 1e6, BeginTime: "10:00"},
+		{SchemaName: "test", Digest: "d1", ExecCount: 10, AvgLatency: 1e6, BeginTime: "10:00"}, // the same window in the history table
+		{SchemaName: "test", Digest: "d1", ExecCount: 30, AvgLatency: 3e6, BeginTime: "10:30"},
+		{SchemaName: "test", Digest: "d2", ExecCount: 0, BeginTime: "10:30"},
+	})
+	mustTrue(len(latencies) == 1, latencies)
+	d1 := latencies["test|d1"]
+	mustTrue(d1.ExecCount == 40 && d1.LatencyMs == 2.5, d1)
+}
+
+func TestIndexTrialVerdict(t *testing.T) {
+	indexes := []utils.Index{utils.NewIndex("test", "t", "idx_a", "a")}
+	baseline := map[string]*digestLatency{
+		"test|d1": {SchemaName: "test", Digest: "d1", ExecCount: 100, LatencyMs: 10, IndexNames: []string{"t:idx_a"}},
+		"test|d2": {SchemaName: "test", Digest: "d2", ExecCount: 100, LatencyMs: 10, IndexNames: []string{"t:primary"}},
+		"test|d3": {SchemaName: "test", Digest: "d3", ExecCount: 100, LatencyMs: 10},
+		"test|d4": {SchemaName: "test", Digest: "d4", ExecCount: 1, LatencyMs: 10},
+	}
+	trial := map[string]*digestLatency{
+		"test|d1": {SchemaName: "test", Digest: "d1", ExecCount: 50, LatencyMs: 11},
+		"test|d4": {SchemaName: "test", Digest: "d4", ExecCount: 50, LatencyMs: 100},
+	}
+	verdict, reasons, digests := judgeIndexTrial(baseline, trial, indexes, 0.2, 10)
+	mustTrue(verdict == indexTrialGo && len(reasons) == 0, verdict, reasons)
+	// d2 and d3 are not observed but don't use idx_a, d4 is new since it's not executed enough in the baseline
+	mustTrue(len(digests) == 2 && digests[0].Digest == "d1" && digests[0].UsedIndexes && digests[1].Status == digestTrialNew, digests)
+
+	trial["test|d1"] = &digestLatency{SchemaName: "test", Digest: "d1", ExecCount: 5, LatencyMs: 11}
+	trial["test|d2"] = &digestLatency{SchemaName: "test", Digest: "d2", ExecCount: 50, LatencyMs: 13}
+	verdict, reasons, digests = judgeIndexTrial(baseline, trial, indexes, 0.2, 10)
+	mustTrue(verdict == indexTrialNoGo && len(reasons) == 2, verdict, reasons)
+	mustTrue(digests[0].Digest == "d2" && digests[0].Status == digestTrialRegressed, digests)
+	mustTrue(digests[1].Digest == "d1" && digests[1].Status == digestTrialUnobserved, digests)
+
+	r := &indexTrialResult{Indexes: []string{"test.t.idx_a"}, Start: "2023-05-01 10:00:00", End: "2023-05-01 12:00:00",
+		Verdict: verdict, Reasons: reasons, Digests: digests}
+	content := r.format()
+	mustTrue(strings.HasPrefix(content, "Verdict: no-go\n  1 digests regress more than 20.00%"), content)
+	mustTrue(strings.Contains(content, "unobserved*"), content)
+	mustTrue(strings.Contains(content, "+30.00%"), content)
+}
@@ -0,0 +1,605 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/qw4990/index_advisor/advisor"
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type serveCmdOpt struct {
+	addr          string
+	concurrency   int
+	queueSize     int
+	tidbVersion   string
+	maxBundleSize int64
+	logLevel      string
+}
+
+func NewServeCmd() *cobra.Command {
+	var opt serveCmdOpt
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "serve the index advisor through an HTTP API, use `index_advisor serve --help` to see more details",
+		Long: `serve the index advisor through an HTTP API.
+Endpoints:
+  POST   /jobs              submit a job with a JSON request, which contains the DSN and optionally queries
+  POST   /jobs/bundle       submit a job with a workload bundle exported by 'workload-export' as the body,
+                            options like 'max_num_indexes' are specified by URL parameters
+  GET    /jobs              list all jobs
+  GET    /jobs/{id}         get the status of the job
+  GET    /jobs/{id}/report  get the JSON report of the finished job
+  DELETE /jobs/{id}         cancel the job
+Jobs are queued and run by a bounded number of workers.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			if opt.concurrency <= 0 || opt.queueSize <= 0 {
+				return fmt.Errorf("concurrency and queue-size should be positive")
+			}
+			m := newAdviseJobManager(opt.concurrency, opt.queueSize, func(ctx context.Context, req adviseJobRequest) (*adviseReport, error) {
+				if req.TiDBVersion == "" {
+					req.TiDBVersion = opt.tidbVersion
+				}
+				return runAdviseJob(ctx, req)
+			})
+			defer m.close()
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			server := &http.Server{Addr: opt.addr, Handler: newAdviseJobHandler(m, opt.maxBundleSize)}
+			errCh := make(chan error, 1)
+			go func() { errCh <- server.ListenAndServe() }()
+			utils.Infof("[serve] listen on %v with %v workers", opt.addr, opt.concurrency)
+			select {
+			case err := <-errCh:
+				return err
+			case <-ctx.Done():
+			}
+			utils.Infof("[serve] shutting down")
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancelShutdown()
+			return server.Shutdown(shutdownCtx)
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.addr, "addr", "127.0.0.1:8080", "the address to listen on")
+	cmd.Flags().IntVar(&opt.concurrency, "concurrency", 2, "the max number of jobs running at the same time")
+	cmd.Flags().IntVar(&opt.queueSize, "queue-size", 64, "the max number of queued jobs, new jobs are rejected if the queue is full")
+	cmd.Flags().StringVar(&opt.tidbVersion, "tidb-version", "nightly", "the TiDB version used to run bundle jobs if not specified by the job")
+	cmd.Flags().Int64Var(&opt.maxBundleSize, "max-bundle-size", 1<<30, "the max size in bytes of uploaded workload bundles")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	return cmd
+}
+
+// adviseJobRequest is the request to submit a job.
+// Jobs with bundles run in offline mode on a local TiDB instance, others run in online mode on the DSN.
+type adviseJobRequest struct {
+	DSN                     string                    `json:"dsn"`
+	Queries                 []utils.WorkloadFileQuery `json:"queries,omitempty"` // read from statement summary if empty
+	QuerySchemas            []string                  `json:"query_schemas,omitempty"`
+	QueryExecTimeThreshold  int                       `json:"query_exec_time_threshold,omitempty"`
+	QueryExecCountThreshold int                       `json:"query_exec_count_threshold,omitempty"`
+	TimeRange               string                    `json:"time_range,omitempty"`
+	MaxNumIndexes           int                       `json:"max_num_indexes,omitempty"`
+	MaxIndexWidth           int                       `json:"max_index_width,omitempty"`
+	CompressAlgo            string                    `json:"compress_algo,omitempty"`
+	MaxWorkloadSize         int                       `json:"max_workload_size,omitempty"`
+	CostCoverage            float64                   `json:"cost_coverage,omitempty"`
+	RegressionThreshold     float64                   `json:"regression_threshold,omitempty"`
+	RejectRegression        bool                      `json:"reject_regression,omitempty"`
+	RegressionWeightLimit   float64                   `json:"regression_weight_limit,omitempty"`
+	TiDBVersion             string                    `json:"tidb_version,omitempty"`
+
+	bundlePath string // the uploaded workload bundle
+}
+
+// parameter returns the advisor parameter of the request, unspecified fields use the same defaults as the commands.
+func (r adviseJobRequest) parameter() advisor.Parameter {
+	p := advisor.Parameter{
+		MaxNumberIndexes: r.MaxNumIndexes,
+		MaxIndexWidth:    r.MaxIndexWidth,
+		CompressionAlgo:  r.CompressAlgo,
+		MaxWorkloadSize:  r.MaxWorkloadSize,
+		CostCoverage:     r.CostCoverage,
+
+		RejectRegression:      r.RejectRegression,
+		RegressionThreshold:   r.RegressionThreshold,
+		RegressionWeightLimit: r.RegressionWeightLimit,
+	}
+	if p.MaxNumberIndexes == 0 {
+		p.MaxNumberIndexes = 5
+	}
+	if p.MaxIndexWidth == 0 {
+		p.MaxIndexWidth = 3
+	}
+	if p.CompressionAlgo == "" {
+		p.CompressionAlgo = "none"
+	}
+	if p.CostCoverage == 0 {
+		p.CostCoverage = 1
+	}
+	if p.RegressionThreshold == 0 {
+		p.RegressionThreshold = 0.05
+	}
+	return p
+}
+
+// adviseReport is the JSON report of a job.
+type adviseReport struct {
+	Indexes       []string            `json:"indexes"`
+	OriginalCost  float64             `json:"original_workload_cost"` // weighted by frequencies of queries
+	OptimizedCost float64             `json:"optimized_workload_cost"`
+	Queries       []adviseQueryReport `json:"queries"`
+	Regressions   []string            `json:"regressions"` // aliases of regressed queries
+}
+
+type adviseQueryReport struct {
+	Alias         string  `json:"alias"`
+	SchemaName    string  `json:"schema"`
+	Text          string  `json:"text"`
+	Frequency     int     `json:"frequency"`
+	OriginalCost  float64 `json:"original_cost"`
+	OptimizedCost float64 `json:"optimized_cost"`
+	Regressed     bool    `json:"regressed"`
+}
+
+func buildAdviseReport(indexes utils.Set[utils.Index], workload utils.WorkloadInfo, db optimizer.WhatIfOptimizer, regressionThr float64) (*adviseReport, error) {
+	indexList := indexes.ToList()
+	sort.Slice(indexList, func(i, j int) bool { // to make the result stable
+		return indexList[i].Key() < indexList[j].Key()
+	})
+	planChanges, err := getPlanChanges(db, workload, indexList)
+	if err != nil {
+		return nil, err
+	}
+	report := &adviseReport{Indexes: []string{}, Queries: []adviseQueryReport{}, Regressions: []string{}}
+	for _, idx := range indexList {
+		report.Indexes = append(report.Indexes, idx.DDL())
+	}
+	for _, change := range planChanges {
+		report.OriginalCost += change.OriPlan.PlanCost() * change.SQL.WeightedFrequency()
+		report.OptimizedCost += change.OptPlan.PlanCost() * change.SQL.WeightedFrequency()
+		report.Queries = append(report.Queries, adviseQueryReport{
+			Alias:         change.SQL.Alias,
+			SchemaName:    change.SQL.SchemaName,
+			Text:          change.SQL.Text,
+			Frequency:     change.SQL.Frequency,
+			OriginalCost:  change.OriPlan.PlanCost(),
+			OptimizedCost: change.OptPlan.PlanCost(),
+			Regressed:     change.regressed(regressionThr),
+		})
+		if change.regressed(regressionThr) {
+			report.Regressions = append(report.Regressions, change.SQL.Alias)
+		}
+	}
+	return report, nil
+}
+
+// runAdviseJob runs the job, the job is interrupted by closing its connection when ctx is canceled.
+func runAdviseJob(ctx context.Context, req adviseJobRequest) (*adviseReport, error) {
+	var db optimizer.WhatIfOptimizer
+	var err error
+	if req.bundlePath != "" {
+		s, sdb, err := startTiDB(req.TiDBVersion)
+		if s != nil {
+			defer s.Release()
+		}
+		if err != nil {
+			return nil, err
+		}
+		db = sdb
+	} else {
+		if db, err = optimizer.NewTiDBWhatIfOptimizer(req.DSN); err != nil {
+			return nil, err
+		}
+	}
+	defer db.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			db.Close()
+		case <-done:
+		}
+	}()
+
+	param := req.parameter()
+	var indexes utils.Set[utils.Index]
+	var workload *utils.WorkloadInfo
+	if req.bundlePath != "" {
+		indexes, workload, _, err = adviseOfflineMode(db, adviseOfflineCmdOpt{
+			maxNumIndexes:   param.MaxNumberIndexes,
+			maxIndexWidth:   param.MaxIndexWidth,
+			compressAlgo:    param.CompressionAlgo,
+			maxWorkloadSize: param.MaxWorkloadSize,
+			costCoverage:    param.CostCoverage,
+			dirPath:         req.bundlePath,
+			costModelVer:    "2",
+
+			regressionThr:         param.RegressionThreshold,
+			rejectRegression:      param.RejectRegression,
+			regressionWeightLimit: param.RegressionWeightLimit,
+		})
+	} else {
+		if reason := checkOnlineModeSupport(db); reason != "" {
+			return nil, errors.New("online mode is not supported: " + reason)
+		}
+		opt := adviseOnlineCmdOpt{
+			dsn:                     req.DSN,
+			querySchemas:            req.QuerySchemas,
+			queryExecTimeThreshold:  req.QueryExecTimeThreshold,
+			queryExecCountThreshold: req.QueryExecCountThreshold,
+			timeRange:               req.TimeRange,
+		}
+		if len(req.Queries) > 0 {
+			tmpDir, err := os.MkdirTemp("", "index_advisor_job")
+			if err != nil {
+				return nil, err
+			}
+			defer os.RemoveAll(tmpDir)
+			opt.queryPath = path.Join(tmpDir, "queries.json")
+			data, err := json.Marshal(utils.WorkloadFile{Queries: req.Queries})
+			if err != nil {
+				return nil, err
+			}
+			if err := utils.SaveContentTo(opt.queryPath, string(data)); err != nil {
+				return nil, err
+			}
+		}
+		if workload, err = prepareWorkloadOnlineMode(db, opt); err == nil {
+			indexes, _, err = advisor.IndexAdvise(db, *workload, param)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buildAdviseReport(indexes, *workload, db, param.RegressionThreshold)
+}
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+var errJobQueueFull = errors.New("the job queue is full, please retry later")
+
+// adviseJob is a job in the server.
+type adviseJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	SubmitTime time.Time  `json:"submit_time"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+
+	req    adviseJobRequest
+	report *adviseReport
+	cancel context.CancelFunc
+}
+
+// adviseJobManager queues jobs and runs them with a bounded number of workers.
+type adviseJobManager struct {
+	mu     sync.Mutex
+	jobs   map[string]*adviseJob
+	nextID int
+	queue  chan *adviseJob
+	closed bool
+	run    func(ctx context.Context, req adviseJobRequest) (*adviseReport, error)
+	wg     sync.WaitGroup
+}
+
+func newAdviseJobManager(concurrency, queueSize int, run func(ctx context.Context, req adviseJobRequest) (*adviseReport, error)) *adviseJobManager {
+	m := &adviseJobManager{
+		jobs:  make(map[string]*adviseJob),
+		queue: make(chan *adviseJob, queueSize),
+		run:   run,
+	}
+	for i := 0; i < concurrency; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	return m
+}
+
+func (m *adviseJobManager) worker() {
+	defer m.wg.Done()
+	for j := range m.queue {
+		m.mu.Lock()
+		if j.Status != jobQueued { // canceled before running
+			m.mu.Unlock()
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		startTime := time.Now()
+		j.Status, j.StartTime, j.cancel = jobRunning, &startTime, cancel
+		req := j.req
+		m.mu.Unlock()
+
+		utils.Infof("[serve] job %v starts", j.ID)
+		report, err := m.run(ctx, req)
+		cancel()
+		if req.bundlePath != "" {
+			os.Remove(req.bundlePath)
+		}
+
+		m.mu.Lock()
+		endTime := time.Now()
+		j.EndTime = &endTime
+		switch {
+		case j.Status == jobCanceled:
+		case err != nil:
+			j.Status, j.Error = jobFailed, err.Error()
+		default:
+			j.Status, j.report = jobSucceeded, report
+		}
+		utils.Infof("[serve] job %v finishes with status %v", j.ID, j.Status)
+		m.mu.Unlock()
+	}
+}
+
+// submit queues the job, errJobQueueFull is returned if the queue is full.
+func (m *adviseJobManager) submit(req adviseJobRequest) (adviseJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return adviseJob{}, errors.New("the server is closing")
+	}
+	m.nextID++
+	j := &adviseJob{
+		ID:         strconv.Itoa(m.nextID),
+		Status:     jobQueued,
+		SubmitTime: time.Now(),
+		req:        req,
+	}
+	select {
+	case m.queue <- j:
+	default:
+		return adviseJob{}, errJobQueueFull
+	}
+	m.jobs[j.ID] = j
+	return *j, nil
+}
+
+func (m *adviseJobManager) get(id string) (adviseJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return adviseJob{}, false
+	}
+	return *j, true
+}
+
+func (m *adviseJobManager) list() []adviseJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]adviseJob, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].SubmitTime.Before(jobs[j].SubmitTime) })
+	return jobs
+}
+
+// cancelJob cancels the queued or running job, finished jobs can't be canceled.
+func (m *adviseJobManager) cancelJob(id string) (adviseJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return adviseJob{}, fmt.Errorf("job %v not found", id)
+	}
+	switch j.Status {
+	case jobQueued:
+		now := time.Now()
+		j.Status, j.EndTime = jobCanceled, &now
+		if j.req.bundlePath != "" {
+			os.Remove(j.req.bundlePath)
+		}
+	case jobRunning:
+		j.Status = jobCanceled
+		j.cancel()
+	default:
+		return *j, fmt.Errorf("job %v is already %v", id, j.Status)
+	}
+	return *j, nil
+}
+
+// close stops accepting jobs, cancels queued and running jobs, and waits for all workers to exit.
+func (m *adviseJobManager) close() {
+	m.mu.Lock()
+	m.closed = true
+	close(m.queue)
+	var ids []string
+	for id, j := range m.jobs {
+		if j.Status == jobQueued || j.Status == jobRunning {
+			ids = append(ids, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		if _, err := m.cancelJob(id); err != nil { // finished in the meantime
+			utils.Debugf("[serve] %v", err)
+		}
+	}
+	m.wg.Wait()
+}
+
+func newAdviseJobHandler(m *adviseJobManager, maxBundleSize int64) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, m.list())
+		case http.MethodPost:
+			var req adviseJobRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+				return
+			}
+			if req.DSN == "" {
+				writeJSONError(w, http.StatusBadRequest, errors.New("dsn is not specified"))
+				return
+			}
+			submitJob(w, m, req)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v is not allowed", r.Method))
+		}
+	})
+	mux.HandleFunc("/jobs/bundle", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v is not allowed", r.Method))
+			return
+		}
+		req, err := parseBundleJobRequest(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		f, err := os.CreateTemp("", "index_advisor_bundle_*.tar.gz")
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		_, err = io.Copy(f, http.MaxBytesReader(w, r.Body, maxBundleSize))
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("fail to read the bundle: %v", err))
+			return
+		}
+		req.bundlePath = f.Name()
+		if !submitJob(w, m, req) {
+			os.Remove(f.Name())
+		}
+	})
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+		switch {
+		case sub == "" && r.Method == http.MethodGet:
+			j, ok := m.get(id)
+			if !ok {
+				writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %v not found", id))
+				return
+			}
+			writeJSON(w, http.StatusOK, j)
+		case sub == "" && r.Method == http.MethodDelete:
+			j, err := m.cancelJob(id)
+			if err != nil {
+				status := http.StatusConflict
+				if j.ID == "" {
+					status = http.StatusNotFound
+				}
+				writeJSONError(w, status, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, j)
+		case sub == "report" && r.Method == http.MethodGet:
+			j, ok := m.get(id)
+			if !ok {
+				writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %v not found", id))
+				return
+			}
+			if j.Status != jobSucceeded {
+				writeJSONError(w, http.StatusConflict, fmt.Errorf("job %v is %v", id, j.Status))
+				return
+			}
+			writeJSON(w, http.StatusOK, j.report)
+		default:
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %v %v", r.Method, r.URL.Path))
+		}
+	})
+	return mux
+}
+
+// parseBundleJobRequest parses options of bundle jobs from URL parameters.
+func parseBundleJobRequest(r *http.Request) (adviseJobRequest, error) {
+	var req adviseJobRequest
+	q := r.URL.Query()
+	ints := map[string]*int{
+		"max_num_indexes":   &req.MaxNumIndexes,
+		"max_index_width":   &req.MaxIndexWidth,
+		"max_workload_size": &req.MaxWorkloadSize,
+	}
+	for name, v := range ints {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return req, fmt.Errorf("invalid %v %v", name, s)
+			}
+			*v = n
+		}
+	}
+	floats := map[string]*float64{
+		"cost_coverage":           &req.CostCoverage,
+		"regression_threshold":    &req.RegressionThreshold,
+		"regression_weight_limit": &req.RegressionWeightLimit,
+	}
+	for name, v := range floats {
+		if s := q.Get(name); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return req, fmt.Errorf("invalid %v %v", name, s)
+			}
+			*v = f
+		}
+	}
+	if s := q.Get("reject_regression"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return req, fmt.Errorf("invalid reject_regression %v", s)
+		}
+		req.RejectRegression = b
+	}
+	req.CompressAlgo = q.Get("compress_algo")
+	req.TiDBVersion = q.Get("tidb_version")
+	return req, nil
+}
+
+// submitJob submits the job and writes the response, it returns whether the job is submitted.
+func submitJob(w http.ResponseWriter, m *adviseJobManager, req adviseJobRequest) bool {
+	j, err := m.submit(req)
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err)
+		return false
+	}
+	utils.Infof("[serve] job %v is submitted", j.ID)
+	writeJSON(w, http.StatusAccepted, j)
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		utils.Warningf("[serve] fail to write the response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdviseJobServer(t *testing.T) {
+	block := make(chan struct{})
+	m := newAdviseJobManager(1, 1, func(ctx context.Context, req adviseJobRequest) (*adviseReport, error) {
+		if req.DSN == "fail" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &adviseReport{Indexes: []string{"CREATE INDEX idx_a ON test.t (a)"}}, nil
+	})
+	defer m.close()
+	server := httptest.NewServer(newAdviseJobHandler(m, 1<<20))
+	defer server.Close()
+
+	do := func(method, url, body string, expectedStatus int, v any) {
+		req, err := http.NewRequest(method, server.URL+url, strings.NewReader(body))
+		must(err)
+		resp, err := http.DefaultClient.Do(req)
+		must(err)
+		defer resp.Body.Close()
+		mustTrue(resp.StatusCode == expectedStatus, method, url, resp.StatusCode)
+		if v != nil {
+			must(json.NewDecoder(resp.Body).Decode(v))
+		}
+	}
+	waitStatus := func(id, status string) {
+		for i := 0; i < 100; i++ {
+			var j adviseJob
+			do(http.MethodGet, "/jobs/"+id, "", http.StatusOK, &j)
+			if j.Status == status {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job %v is not %v", id, status)
+	}
+
+	do(http.MethodPost, "/jobs", `{}`, http.StatusBadRequest, nil)
+	var j1, j2 adviseJob
+	do(http.MethodPost, "/jobs", `{"dsn": "root:@tcp(127.0.0.1:4000)/test", "max_num_indexes": 3}`, http.StatusAccepted, &j1)
+	waitStatus(j1.ID, jobRunning)
+	do(http.MethodPost, "/jobs", `{"dsn": "root:@tcp(127.0.0.1:4000)/test"}`, http.StatusAccepted, &j2)
+	do(http.MethodPost, "/jobs", `{"dsn": "root:@tcp(127.0.0.1:4000)/test"}`, http.StatusServiceUnavailable, nil) // the queue is full
+	do(http.MethodGet, "/jobs/"+j1.ID+"/report", "", http.StatusConflict, nil)
+
+	// cancel the queued job and the running job
+	do(http.MethodDelete, "/jobs/"+j2.ID, "", http.StatusOK, nil)
+	do(http.MethodDelete, "/jobs/"+j1.ID, "", http.StatusOK, nil)
+	waitStatus(j1.ID, jobCanceled)
+	waitStatus(j2.ID, jobCanceled)
+	do(http.MethodDelete, "/jobs/"+j1.ID, "", http.StatusConflict, nil)
+	do(http.MethodDelete, "/jobs/unknown", "", http.StatusNotFound, nil)
+
+	var j3, j4 adviseJob
+	do(http.MethodPost, "/jobs", `{"dsn": "fail"}`, http.StatusAccepted, &j3)
+	waitStatus(j3.ID, jobFailed)
+	do(http.MethodPost, "/jobs", `{"dsn": "root:@tcp(127.0.0.1:4000)/test"}`, http.StatusAccepted, &j4)
+	close(block)
+	waitStatus(j4.ID, jobSucceeded)
+	var report adviseReport
+	do(http.MethodGet, "/jobs/"+j4.ID+"/report", "", http.StatusOK, &report)
+	mustTrue(len(report.Indexes) == 1, report)
+
+	var jobs []adviseJob
+	do(http.MethodGet, "/jobs", "", http.StatusOK, &jobs)
+	mustTrue(len(jobs) == 4, jobs)
+
+	// closing the manager cancels running jobs
+	m2 := newAdviseJobManager(1, 1, func(ctx context.Context, req adviseJobRequest) (*adviseReport, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	j5, err := m2.submit(adviseJobRequest{DSN: "root:@tcp(127.0.0.1:4000)/test"})
+	must(err)
+	for i := 0; i < 100; i++ {
+		if j, _ := m2.get(j5.ID); j.Status == jobRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	m2.close()
+	j5, _ = m2.get(j5.ID)
+	mustTrue(j5.Status == jobCanceled, j5)
+}
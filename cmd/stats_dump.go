@@ -0,0 +1,407 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tipb/go-tipb"
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+)
+
+// statsDumpTable is the table statistics in the same JSON format as the TiDB stats dump API `/stats/dump/{db}/{table}`,
+// which can be loaded by `LOAD STATS`.
+type statsDumpTable struct {
+	DatabaseName      string                      `json:"database_name"`
+	TableName         string                      `json:"table_name"`
+	Columns           map[string]*statsDumpColumn `json:"columns"`
+	Indices           map[string]*statsDumpColumn `json:"indices"`
+	ExtStats          []any                       `json:"ext_stats"`
+	Count             int64                       `json:"count"`
+	ModifyCount       int64                       `json:"modify_count"`
+	Partitions        map[string]*statsDumpTable  `json:"partitions"`
+	Version           uint64                      `json:"version"`
+	IsHistoricalStats bool                        `json:"is_historical_stats"`
+}
+
+// statsDumpColumn is the statistics of a column or an index.
+type statsDumpColumn struct {
+	Histogram         *statsDumpHistogram `json:"histogram"`
+	CMSketch          *tipb.CMSketch      `json:"cm_sketch"`
+	FMSketch          *tipb.FMSketch      `json:"fm_sketch"`
+	StatsVer          *int64              `json:"stats_ver"`
+	NullCount         int64               `json:"null_count"`
+	TotColSize        int64               `json:"tot_col_size"`
+	LastUpdateVersion uint64              `json:"last_update_version"`
+	Correlation       float64             `json:"correlation"`
+}
+
+type statsDumpHistogram struct {
+	NDV     int64             `json:"ndv"`
+	Buckets []statsDumpBucket `json:"buckets,omitempty"`
+}
+
+type statsDumpBucket struct {
+	Count      int64  `json:"count"`
+	LowerBound []byte `json:"lower_bound,omitempty"`
+	UpperBound []byte `json:"upper_bound,omitempty"`
+	Repeats    int64  `json:"repeats"`
+	NDV        int64  `json:"ndv"`
+}
+
+// histKey identifies a histogram in `mysql.stats_*` tables.
+type histKey struct {
+	isIndex int
+	histID  int64
+}
+
+// dumpTableStatsBySQL reconstructs the stats dump JSON of the table, which only requires the SQL port instead of the
+// status port. Index statistics are read from `mysql.stats_histograms`, `mysql.stats_buckets` and `mysql.stats_top_n`
+// by index IDs, and column statistics are read from `SHOW STATS_HISTOGRAMS`, `SHOW STATS_BUCKETS` and `SHOW STATS_TOPN`
+// by column names, since column IDs are not exposed through SQL.
+func dumpTableStatsBySQL(db optimizer.WhatIfOptimizer, table utils.TableName) ([]byte, error) {
+	tableID, err := queryInt64(db, fmt.Sprintf(`select tidb_table_id from information_schema.tables where table_schema=%v and table_name=%v`,
+		utils.QuoteSQLString(table.SchemaName), utils.QuoteSQLString(table.TableName)))
+	if err != nil {
+		return nil, fmt.Errorf("fail to get the id of table %v: %v", table.Key(), err)
+	}
+	indexNames := make(map[int64]string)
+	if err := queryRows(db, fmt.Sprintf(`select distinct key_name, index_id from information_schema.tidb_indexes where table_schema=%v and table_name=%v`,
+		utils.QuoteSQLString(table.SchemaName), utils.QuoteSQLString(table.TableName)), func(rows *sql.Rows) error {
+		var name string
+		var id int64
+		if err := rows.Scan(&name, &id); err != nil {
+			return err
+		}
+		indexNames[id] = strings.ToLower(name)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	partitionIDs := make(map[string]int64)
+	if err := queryRows(db, fmt.Sprintf(`select partition_name, tidb_partition_id from information_schema.partitions where table_schema=%v and table_name=%v and partition_name is not null`,
+		utils.QuoteSQLString(table.SchemaName), utils.QuoteSQLString(table.TableName)), func(rows *sql.Rows) error {
+		var name string
+		var id int64
+		if err := rows.Scan(&name, &id); err != nil {
+			return err
+		}
+		partitionIDs[name] = id
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	schema, err := getTableSchema(db, table.SchemaName, table.TableName)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := sessionLocation(db)
+	if err != nil {
+		return nil, err
+	}
+	partition := ""
+	if len(partitionIDs) > 0 {
+		partition = "global" // global statistics of partitioned tables
+	}
+	stats, err := dumpStatsByID(db, schema, loc, tableID, partition, indexNames)
+	if err != nil {
+		return nil, err
+	}
+	if len(partitionIDs) > 0 {
+		stats.Partitions = make(map[string]*statsDumpTable)
+		for name, id := range partitionIDs {
+			if stats.Partitions[name], err = dumpStatsByID(db, schema, loc, id, name, indexNames); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(stats)
+}
+
+// dumpStatsByID reconstructs statistics of the table or partition with the specified physical ID.
+func dumpStatsByID(db optimizer.WhatIfOptimizer, table utils.TableSchema, loc *time.Location, physicalID int64, partition string, indexNames map[int64]string) (*statsDumpTable, error) {
+	stats := &statsDumpTable{
+		DatabaseName: table.SchemaName,
+		TableName:    table.TableName,
+		Columns:      make(map[string]*statsDumpColumn),
+		Indices:      make(map[string]*statsDumpColumn),
+	}
+	if err := queryRows(db, fmt.Sprintf(`select version, modify_count, count from mysql.stats_meta where table_id=%v`, physicalID),
+		func(rows *sql.Rows) error {
+			return rows.Scan(&stats.Version, &stats.ModifyCount, &stats.Count)
+		}); err != nil {
+		return nil, err
+	}
+
+	hists := make(map[histKey]*statsDumpColumn)
+	if err := queryRows(db, fmt.Sprintf(`select is_index, hist_id, distinct_count, null_count, tot_col_size, version, cm_sketch, stats_ver, correlation
+from mysql.stats_histograms where table_id=%v`, physicalID), func(rows *sql.Rows) error {
+		var k histKey
+		var ndv, statsVer int64
+		var cmSketch []byte
+		c := new(statsDumpColumn)
+		if err := rows.Scan(&k.isIndex, &k.histID, &ndv, &c.NullCount, &c.TotColSize, &c.LastUpdateVersion, &cmSketch, &statsVer, &c.Correlation); err != nil {
+			return err
+		}
+		c.Histogram = &statsDumpHistogram{NDV: ndv}
+		c.StatsVer = &statsVer
+		if len(cmSketch) > 0 {
+			c.CMSketch = new(tipb.CMSketch)
+			if err := c.CMSketch.Unmarshal(cmSketch); err != nil {
+				return fmt.Errorf("invalid cm_sketch of histogram %v: %v", k.histID, err)
+			}
+		}
+		hists[k] = c
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := queryRows(db, fmt.Sprintf(`select is_index, hist_id, count, repeats, lower_bound, upper_bound, ndv
+from mysql.stats_buckets where table_id=%v and is_index=1 order by hist_id, bucket_id`, physicalID), func(rows *sql.Rows) error {
+		var k histKey
+		var b statsDumpBucket
+		if err := rows.Scan(&k.isIndex, &k.histID, &b.Count, &b.Repeats, &b.LowerBound, &b.UpperBound, &b.NDV); err != nil {
+			return err
+		}
+		if c, ok := hists[k]; ok {
+			c.Histogram.Buckets = append(c.Histogram.Buckets, b)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := queryRows(db, fmt.Sprintf(`select is_index, hist_id, value, count from mysql.stats_top_n where table_id=%v and is_index=1 order by hist_id, value`, physicalID),
+		func(rows *sql.Rows) error {
+			var k histKey
+			topN := new(tipb.CMSketchTopN)
+			if err := rows.Scan(&k.isIndex, &k.histID, &topN.Data, &topN.Count); err != nil {
+				return err
+			}
+			if c, ok := hists[k]; ok {
+				if c.CMSketch == nil {
+					c.CMSketch = new(tipb.CMSketch)
+				}
+				c.CMSketch.TopN = append(c.CMSketch.TopN, topN)
+			}
+			return nil
+		}); err != nil {
+		return nil, err
+	}
+
+	var statsVer int64
+	var version uint64
+	for k, c := range hists {
+		if k.isIndex == 1 {
+			if name, ok := indexNames[k.histID]; ok {
+				stats.Indices[name] = c
+			}
+		} else { // columns are analyzed together, use their versions for columns read by names
+			if *c.StatsVer > statsVer {
+				statsVer = *c.StatsVer
+			}
+			if c.LastUpdateVersion > version {
+				version = c.LastUpdateVersion
+			}
+		}
+	}
+
+	cond := fmt.Sprintf(`db_name=%v and table_name=%v and partition_name=%v and is_index=0`,
+		utils.QuoteSQLString(table.SchemaName), utils.QuoteSQLString(table.TableName), utils.QuoteSQLString(partition))
+	var histRows, bucketRows, topNRows []map[string]sql.NullString
+	for _, q := range []struct {
+		stmt string
+		rows *[]map[string]sql.NullString
+	}{{"show stats_histograms", &histRows}, {"show stats_buckets", &bucketRows}, {"show stats_topn", &topNRows}} {
+		if err := queryNamedRows(db, q.stmt+" where "+cond, func(row map[string]sql.NullString) error {
+			*q.rows = append(*q.rows, row)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	columns, err := columnStatsFromShowRows(table, loc, stats.Count, histRows, bucketRows, topNRows)
+	if err != nil {
+		return nil, err
+	}
+	for name, c := range columns {
+		c.StatsVer, c.LastUpdateVersion = &statsVer, version
+		stats.Columns[name] = c
+	}
+	return stats, nil
+}
+
+// columnStatsFromShowRows builds column statistics from rows of `SHOW STATS_HISTOGRAMS`, `SHOW STATS_BUCKETS` and
+// `SHOW STATS_TOPN`, rows are maps from lower-case column names to values.
+// Bucket bounds of columns are shown in raw, while TopN values are decoded, so they are encoded again by column types,
+// timestamps are shown in the session time zone loc. The total size of a column is derived from its average size.
+func columnStatsFromShowRows(table utils.TableSchema, loc *time.Location, count int64, histRows, bucketRows, topNRows []map[string]sql.NullString) (map[string]*statsDumpColumn, error) {
+	columns := make(map[string]*statsDumpColumn)
+	for _, row := range histRows {
+		c := &statsDumpColumn{Histogram: new(statsDumpHistogram)}
+		var avgColSize float64
+		if _, err := fmt.Sscan(row["distinct_count"].String+" "+row["null_count"].String+" "+row["avg_col_size"].String+" "+row["correlation"].String,
+			&c.Histogram.NDV, &c.NullCount, &avgColSize, &c.Correlation); err != nil {
+			return nil, fmt.Errorf("invalid histogram of %v.%v: %v", table.Key(), row["column_name"].String, err)
+		}
+		c.TotColSize = int64(math.Round(avgColSize * float64(count)))
+		columns[strings.ToLower(row["column_name"].String)] = c
+	}
+	for _, row := range bucketRows {
+		c, ok := columns[strings.ToLower(row["column_name"].String)]
+		if !ok {
+			continue
+		}
+		b := statsDumpBucket{LowerBound: []byte(row["lower_bound"].String), UpperBound: []byte(row["upper_bound"].String)}
+		if _, err := fmt.Sscan(row["count"].String+" "+row["repeats"].String+" "+row["ndv"].String, &b.Count, &b.Repeats, &b.NDV); err != nil {
+			return nil, fmt.Errorf("invalid bucket of %v.%v: %v", table.Key(), row["column_name"].String, err)
+		}
+		c.Histogram.Buckets = append(c.Histogram.Buckets, b)
+	}
+	for _, row := range topNRows {
+		name := strings.ToLower(row["column_name"].String)
+		c, ok := columns[name]
+		if !ok {
+			continue
+		}
+		col, ok := findColumn(table, name)
+		if !ok {
+			continue
+		}
+		data, err := encodeStatsValue(col, row["value"].String, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TopN value %v of %v.%v: %v", row["value"].String, table.Key(), name, err)
+		}
+		topN := &tipb.CMSketchTopN{Data: data}
+		if _, err := fmt.Sscan(row["count"].String, &topN.Count); err != nil {
+			return nil, fmt.Errorf("invalid TopN count of %v.%v: %v", table.Key(), name, err)
+		}
+		if c.CMSketch == nil {
+			c.CMSketch = new(tipb.CMSketch)
+		}
+		c.CMSketch.TopN = append(c.CMSketch.TopN, topN)
+	}
+	return columns, nil
+}
+
+func findColumn(table utils.TableSchema, name string) (utils.Column, bool) {
+	for _, col := range table.Columns {
+		if strings.EqualFold(col.ColumnName, name) {
+			return col, true
+		}
+	}
+	return utils.Column{}, false
+}
+
+// encodeStatsValue encodes the value shown by `SHOW STATS_TOPN` in the same way as TopN values of the column in statistics.
+func encodeStatsValue(col utils.Column, value string, loc *time.Location) ([]byte, error) {
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	d := types.NewBytesDatum([]byte(value))
+	if col.ColumnType != nil && !types.IsString(col.ColumnType.Tp) {
+		var err error
+		str := types.NewStringDatum(value)
+		if d, err = str.ConvertTo(sc, col.ColumnType); err != nil {
+			return nil, err
+		}
+		if col.ColumnType.Tp == mysql.TypeTimestamp { // timestamps are stored in UTC
+			t := d.GetMysqlTime()
+			if err := t.ConvertTimeZone(loc, time.UTC); err != nil {
+				return nil, err
+			}
+			d.SetMysqlTime(t)
+		}
+	}
+	return codec.EncodeKey(sc, nil, d)
+}
+
+// sessionLocation returns the time zone of the session, which is used to show timestamps.
+func sessionLocation(db optimizer.WhatIfOptimizer) (*time.Location, error) {
+	var tz, systemTZ string
+	if err := queryRows(db, `select @@time_zone, @@system_time_zone`, func(rows *sql.Rows) error {
+		return rows.Scan(&tz, &systemTZ)
+	}); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(tz, "SYSTEM") {
+		tz = systemTZ
+	}
+	if t, err := time.Parse("-07:00", tz); err == nil { // an offset like '+08:00'
+		_, offset := t.Zone()
+		return time.FixedZone(tz, offset), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		utils.Warningf("unknown time zone %v, use UTC instead: %v", tz, err)
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+func queryInt64(db optimizer.WhatIfOptimizer, q string) (int64, error) {
+	var v int64
+	found := false
+	err := queryRows(db, q, func(rows *sql.Rows) error {
+		found = true
+		return rows.Scan(&v)
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("no result for %v", q)
+	}
+	return v, err
+}
+
+func queryRows(db optimizer.WhatIfOptimizer, q string, f func(rows *sql.Rows) error) error {
+	rows, err := db.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// queryNamedRows is like queryRows but passes each row as a map from lower-case column names to values.
+func queryNamedRows(db optimizer.WhatIfOptimizer, q string, f func(row map[string]sql.NullString) error) error {
+	rows, err := db.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	fields, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(fields))
+		dest := make([]any, len(fields))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		row := make(map[string]sql.NullString, len(fields))
+		for i, f := range fields {
+			row[strings.ToLower(f)] = values[i]
+		}
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+)
+
+func TestDumpTableStatsBySQL(t *testing.T) {
+	server, err := utils.StartLocalTiDBServer("nightly")
+	must(err)
+	defer server.Release()
+	db, err := optimizer.NewTiDBWhatIfOptimizer(server.DSN())
+	must(err)
+
+	must(db.Execute(`use test`))
+	must(db.Execute(`create table t (a int, b varchar(32), c int, d int, key ka(a), key kbc(b, c))`))
+	for i := 0; i < 100; i++ {
+		must(db.Execute(fmt.Sprintf(`insert into t values (%v, 'b%v', %v, %v)`, i%10, i%7, i, 99-i)))
+	}
+	must(db.Execute(`analyze table t`)) // c and d have the same histograms but different correlations
+
+	histograms := func() []string {
+		rows, err := db.Query(`show stats_histograms where db_name='test' and table_name='t'`)
+		must(err)
+		defer rows.Close()
+		cols, err := rows.Columns()
+		must(err)
+		var result []string
+		for rows.Next() {
+			vals := make([]interface{}, len(cols))
+			for i := range vals {
+				vals[i] = new(sql.NullString)
+			}
+			must(rows.Scan(vals...))
+			var fields []string
+			for i, col := range cols {
+				switch strings.ToLower(col) {
+				case "column_name", "is_index", "distinct_count", "null_count", "avg_col_size", "correlation":
+					fields = append(fields, vals[i].(*sql.NullString).String)
+				}
+			}
+			result = append(result, strings.Join(fields, ","))
+		}
+		sort.Strings(result)
+		return result
+	}
+	before := histograms()
+	mustTrue(len(before) == 6, fmt.Sprintf("%v", before))
+
+	stats, err := dumpTableStatsBySQL(db, utils.TableName{SchemaName: "test", TableName: "t"})
+	must(err)
+	statsDir := t.TempDir()
+	must(utils.SaveContentTo(fmt.Sprintf("%v/test_t.json", statsDir), string(stats)))
+
+	// drop the original stats and load the dumped ones back, their histograms should be the same
+	must(db.Execute(`drop stats t`))
+	must(loadStatsIntoCluster(db, statsDir))
+	after := histograms()
+	mustTrue(strings.Join(before, ";") == strings.Join(after, ";"), fmt.Sprintf("%v != %v", before, after))
+}
+
+func TestColumnStatsFromShowRows(t *testing.T) {
+	// examples/job/stats/comp_cast_type.json is dumped by TiDB, rebuild its columns from what SHOW STATS_xxx returns
+	fixture := "../examples/job/stats/comp_cast_type.json"
+	tableName, err := getStatsFileTableName(fixture)
+	must(err)
+	mustTrue(tableName.Key() == "imdbload_no_fk.comp_cast_type", tableName)
+	data, err := os.ReadFile(fixture)
+	must(err)
+	expected := new(statsDumpTable)
+	must(json.Unmarshal(data, expected))
+	out, err := json.Marshal(expected) // all fields loaded by LOAD STATS are kept
+	must(err)
+	mustTrue(jsonEqual(data, out), string(out))
+
+	table, err := utils.ParseCreateTableStmt("imdbload_no_fk", "create table comp_cast_type (id int not null, kind varchar(32) not null)")
+	must(err)
+	row := func(kv ...string) map[string]sql.NullString {
+		m := make(map[string]sql.NullString)
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = sql.NullString{String: kv[i+1], Valid: true}
+		}
+		return m
+	}
+	histRows := []map[string]sql.NullString{
+		row("column_name", "id", "distinct_count", "4", "null_count", "0", "avg_col_size", "8", "correlation", "1"),
+		row("column_name", "kind", "distinct_count", "4", "null_count", "0", "avg_col_size", "9.25", "correlation", "0.4"),
+	}
+	var topNRows []map[string]sql.NullString
+	for _, v := range []string{"1", "2", "3", "4"} {
+		topNRows = append(topNRows, row("column_name", "id", "value", v, "count", "1"))
+	}
+	for _, v := range []string{"cast", "complete", "complete+verified", "crew"} {
+		topNRows = append(topNRows, row("column_name", "kind", "value", v, "count", "1"))
+	}
+	columns, err := columnStatsFromShowRows(table, time.UTC, expected.Count, histRows, nil, topNRows)
+	must(err)
+	for name, c := range columns {
+		c.StatsVer, c.LastUpdateVersion = expected.Columns[name].StatsVer, expected.Columns[name].LastUpdateVersion
+	}
+	got, err := json.Marshal(columns)
+	must(err)
+	want, err := json.Marshal(expected.Columns)
+	must(err)
+	mustTrue(jsonEqual(got, want), string(got), string(want))
+
+	// timestamps are shown in the session time zone but encoded in UTC
+	table, err = utils.ParseCreateTableStmt("test", "create table t (ts timestamp, b varchar(10))")
+	must(err)
+	columns, err = columnStatsFromShowRows(table, time.FixedZone("+08:00", 8*3600), 10,
+		[]map[string]sql.NullString{row("column_name", "ts", "distinct_count", "1", "null_count", "0", "avg_col_size", "8", "correlation", "1")},
+		[]map[string]sql.NullString{row("column_name", "ts", "count", "10", "repeats", "10", "lower_bound", "2023-01-01 00:00:00", "upper_bound", "2023-01-01 00:00:00", "ndv", "0")},
+		[]map[string]sql.NullString{row("column_name", "ts", "value", "2023-01-01 08:00:00", "count", "10")})
+	must(err)
+	ts := types.NewTime(types.FromDate(2023, 1, 1, 0, 0, 0, 0), mysql.TypeTimestamp, 0)
+	key, err := codec.EncodeKey(&stmtctx.StatementContext{TimeZone: time.UTC}, nil, types.NewTimeDatum(ts))
+	must(err)
+	c := columns["ts"]
+	mustTrue(len(c.CMSketch.TopN) == 1 && string(c.CMSketch.TopN[0].Data) == string(key), c.CMSketch.TopN)
+	mustTrue(len(c.Histogram.Buckets) == 1 && string(c.Histogram.Buckets[0].UpperBound) == "2023-01-01 00:00:00" && c.TotColSize == 80, c)
+}
+
+// jsonEqual returns whether two JSON documents have the same content.
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
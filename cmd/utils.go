@@ -1,59 +1,88 @@
 package cmd
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/qw4990/index_advisor/optimizer"
 	"github.com/qw4990/index_advisor/utils"
 )
 
-// loadWorkloadIntoCluster loads the schema the TiDB cluster
-func loadSchemaIntoCluster(db optimizer.WhatIfOptimizer, schemaFilePath string) (dbName string, err error) {
+// loadSchemaIntoCluster loads the schema into the TiDB cluster, databases that are used but not created are created
+// automatically. It returns the database of the last `USE` statement and all databases in the schema file.
+func loadSchemaIntoCluster(db optimizer.WhatIfOptimizer, schemaFilePath string) (dbName string, dbNames []string, err error) {
 	if schemaFilePath == "" {
-		return "", nil
+		return "", nil, nil
 	}
 	utils.Infof("load schema info from %v into the TiDB instance", schemaFilePath)
-	rawSQLs, err := utils.ParseStmtsFromFile(schemaFilePath)
+	stmts, err := utils.ParseScriptFromFile(schemaFilePath)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	if len(rawSQLs) == 0 {
-		return "", nil
+	if len(stmts) == 0 {
+		return "", nil, nil
 	}
 
 	currentDB := "test" // the default DB `test`
-	for _, stmt := range rawSQLs {
-		switch utils.GetStmtType(stmt) {
+	addDB := func(name string) {
+		for _, n := range dbNames {
+			if strings.EqualFold(n, name) {
+				return
+			}
+		}
+		dbNames = append(dbNames, name)
+	}
+	for _, stmt := range stmts {
+		stmtType, err := utils.GetStmtType(stmt.Text)
+		if err != nil { // unsupported by the parser, let the TiDB instance decide whether it's valid
+			utils.Warningf("%v:%v: %v", schemaFilePath, stmt.Line, err)
+		}
+		switch stmtType {
 		case utils.StmtUseDB:
-			currentDB = utils.GetDBNameFromUseDBStmt(stmt)
+			currentDB = utils.GetDBNameFromUseDBStmt(stmt.Text)
+			exist, err := dbExists(currentDB, db)
+			if err != nil {
+				return "", nil, err
+			}
+			if !exist {
+				utils.Infof("create database %s", currentDB)
+				if err := db.Execute("create database " + utils.QuoteSQLIdentifier(currentDB)); err != nil {
+					return "", nil, fmt.Errorf("%v:%v: %v", schemaFilePath, stmt.Line, err)
+				}
+			}
+			addDB(currentDB)
 		case utils.StmtCreateDB:
-			dbName := utils.GetDBNameFromCreateDBStmt(stmt)
+			dbName := utils.GetDBNameFromCreateDBStmt(stmt.Text)
+			addDB(dbName)
 			exist, err := dbExists(dbName, db)
 			if err != nil {
-				return "", err
+				return "", nil, err
 			}
 			if exist {
 				continue
 			}
 		case utils.StmtCreateTable:
-			table, err := utils.ParseCreateTableStmt(currentDB, stmt)
+			table, err := utils.ParseCreateTableStmt(currentDB, stmt.Text)
 			if err != nil {
-				return "", err
+				return "", nil, fmt.Errorf("%v:%v: %v", schemaFilePath, stmt.Line, err)
 			}
+			addDB(currentDB)
 			utils.Infof("create table %s.%s", table.SchemaName, table.TableName)
 		}
-		if err := db.Execute(stmt); err != nil {
-			return "", err
+		if err := db.Execute(stmt.Text); err != nil {
+			return "", nil, fmt.Errorf("%v:%v: %v", schemaFilePath, stmt.Line, err)
 		}
 	}
-	return currentDB, nil
+	return currentDB, dbNames, nil
 }
 
 // loadStatsIntoCluster loads the stats into the TiDB cluster
@@ -129,7 +158,7 @@ func tableExists(schemaName, tableName string, db optimizer.WhatIfOptimizer) (bo
 }
 
 func dbExists(schemaName string, db optimizer.WhatIfOptimizer) (bool, error) {
-	q := fmt.Sprintf("select count(*) from INFORMATION_SCHEMA.SCHEMATA where lower(SCHEMA_NAME) = '%s'", strings.ToLower(schemaName))
+	q := fmt.Sprintf("select count(*) from INFORMATION_SCHEMA.SCHEMATA where lower(SCHEMA_NAME) = %s", utils.QuoteSQLString(strings.ToLower(schemaName)))
 	r, err := db.Query(q)
 	if err != nil {
 		return false, err
@@ -175,54 +204,313 @@ func redactLogEnabled(db optimizer.WhatIfOptimizer) bool {
 	return false
 }
 
+// stmtSummaryRecord is a record of a statement in one statement summary window.
+type stmtSummaryRecord struct {
+	SchemaName string
+	Digest     string
+	Text       string
+	ExecCount  int
+	AvgLatency float64 // in nanoseconds
+	BeginTime  string  // SUMMARY_BEGIN_TIME of the window
+	Age        int     // seconds between SUMMARY_END_TIME of the window and now
+}
+
+// readQueriesFromStatementSummary reads queries from the statement summary tables. Records of the same statement in
+// different windows are aggregated by digest and schema.
+// timeRange is either a duration like '24h', which means the recent 24 hours, or two timestamps like
+// '2023-08-01 00:00:00,2023-08-02 00:00:00'; windows overlapping with this range will be considered.
+// If recencyHalfLife is positive, the execution count of each window is weighted by 0.5^(age/recencyHalfLife),
+// which makes recent windows have more influence on the result.
 func readQueriesFromStatementSummary(db optimizer.WhatIfOptimizer, querySchemas []string,
-	queryExecTimeThreshold, queryExecCountThreshold int) (utils.Set[utils.Query], error) {
+	queryExecTimeThreshold, queryExecCountThreshold int, timeRange string, recencyHalfLife time.Duration) (utils.Set[utils.Query], error) {
 	var condition []string
 	condition = append(condition, "stmt_type='Select'")
 	if len(querySchemas) > 0 {
 		condition = append(condition, fmt.Sprintf("SCHEMA_NAME in ('%s')", strings.Join(querySchemas, "', '")))
 	}
-	if queryExecTimeThreshold > 0 {
-		condition = append(condition, fmt.Sprintf("AVG_LATENCY >= %v", queryExecTimeThreshold*1000))
-	}
-	if queryExecCountThreshold > 0 {
-		condition = append(condition, fmt.Sprintf("EXEC_COUNT >= %v", queryExecCountThreshold))
+	timeConds, err := timeRangeConditions(timeRange)
+	if err != nil {
+		return nil, err
 	}
+	condition = append(condition, timeConds...)
 
-	s := utils.NewSet[utils.Query]()
+	var records []stmtSummaryRecord
 	for _, table := range []string{
 		`information_schema.statements_summary`,
 		`information_schema.statements_summary_history`,
 	} {
-		// TODO: consider Execute statements
-		q := fmt.Sprintf(`select SCHEMA_NAME, DIGEST, QUERY_SAMPLE_TEXT, EXEC_COUNT, AVG_LATENCY from %v where %v`,
-			table, strings.Join(condition, " AND "))
+		// prepared statements are recorded with their underlying statement types, and their sample texts contain
+		// `?` parameter markers and arguments, which are bound below.
+		q := fmt.Sprintf(`select SCHEMA_NAME, DIGEST, QUERY_SAMPLE_TEXT, EXEC_COUNT, AVG_LATENCY, SUMMARY_BEGIN_TIME,
+       timestampdiff(second, SUMMARY_END_TIME, now()) from %v where %v`, table, strings.Join(condition, " AND "))
 		rows, err := db.Query(q)
 		if err != nil {
 			return nil, err
 		}
 		for rows.Next() {
-			var schemaName, digest, text, execCountStr, avgLatStr string
-			if err := rows.Scan(&schemaName, &digest, &text, &execCountStr, &avgLatStr); err != nil {
+			var schemaName, digest, text, execCountStr, avgLatStr, beginTime, ageStr string
+			if err := rows.Scan(&schemaName, &digest, &text, &execCountStr, &avgLatStr, &beginTime, &ageStr); err != nil {
 				return nil, err
 			}
 			execCount, err := strconv.Atoi(execCountStr)
 			if err != nil {
 				return nil, err
 			}
-			// TODO: skip this query if it has '?' when redact log is enabled.
-			s.Add(utils.Query{
-				Alias:      digest,
+			avgLat, err := strconv.ParseFloat(avgLatStr, 64)
+			if err != nil {
+				return nil, err
+			}
+			age, err := strconv.Atoi(ageStr)
+			if err != nil {
+				return nil, err
+			}
+			// arguments are not recorded when redact log is enabled, these queries are bound by bindQueryParams later.
+			if sqlText, args := utils.ExtractPreparedArguments(text); args != nil {
+				text = sqlText
+				if boundSQL, err := utils.BindParams(sqlText, args); err == nil {
+					text = boundSQL
+				}
+			}
+			records = append(records, stmtSummaryRecord{
 				SchemaName: schemaName,
+				Digest:     digest,
 				Text:       text,
-				Frequency:  execCount,
+				ExecCount:  execCount,
+				AvgLatency: avgLat,
+				BeginTime:  beginTime,
+				Age:        age,
 			})
 		}
 		if err := rows.Close(); err != nil {
 			return nil, err
 		}
 	}
-	return s, nil
+	return aggregateStmtSummaryRecords(records, queryExecTimeThreshold, queryExecCountThreshold, recencyHalfLife), nil
+}
+
+// timeRangeConditions returns the conditions on statement summary tables for the specified time range.
+func timeRangeConditions(timeRange string) ([]string, error) {
+	timeRange = strings.TrimSpace(timeRange)
+	if timeRange == "" {
+		return nil, nil
+	}
+	if !strings.Contains(timeRange, ",") {
+		d, err := time.ParseDuration(timeRange)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time range %v: %v", timeRange, err)
+		}
+		return []string{fmt.Sprintf("SUMMARY_END_TIME >= now() - interval %v second", int(d.Seconds()))}, nil
+	}
+
+	const layout = "2006-01-02 15:04:05"
+	parts := strings.Split(timeRange, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid time range %v", timeRange)
+	}
+	var conds []string
+	var begin, end time.Time
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" { // open range
+			continue
+		}
+		t, err := time.Parse(layout, part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time range %v: %v", timeRange, err)
+		}
+		if i == 0 {
+			begin = t
+			conds = append(conds, fmt.Sprintf("SUMMARY_END_TIME > '%v'", part))
+		} else {
+			end = t
+			conds = append(conds, fmt.Sprintf("SUMMARY_BEGIN_TIME < '%v'", part))
+		}
+	}
+	if !begin.IsZero() && !end.IsZero() && !begin.Before(end) {
+		return nil, fmt.Errorf("invalid time range %v: the begin time should be before the end time", timeRange)
+	}
+	return conds, nil
+}
+
+// groupStmtSummaryRecords groups statement summary records by digest and schema, the key is 'schema|digest',
+// and keys are returned in the order they first appear.
+func groupStmtSummaryRecords(records []stmtSummaryRecord) (keys []string, groups map[string][]stmtSummaryRecord) {
+	groups = make(map[string][]stmtSummaryRecord)
+	visited := make(map[string]bool)
+	for _, r := range records {
+		// the current window may appear in both statements_summary and statements_summary_history
+		windowKey := fmt.Sprintf("%v|%v|%v", r.SchemaName, r.Digest, r.BeginTime)
+		if visited[windowKey] {
+			continue
+		}
+		visited[windowKey] = true
+		key := r.SchemaName + "|" + r.Digest
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	return keys, groups
+}
+
+// aggregateStmtSummaryRecords aggregates statement summary records by digest and schema.
+func aggregateStmtSummaryRecords(records []stmtSummaryRecord, queryExecTimeThreshold, queryExecCountThreshold int,
+	recencyHalfLife time.Duration) utils.Set[utils.Query] {
+	type stmtStats struct {
+		record          stmtSummaryRecord // the most recent record
+		execCount       int
+		weightExecCount float64
+		totLatency      float64
+	}
+	keys, groups := groupStmtSummaryRecords(records)
+	stats := make(map[string]*stmtStats)
+	for _, key := range keys {
+		s := &stmtStats{record: groups[key][0]}
+		stats[key] = s
+		for _, r := range groups[key] {
+			weight := 1.0
+			if recencyHalfLife > 0 && r.Age > 0 {
+				weight = math.Pow(0.5, float64(r.Age)/recencyHalfLife.Seconds())
+			}
+			// prefer the most recent record whose parameters are bound
+			if rBound, sBound := !utils.HasParamMarkers(r.Text), !utils.HasParamMarkers(s.record.Text); (rBound && !sBound) ||
+				(rBound == sBound && r.Age < s.record.Age) {
+				s.record = r
+			}
+			s.execCount += r.ExecCount
+			s.weightExecCount += float64(r.ExecCount) * weight
+			s.totLatency += r.AvgLatency * float64(r.ExecCount)
+		}
+	}
+
+	queries := utils.NewSet[utils.Query]()
+	for _, key := range keys {
+		s := stats[key]
+		if queryExecCountThreshold > 0 && s.execCount < queryExecCountThreshold {
+			continue
+		}
+		if queryExecTimeThreshold > 0 && s.totLatency < float64(queryExecTimeThreshold*1000)*float64(s.execCount) {
+			continue
+		}
+		q := utils.Query{
+			Alias:      s.record.Digest,
+			SchemaName: s.record.SchemaName,
+			Text:       s.record.Text,
+			Frequency:  utils.Max(int(math.Round(s.weightExecCount)), 1),
+			AvgLatency: s.totLatency / float64(utils.Max(s.execCount, 1)) / 1e6,
+		}
+		if existing, ok := queries.Find(q); ok { // the same text and schema with different digests
+			q.Frequency += existing.Frequency
+		}
+		queries.Add(q)
+	}
+	return queries
+}
+
+// bindQueryParams binds `?` parameter markers in queries, which come from prepared statements, with the middle
+// values of histograms of the corresponding columns. Markers that are not compared with any column or whose columns
+// have no statistics are bound with 1.
+func bindQueryParams(db optimizer.WhatIfOptimizer, queries utils.Set[utils.Query]) (utils.Set[utils.Query], error) {
+	midValues := make(map[string]string) // column --> the middle value of its histogram
+	result := utils.NewSet[utils.Query]()
+	for _, q := range queries.ToList() {
+		if !utils.HasParamMarkers(q.Text) {
+			result.Add(q)
+			continue
+		}
+		cols, err := utils.ParseParamMarkerColumns(q)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]string, 0, len(cols))
+		for _, col := range cols {
+			arg := "1"
+			if col.ColumnName != "" {
+				v, ok := midValues[col.Key()]
+				if !ok {
+					if v, err = histogramMidValue(db, col); err != nil {
+						return nil, err
+					}
+					midValues[col.Key()] = v
+				}
+				if v != "" {
+					arg = v
+				}
+			}
+			args = append(args, arg)
+		}
+		text, err := utils.BindParams(q.Text, args)
+		if err != nil {
+			return nil, err
+		}
+		utils.Debugf("bind parameters of query %v: %v", q.Alias, text)
+		q.Text = text
+		if existing, ok := result.Find(q); ok {
+			q.Frequency += existing.Frequency
+		}
+		result.Add(q)
+	}
+	return result, nil
+}
+
+// histogramMidValue returns the upper bound of the middle bucket in the histogram of the column as a SQL literal,
+// or an empty string if the column has no histogram.
+func histogramMidValue(db optimizer.WhatIfOptimizer, col utils.Column) (string, error) {
+	q := fmt.Sprintf(`show stats_buckets where db_name=%v and table_name=%v and column_name=%v and is_index=0`,
+		utils.QuoteSQLString(col.SchemaName), utils.QuoteSQLString(col.TableName), utils.QuoteSQLString(col.ColumnName))
+	rows, err := db.Query(q)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	fields, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	countIdx, upperIdx := -1, -1
+	for i, f := range fields {
+		switch strings.ToLower(f) {
+		case "count":
+			countIdx = i
+		case "upper_bound":
+			upperIdx = i
+		}
+	}
+	if countIdx == -1 || upperIdx == -1 {
+		return "", fmt.Errorf("unexpected result of %v: %v", q, fields)
+	}
+
+	var counts []int
+	var uppers []string
+	for rows.Next() {
+		values := make([]sql.NullString, len(fields))
+		dest := make([]any, len(fields))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		count, err := strconv.Atoi(values[countIdx].String)
+		if err != nil {
+			return "", err
+		}
+		counts = append(counts, count) // the count is cumulative
+		uppers = append(uppers, values[upperIdx].String)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(counts) == 0 {
+		return "", nil
+	}
+	total := counts[len(counts)-1]
+	for i, count := range counts {
+		if count*2 >= total {
+			return utils.QuoteSQLString(uppers[i]), nil
+		}
+	}
+	return utils.QuoteSQLString(uppers[len(uppers)-1]), nil
 }
 
 func readTableSchemas(db optimizer.WhatIfOptimizer, schemas []string) (utils.Set[utils.TableSchema], error) {
@@ -300,3 +588,20 @@ func filterSQLAccessingSystemTables(sqls utils.Set[utils.Query]) (utils.Set[util
 	}
 	return s, nil
 }
+
+// loadIndexesFromFile loads indexes from the DDL file, which contains `CREATE INDEX` statements with qualified table names.
+func loadIndexesFromFile(fpath string) (utils.Set[utils.Index], error) {
+	stmts, err := utils.ParseScriptFromFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	indexes := utils.NewSet[utils.Index]()
+	for _, stmt := range stmts {
+		index, err := utils.ParseCreateIndexStmt(stmt.Text)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fpath, stmt.Line, err)
+		}
+		indexes.Add(index)
+	}
+	return indexes, nil
+}
@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qw4990/index_advisor/advisor"
+	"github.com/qw4990/index_advisor/optimizer"
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type whatIfCmdOpt struct {
+	dsn         string
+	tidbVersion string
+	schemaPath  string
+	statsPath   string
+	dirPath     string
+	queryPath   string
+	logLevel    string
+}
+
+func NewWhatIfCmd() *cobra.Command {
+	var opt whatIfCmdOpt
+	cmd := &cobra.Command{
+		Use:   "what-if",
+		Short: "try hypothetical indexes on your workload interactively, use `index_advisor what-if --help` to see more details",
+		Long: `try hypothetical indexes on your workload interactively.
+How it work:
+1. connect to your TiDB cluster through the DSN, or start a local TiDB server and load the schema and statistics like 'advise-offline' if '--dsn' is not specified
+2. load the workload from '--query-path' or the 'load' command
+3. add or drop hypothetical indexes, and the cost of each query and the whole workload is re-printed after each change
+Type 'help' in the prompt to see all commands.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			db, defaultSchema, cleanup, err := openWhatIfOptimizer(&opt)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			session := &whatIfSession{db: db, defaultSchema: defaultSchema, out: cmd.OutOrStdout()}
+			if opt.queryPath != "" {
+				if err := session.exec("load " + opt.queryPath); err != nil {
+					return err
+				}
+			}
+			return session.run(cmd.InOrStdin())
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.dsn, "dsn", "", "the DSN of the TiDB cluster to connect, e.g. 'root:@tcp(127.0.0.1:4000)/test', a local TiDB server is started if it's empty")
+	cmd.Flags().StringVar(&opt.tidbVersion, "tidb-version", "nightly", "the version of the local TiDB server")
+	cmd.Flags().StringVar(&opt.schemaPath, "schema-path", "", "(optional) schema file path loaded into the local TiDB server, e.g. './examples/tpch_example1/schema.sql'")
+	cmd.Flags().StringVar(&opt.statsPath, "stats-path", "", "(optional) stats dictionary path loaded into the local TiDB server, e.g. './examples/tpch_example1/stats'")
+	cmd.Flags().StringVar(&opt.dirPath, "dir-path", "", "(optional) the dictionary path that contains queries, schema and stats, or a workload bundle exported by 'workload-export'")
+	cmd.Flags().StringVar(&opt.queryPath, "query-path", "", "(optional) the workload to load at the beginning, e.g. './examples/tpch_example1/queries'")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "warning", "log level, one of 'debug', 'info', 'warning', 'error'")
+	return cmd
+}
+
+// openWhatIfOptimizer connects to the cluster through the DSN, or starts a local TiDB server and loads the schema and
+// stats into it if the DSN is not specified. It returns the default schema of queries and a function to release all
+// resources. opt.queryPath is set to the query file in the workload directory if it's not specified.
+func openWhatIfOptimizer(opt *whatIfCmdOpt) (db optimizer.WhatIfOptimizer, defaultSchema string, cleanup func(), err error) {
+	var cleanups []func()
+	cleanup = func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	if opt.dsn != "" {
+		if _, defaultSchema = utils.GetDBNameFromDSN(opt.dsn); defaultSchema == "" {
+			return nil, "", cleanup, errors.New("database name is not specified in DSN")
+		}
+		if db, err = optimizer.NewTiDBWhatIfOptimizer(opt.dsn); err != nil {
+			return nil, "", cleanup, err
+		}
+		cleanups = append(cleanups, func() { db.Close() })
+		if reason := checkOnlineModeSupport(db); reason != "" {
+			return nil, "", cleanup, errors.New("hypothetical indexes are not supported on this cluster: " + reason)
+		}
+		return db, defaultSchema, cleanup, nil
+	}
+
+	s, db, err := startTiDB(opt.tidbVersion)
+	if s != nil {
+		cleanups = append(cleanups, func() { s.Release() })
+	}
+	if err != nil {
+		return nil, "", cleanup, err
+	}
+	cleanups = append(cleanups, func() { db.Close() })
+	if opt.dirPath != "" {
+		dir, dirCleanup, err := openWorkloadDir(opt.dirPath)
+		if err != nil {
+			return nil, "", cleanup, err
+		}
+		cleanups = append(cleanups, dirCleanup)
+		opt.schemaPath, opt.statsPath = path.Join(dir, "schema.sql"), path.Join(dir, "stats")
+		manifest, err := utils.LoadWorkloadManifest(dir)
+		if err != nil {
+			return nil, "", cleanup, err
+		}
+		if manifest != nil {
+			opt.schemaPath = path.Join(dir, manifest.SchemaFile)
+			if opt.queryPath == "" {
+				opt.queryPath = path.Join(dir, manifest.QueryFile)
+			}
+		}
+	}
+	if defaultSchema, err = loadWhatIfSchemaAndStats(db, *opt); err != nil {
+		return nil, "", cleanup, err
+	}
+	return db, defaultSchema, cleanup, nil
+}
+
+// loadWhatIfSchemaAndStats loads the schema and stats into the local TiDB server and returns the default schema.
+func loadWhatIfSchemaAndStats(db optimizer.WhatIfOptimizer, opt whatIfCmdOpt) (string, error) {
+	dbName, _, err := loadSchemaIntoCluster(db, opt.schemaPath)
+	if err != nil {
+		return "", err
+	}
+	if err := loadStatsIntoCluster(db, opt.statsPath); err != nil {
+		return "", err
+	}
+	if dbName == "" {
+		dbName = "test"
+	}
+	return dbName, db.Execute("use " + dbName)
+}
+
+const whatIfHelp = `commands:
+  load <query-path>        load the workload, e.g. 'load ./queries.sql', queries without databases use the default database
+  add <index>              add a hypothetical index, e.g. 'add t(a, b)', 'add idx_ab on db.t(a, b)' or 'add create index idx_ab on db.t (a, b)'
+  drop <index-name|n>      drop the hypothetical index by its name or its number in 'list'
+  reset                    drop all hypothetical indexes
+  list                     list all hypothetical indexes
+  cost                     print the cost of each query and the whole workload
+  plan <alias>             print plans of the query without and with hypothetical indexes
+  help                     print this message
+  exit                     exit`
+
+// whatIfSession is an interactive what-if session.
+type whatIfSession struct {
+	db            optimizer.WhatIfOptimizer
+	defaultSchema string
+	out           io.Writer
+
+	workload     *utils.WorkloadInfo
+	indexes      []utils.Index // current hypothetical indexes
+	originalCost float64       // the workload cost without hypothetical indexes
+	lastCost     float64       // the workload cost of the last index configuration
+}
+
+var errWhatIfExit = errors.New("exit")
+
+func (s *whatIfSession) run(in io.Reader) error {
+	fmt.Fprintln(s.out, "type 'help' to see all commands")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "what-if> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+		if err := s.exec(scanner.Text()); err == errWhatIfExit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+// exec executes a command in the session.
+func (s *whatIfSession) exec(line string) error {
+	line = strings.TrimSuffix(strings.TrimSpace(line), ";")
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch strings.ToLower(command) {
+	case "":
+		return nil
+	case "exit", "quit":
+		return errWhatIfExit
+	case "help":
+		fmt.Fprintln(s.out, whatIfHelp)
+		return nil
+	case "load":
+		return s.load(arg)
+	case "add":
+		idx, err := parseWhatIfIndex(arg, s.defaultSchema)
+		if err != nil {
+			return err
+		}
+		for _, existing := range s.indexes { // index names are unique in each table
+			if strings.EqualFold(existing.SchemaName, idx.SchemaName) && strings.EqualFold(existing.TableName, idx.TableName) &&
+				strings.EqualFold(existing.IndexName, idx.IndexName) {
+				return fmt.Errorf("index %v already exists on %v.%v", idx.IndexName, idx.SchemaName, idx.TableName)
+			}
+		}
+		if err := s.db.CreateHypoIndex(idx); err != nil { // check whether the index is valid
+			return err
+		}
+		if err := s.db.DropHypoIndex(idx); err != nil {
+			return err
+		}
+		s.indexes = append(s.indexes, idx)
+		fmt.Fprintf(s.out, "add %v\n", idx.DDL())
+		return s.printCost()
+	case "drop":
+		i, err := s.findIndex(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "drop %v\n", s.indexes[i].DDL())
+		s.indexes = append(s.indexes[:i], s.indexes[i+1:]...)
+		return s.printCost()
+	case "reset":
+		s.indexes = nil
+		return s.printCost()
+	case "list":
+		if len(s.indexes) == 0 {
+			fmt.Fprintln(s.out, "no hypothetical index")
+		}
+		for i, idx := range s.indexes {
+			fmt.Fprintf(s.out, "%v. %v\n", i+1, idx.DDL())
+		}
+		return nil
+	case "cost":
+		return s.printCost()
+	case "plan":
+		return s.printPlan(arg)
+	default:
+		return fmt.Errorf("unknown command %v, type 'help' to see all commands", command)
+	}
+}
+
+func (s *whatIfSession) load(queryPath string) error {
+	if queryPath == "" {
+		return errors.New("query path is not specified")
+	}
+	workload, err := loadWhatIfWorkload(s.db, s.defaultSchema, queryPath)
+	if err != nil {
+		return err
+	}
+	cost, err := advisor.EvaluateIndexConfCost(*workload, s.db, utils.NewSet[utils.Index]())
+	if err != nil {
+		return err
+	}
+	s.workload, s.originalCost, s.lastCost = workload, cost.TotalWorkloadQueryCost, cost.TotalWorkloadQueryCost
+	fmt.Fprintf(s.out, "load %v queries on %v tables\n", workload.Queries.Size(), workload.TableSchemas.Size())
+	return s.printCost()
+}
+
+// loadWhatIfWorkload loads queries and schemas of their tables, queries without databases use defaultSchema.
+func loadWhatIfWorkload(db optimizer.WhatIfOptimizer, defaultSchema, queryPath string) (*utils.WorkloadInfo, error) {
+	queries, err := utils.LoadQueries(defaultSchema, queryPath)
+	if err != nil {
+		return nil, err
+	}
+	if queries, err = filterSQLAccessingSystemTables(queries); err != nil {
+		return nil, err
+	}
+	if queries, err = bindQueryParams(db, queries); err != nil {
+		return nil, err
+	}
+	tableNames, err := utils.CollectTableNamesFromQueries(queries)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := getTableSchemas(db, tableNames)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.WorkloadInfo{Queries: queries, TableSchemas: tables}, nil
+}
+
+// findIndex returns the position of the index specified by its name or its number in 'list'.
+func (s *whatIfSession) findIndex(nameOrNum string) (int, error) {
+	if n, err := strconv.Atoi(nameOrNum); err == nil {
+		if n < 1 || n > len(s.indexes) {
+			return 0, fmt.Errorf("no index %v, type 'list' to see all indexes", n)
+		}
+		return n - 1, nil
+	}
+	found := -1
+	for i, idx := range s.indexes {
+		if strings.EqualFold(idx.IndexName, nameOrNum) {
+			if found >= 0 {
+				return 0, fmt.Errorf("index %v exists on multiple tables, use its number in 'list' instead", nameOrNum)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("no index %v, type 'list' to see all indexes", nameOrNum)
+	}
+	return found, nil
+}
+
+// printCost prints the cost of each query and the whole workload under current hypothetical indexes.
+func (s *whatIfSession) printCost() error {
+	if s.workload == nil {
+		fmt.Fprintln(s.out, "no workload, use 'load <query-path>' to load it")
+		return nil
+	}
+	planChanges, err := getPlanChanges(s.db, *s.workload, s.indexes)
+	if err != nil {
+		return err
+	}
+	sort.Slice(planChanges, func(i, j int) bool { return planChanges[i].SQL.Alias < planChanges[j].SQL.Alias })
+	cost, err := advisor.EvaluateIndexConfCost(*s.workload, s.db, utils.ListToSet(s.indexes...))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "%-12v %12v %12v %10v\n", "Alias", "Original", "What-If", "Ratio")
+	for _, change := range planChanges {
+		ori, opt := change.OriPlan.PlanCost(), change.OptPlan.PlanCost()
+		fmt.Fprintf(s.out, "%-12v %12.2E %12.2E %10v\n", change.SQL.Alias, ori, opt, formatCostRatio(ori, opt))
+	}
+	total := cost.TotalWorkloadQueryCost
+	fmt.Fprintf(s.out, "Total weighted workload cost: %.2E -> %.2E (%v), %v compared with the last change\n",
+		s.originalCost, total, formatCostRatio(s.originalCost, total), formatCostRatio(s.lastCost, total))
+	s.lastCost = total
+	return nil
+}
+
+func (s *whatIfSession) printPlan(alias string) error {
+	if s.workload == nil {
+		return errors.New("no workload, use 'load <query-path>' to load it")
+	}
+	for _, q := range s.workload.Queries.ToList() {
+		if q.Alias != alias {
+			continue
+		}
+		planChanges, err := getPlanChanges(s.db, utils.WorkloadInfo{Queries: utils.ListToSet(q)}, s.indexes)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "%v\n\n===================== original plan =====================\n%v\n", q.Text, planChanges[0].OriPlan.Format())
+		fmt.Fprintf(s.out, "===================== what-if plan =====================\n%v\n", planChanges[0].OptPlan.Format())
+		return nil
+	}
+	return fmt.Errorf("no query %v", alias)
+}
+
+// formatCostRatio formats the change from ori to cur like '-35.20%'.
+func formatCostRatio(ori, cur float64) string {
+	if ori == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f%%", 100*(cur-ori)/ori)
+}
+
+// whatIfIndexPattern matches short index definitions like `t(a, b)`, `db.t(a, b)` or `idx_ab on db.t(a, b)`.
+var whatIfIndexPattern = regexp.MustCompile(`(?is)^(?:(\S+)\s+on\s+)?([^\s(]+)\s*\((.+)\)$`)
+
+// whatIfUnqualifiedCreateIndex matches create index statements whose tables are not qualified by schemas.
+var whatIfUnqualifiedCreateIndex = regexp.MustCompile(`(?is)^create\s+index\s+\S+\s+on\s+([^\s(.]+)\s*\(`)
+
+// parseWhatIfIndex parses the index in the 'add' command, a name like 'idx_a_b' is generated if it's not specified.
+func parseWhatIfIndex(def, defaultSchema string) (utils.Index, error) {
+	def = strings.TrimSpace(def)
+	if strings.HasPrefix(strings.ToLower(def), "create ") {
+		stmt := def
+		if m := whatIfUnqualifiedCreateIndex.FindStringSubmatchIndex(def); m != nil {
+			stmt = def[:m[2]] + defaultSchema + "." + def[m[2]:] // fill the default schema
+		}
+		return utils.ParseCreateIndexStmt(stmt)
+	}
+	m := whatIfIndexPattern.FindStringSubmatch(def)
+	if m == nil {
+		return utils.Index{}, fmt.Errorf("invalid index %v, e.g. 't(a, b)' or 'idx_ab on db.t(a, b)'", def)
+	}
+	name, table, cols := m[1], m[2], m[3]
+	schema := defaultSchema
+	if i := strings.Index(table, "."); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+	}
+	if name == "" {
+		var parts []string
+		for _, col := range strings.Split(cols, ",") {
+			parts = append(parts, strings.ToLower(strings.Trim(strings.TrimSpace(col), "`")))
+		}
+		name = "idx_" + strings.Join(parts, "_")
+	}
+	return utils.ParseCreateIndexStmt(fmt.Sprintf("CREATE INDEX %v ON %v.%v (%v)", name, schema, table, cols))
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseWhatIfIndex(t *testing.T) {
+	cases := []struct {
+		def string
+		ddl string
+	}{
+		{"t(a, b)", "CREATE INDEX idx_a_b ON test.t (a, b)"},
+		{"shop.users (`email`)", "CREATE INDEX idx_email ON shop.users (email)"},
+		{"idx_ba on t(b, a)", "CREATE INDEX idx_ba ON test.t (b, a)"},
+		{"idx_ba ON shop.t(b,a)", "CREATE INDEX idx_ba ON shop.t (b, a)"},
+		{"create index idx_c on t (c)", "CREATE INDEX idx_c ON test.t (c)"},
+		{"CREATE INDEX idx_c ON shop.t (c(10))", "CREATE INDEX idx_c ON shop.t (c(10))"},
+	}
+	for _, c := range cases {
+		idx, err := parseWhatIfIndex(c.def, "test")
+		must(err)
+		if idx.DDL() != c.ddl {
+			t.Errorf("%v: expect %v, got %v", c.def, c.ddl, idx.DDL())
+		}
+	}
+	for _, def := range []string{"", "t", "t(a"} {
+		if _, err := parseWhatIfIndex(def, "test"); err == nil {
+			t.Errorf("%v: expect an error", def)
+		}
+	}
+}
+
+func TestWhatIfSessionCommands(t *testing.T) {
+	var out bytes.Buffer
+	s := &whatIfSession{defaultSchema: "test", out: &out}
+	must(s.run(strings.NewReader("help\nlist\ncost\nfoo\ndrop 1\nexit\nlist\n")))
+	output := out.String()
+	for _, expected := range []string{"commands:", "no hypothetical index", "no workload", "unknown command foo", "error: no index 1"} {
+		mustTrue(strings.Contains(output, expected), expected, output)
+	}
+	mustTrue(strings.Count(output, "no hypothetical index") == 1, "commands after exit should be ignored", output)
+
+	// indexes with the same name on different tables
+	out.Reset()
+	t1, err := parseWhatIfIndex("t1(a)", "test")
+	must(err)
+	t2, err := parseWhatIfIndex("t2(a)", "test")
+	must(err)
+	s.indexes = append(s.indexes, t1, t2)
+	must(s.run(strings.NewReader("drop idx_a\ndrop 2\nlist\n")))
+	output = out.String()
+	mustTrue(strings.Contains(output, "index idx_a exists on multiple tables"), output)
+	mustTrue(strings.Contains(output, "drop CREATE INDEX idx_a ON test.t2 (a)"), output)
+	mustTrue(strings.Contains(output, "1. CREATE INDEX idx_a ON test.t1 (a)"), output)
+}
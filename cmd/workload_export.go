@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
+	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/qw4990/index_advisor/optimizer"
 	"github.com/qw4990/index_advisor/utils"
@@ -12,10 +15,16 @@ import (
 )
 
 type workloadExportCmdOpt struct {
-	dsn        string
-	statusAddr string
-	output     string
-	logLevel   string
+	dsn             string
+	statusAddr      string
+	statsSource     string
+	output          string
+	logLevel        string
+	timeRange       string
+	recencyHalfLife time.Duration
+
+	anonymize            bool
+	anonymizeIdentifiers bool
 }
 
 func NewWorkloadExportCmd() *cobra.Command {
@@ -29,7 +38,7 @@ How it work:
 2. read all queries from the 'STATEMENT_SUMMARY' system table
 3. read all table schema from the 'INFORMATION_SCHEMA' database
 4. read all statistics from the 'mysql.stats_xxx' system tables
-5. store all data into the specified output directory
+5. store all data and a manifest into the specified output directory, or pack them into a bundle if the output ends with '.tar.gz'
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			utils.SetLogLevel(opt.logLevel)
@@ -46,22 +55,39 @@ How it work:
 
 	cmd.Flags().StringVar(&opt.dsn, "dsn", "root:@tcp(127.0.0.1:4000)/test", "dsn")
 	cmd.Flags().StringVar(&opt.statusAddr, "status_address", "http://127.0.0.1:10080", "status address used to download table statistics")
-	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result")
+	cmd.Flags().StringVar(&opt.statsSource, "stats-source", "http", "how to export table statistics, one of 'http' (through the status address) and 'sql' (from 'mysql.stats_xxx' tables and 'SHOW STATS_xxx' statements, which only requires the DSN)")
+	cmd.Flags().StringVar(&opt.output, "output", "", "output directory to save the result, or a workload bundle file like './workload.tar.gz'")
 	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	cmd.Flags().StringVar(&opt.timeRange, "time-range", "", "the time range of statement summary windows to export, either a duration like '24h' or two timestamps like '2023-08-01 00:00:00,2023-08-02 00:00:00'")
+	cmd.Flags().DurationVar(&opt.recencyHalfLife, "recency-half-life", 0, "if specified, e.g. '6h', the execution count of each statement summary window is weighted by 0.5^(age/half-life) to make recent windows more important")
+	cmd.Flags().BoolVar(&opt.anonymize, "anonymize", false, "replace literals in queries, schemas and statistics with synthetic values that keep their order")
+	cmd.Flags().BoolVar(&opt.anonymizeIdentifiers, "anonymize-identifiers", false, "rename schemas, tables, columns and indexes when '--anonymize' is enabled, the mapping is saved into 'identifier_mapping.json'")
 	return cmd
 }
 
 func exportWorkload(opt workloadExportCmdOpt) error {
+	var bundlePath string
+	if utils.IsWorkloadBundle(opt.output) { // export into a temporary dir first and then pack it
+		tmpDir, err := os.MkdirTemp("", "index_advisor_workload")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		bundlePath, opt.output = opt.output, tmpDir
+	}
 	utils.Infof("[workload-export] prepare dir %v", opt.output)
 	if err := utils.PrepareDir(opt.output); err != nil {
 		return err
 	}
+	if opt.statsSource != "http" && opt.statsSource != "sql" {
+		return fmt.Errorf("unknown stats source %v, should be one of 'http' and 'sql'", opt.statsSource)
+	}
 	utils.Infof("[workload-export] connect to %v", opt.dsn)
 	db, err := optimizer.NewTiDBWhatIfOptimizer(opt.dsn)
 	if err != nil {
 		return err
 	}
-	queries, err := readQueriesFromStatementSummary(db, nil, 0, 0)
+	queries, err := readQueriesFromStatementSummary(db, nil, 0, 0, opt.timeRange, opt.recencyHalfLife)
 	if err != nil {
 		return err
 	}
@@ -70,9 +96,6 @@ func exportWorkload(opt workloadExportCmdOpt) error {
 		return err
 	}
 	utils.Infof("[workload-export] read %v queries", queries.Size())
-	if err := saveQueries(opt, queries); err != nil {
-		return err
-	}
 
 	tableNames, err := utils.CollectTableNamesFromQueries(queries)
 	if err != nil {
@@ -82,30 +105,132 @@ func exportWorkload(opt workloadExportCmdOpt) error {
 	if err != nil {
 		return err
 	}
+
+	utils.Infof("[workload-export] start dumping table statistics for %v tables", tableNames.Size())
+	tableStats := make(map[string][]byte, tableNames.Size())
+	for _, t := range tableNames.ToList() {
+		var stats []byte
+		if opt.statsSource == "sql" {
+			stats, err = dumpTableStatsBySQL(db, t)
+		} else {
+			stats, err = fetchTableStats(opt, t)
+		}
+		if err != nil {
+			return err
+		}
+		tableStats[t.Key()] = stats
+	}
+
+	var anonymizer *utils.Anonymizer
+	if opt.anonymize {
+		if anonymizer, err = utils.NewAnonymizer(opt.anonymizeIdentifiers); err != nil {
+			return err
+		}
+		if tables, queries, err = anonymizeWorkload(anonymizer, tables, queries, tableStats); err != nil {
+			return err
+		}
+		if opt.anonymizeIdentifiers {
+			fpath := path.Join(opt.output, "identifier_mapping.json")
+			if bundlePath != "" { // keep the mapping out of the bundle since the bundle is supposed to be shared
+				fpath = path.Join(path.Dir(bundlePath), "identifier_mapping.json")
+			}
+			utils.Infof("[workload-export] save the identifier mapping to %v, please keep it private", fpath)
+			if err := anonymizer.SaveMapping(fpath); err != nil {
+				return err
+			}
+		}
+	}
+	if err := saveQueries(opt, queries); err != nil {
+		return err
+	}
 	if err := saveTableSchemas(opt, tables); err != nil {
 		return err
 	}
 
-	utils.Infof("[workload-export] start dumping table statistics for %v tables", tableNames.Size())
 	statsDir := path.Join(opt.output, "stats")
 	utils.Infof("[workload-export] prepare stats dir %v", statsDir)
 	if err := utils.PrepareDir(statsDir); err != nil {
 		return err
 	}
 	for _, t := range tableNames.ToList() {
-		stats, err := fetchTableStats(opt, t)
-		if err != nil {
-			return err
+		stats := tableStats[t.Key()]
+		schemaName, tableName := t.SchemaName, t.TableName
+		if anonymizer != nil {
+			if stats, err = anonymizer.AnonymizeStats(stats); err != nil {
+				return err
+			}
+			schemaName, tableName = anonymizer.SchemaName(schemaName), anonymizer.TableName(tableName)
 		}
-		fpath := path.Join(statsDir, fmt.Sprintf("%s_%s.json", t.SchemaName, t.TableName))
+		fpath := path.Join(statsDir, fmt.Sprintf("%s_%s.json", schemaName, tableName))
 		if err := utils.SaveContentTo(fpath, string(stats)); err != nil {
 			return err
 		}
 		utils.Infof("[workload-export] save table statistics for %v to %v", t.Key(), fpath)
 	}
+
+	var version string
+	if err := queryRows(db, "select version()", func(rows *sql.Rows) error { return rows.Scan(&version) }); err != nil {
+		return err
+	}
+	manifest, err := utils.BuildWorkloadManifest(opt.output, version)
+	if err != nil {
+		return err
+	}
+	utils.Infof("[workload-export] save the manifest with %v tables and %v queries", len(manifest.Tables), manifest.QueryCount)
+	if err := utils.SaveWorkloadManifest(opt.output, manifest); err != nil {
+		return err
+	}
+	if bundlePath != "" {
+		return utils.PackWorkloadBundle(opt.output, bundlePath)
+	}
 	return nil
 }
 
+// anonymizeWorkload anonymizes table schemas and queries, queries that can't be anonymized are dropped.
+// Literals in table schemas, queries and statistics are collected first to map them consistently and in order,
+// statistics are anonymized later when saving them.
+func anonymizeWorkload(anonymizer *utils.Anonymizer, tables utils.Set[utils.TableSchema], queries utils.Set[utils.Query],
+	tableStats map[string][]byte) (utils.Set[utils.TableSchema], utils.Set[utils.Query], error) {
+	for _, t := range tables.ToList() {
+		if err := anonymizer.CollectTableSchema(t); err != nil {
+			return nil, nil, fmt.Errorf("fail to anonymize table %v.%v: %v", t.SchemaName, t.TableName, err)
+		}
+	}
+	for _, q := range queries.ToList() {
+		if err := anonymizer.CollectQuery(q); err != nil {
+			utils.Warningf("[workload-export] fail to collect literals of query %v: %v", q.Alias, err)
+		}
+	}
+	for table, stats := range tableStats {
+		if err := anonymizer.CollectStats(stats); err != nil {
+			return nil, nil, fmt.Errorf("fail to anonymize statistics of %v: %v", table, err)
+		}
+	}
+
+	anonymizedTables := utils.NewSet[utils.TableSchema]()
+	for _, t := range tables.ToList() { // tables first to register their identifiers
+		at, err := anonymizer.AnonymizeTableSchema(t)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fail to anonymize table %v.%v: %v", t.SchemaName, t.TableName, err)
+		}
+		anonymizedTables.Add(at)
+	}
+	anonymizedQueries := utils.NewSet[utils.Query]()
+	for _, q := range queries.ToList() {
+		aq, err := anonymizer.AnonymizeQuery(q)
+		if err != nil {
+			utils.Warningf("[workload-export] drop query %v since it can't be anonymized: %v", q.Alias, err)
+			continue
+		}
+		if existing, ok := anonymizedQueries.Find(aq); ok {
+			aq.Frequency += existing.Frequency
+		}
+		anonymizedQueries.Add(aq)
+	}
+	utils.Infof("[workload-export] anonymize %v tables and %v queries", anonymizedTables.Size(), anonymizedQueries.Size())
+	return anonymizedTables, anonymizedQueries, nil
+}
+
 func fetchTableStats(opt workloadExportCmdOpt, table utils.TableName) ([]byte, error) {
 	// http://${tidb-server-ip}:${tidb-server-status-port}/stats/dump/${db_name}/${table_name}
 	url := fmt.Sprintf("%s/stats/dump/%s/%s", opt.statusAddr, table.SchemaName, table.TableName)
@@ -131,7 +256,14 @@ func saveQueries(opt workloadExportCmdOpt, queries utils.Set[utils.Query]) error
 	}
 	fpath := path.Join(opt.output, "queries.sql")
 	utils.Infof("[workload-export] save queries to %v", fpath)
-	return utils.SaveContentTo(fpath, buf.String())
+	if err := utils.SaveContentTo(fpath, buf.String()); err != nil {
+		return err
+	}
+
+	// queries.json keeps frequencies, digests(aliases) and latencies of queries.
+	fpath = path.Join(opt.output, "queries.json")
+	utils.Infof("[workload-export] save queries to %v", fpath)
+	return utils.SaveWorkloadFile(fpath, queries)
 }
 
 func saveTableSchemas(opt workloadExportCmdOpt, tables utils.Set[utils.TableSchema]) error {
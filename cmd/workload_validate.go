@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/qw4990/index_advisor/utils"
+	"github.com/spf13/cobra"
+)
+
+type workloadValidateCmdOpt struct {
+	path     string
+	logLevel string
+}
+
+func NewWorkloadValidateCmd() *cobra.Command {
+	var opt workloadValidateCmdOpt
+	cmd := &cobra.Command{
+		Use:   "workload-validate",
+		Short: "check whether the workload exported by `workload-export` is complete, use `index_advisor workload-validate --help` to see more details",
+		Long: `check whether the workload exported by 'workload-export' is complete.
+How it work:
+1. unpack the workload bundle if the path is a '.tar.gz' file
+2. check all files against the checksums in the manifest
+3. check every table referenced by queries has its schema and statistics
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.SetLogLevel(opt.logLevel)
+			dir, cleanup, err := openWorkloadDir(opt.path)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			problems, err := utils.ValidateWorkloadDir(dir)
+			if err != nil {
+				return err
+			}
+			if len(problems) == 0 {
+				cmd.Printf("[workload-validate] the workload %v is valid\n", opt.path)
+				return nil
+			}
+			for _, p := range problems {
+				cmd.Printf("[workload-validate] %v\n", p)
+			}
+			return fmt.Errorf("found %v problems in the workload %v", len(problems), opt.path)
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.path, "path", "", "the workload bundle or directory exported by 'workload-export', e.g. './workload.tar.gz'")
+	cmd.Flags().StringVar(&opt.logLevel, "log-level", "info", "log level, one of 'debug', 'info', 'warning', 'error'")
+	return cmd
+}
+
+// openWorkloadDir returns the directory of the workload, workload bundles are unpacked into a temporary directory,
+// which is removed by cleanup.
+func openWorkloadDir(workloadPath string) (dir string, cleanup func(), err error) {
+	cleanup = func() {}
+	if exist, _ := utils.FileExists(workloadPath); !exist {
+		return "", cleanup, fmt.Errorf("workload %v does not exist", workloadPath)
+	}
+	if !utils.IsWorkloadBundle(workloadPath) {
+		return workloadPath, cleanup, nil
+	}
+	dir, err = os.MkdirTemp("", "index_advisor_workload")
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	utils.Infof("unpack the workload bundle %v into %v", workloadPath, dir)
+	if err := utils.UnpackWorkloadBundle(workloadPath, dir); err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return dir, cleanup, nil
+}
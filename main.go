@@ -17,9 +17,17 @@ func init() {
 	cobra.OnInitialize()
 	rootCmd.AddCommand(cmd.NewAdviseOnlineCmd())
 	rootCmd.AddCommand(cmd.NewAdviseOfflineCmd())
+	rootCmd.AddCommand(cmd.NewAdviseDaemonCmd())
 	rootCmd.AddCommand(cmd.NewPreCheckCmd())
 	rootCmd.AddCommand(cmd.NewEvaluateCmd())
+	rootCmd.AddCommand(cmd.NewWhatIfCmd())
+	rootCmd.AddCommand(cmd.NewCompareCmd())
 	rootCmd.AddCommand(cmd.NewWorkloadExportCmd())
+	rootCmd.AddCommand(cmd.NewWorkloadValidateCmd())
+	rootCmd.AddCommand(cmd.NewDatagenCmd())
+	rootCmd.AddCommand(cmd.NewApplyCmd())
+	rootCmd.AddCommand(cmd.NewIndexTrialCmd())
+	rootCmd.AddCommand(cmd.NewServeCmd())
 }
 
 func main() {
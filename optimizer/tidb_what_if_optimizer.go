@@ -80,7 +80,7 @@ func (o *TiDBWhatIfOptimizer) Close() error {
 // CreateHypoIndex creates a hypothetical index.
 func (o *TiDBWhatIfOptimizer) CreateHypoIndex(index utils.Index) error {
 	defer o.recordStats(time.Now(), &o.stats.CreateOrDropHypoIdxTime, &o.stats.CreateOrDropHypoIdxCount)
-	createStmt := fmt.Sprintf(`create index %v type hypo on %v.%v (%v)`, index.IndexName, index.SchemaName, index.TableName, strings.Join(index.ColumnNames(), ", "))
+	createStmt := fmt.Sprintf(`create index %v type hypo on %v.%v (%v)`, index.IndexName, index.SchemaName, index.TableName, strings.Join(index.IndexParts(), ", "))
 	err := o.Execute(createStmt)
 	if err != nil {
 		utils.Errorf("failed to create hypo index '%v': %v", createStmt, err)
@@ -0,0 +1,763 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// IdentifierMapping is the mapping from original identifiers to anonymized ones, all original identifiers are in
+// lower case. It's reversible since anonymized identifiers are unique.
+type IdentifierMapping struct {
+	Schemas map[string]string `json:"schemas"`
+	Tables  map[string]string `json:"tables"`
+	Columns map[string]string `json:"columns"`
+	Indexes map[string]string `json:"indexes"`
+}
+
+// Anonymizer anonymizes table schemas, queries and statistics consistently.
+// Literals are replaced with synthetic values of the same type while keeping their order, e.g. 12345 --> 12873 and
+// 'alice@gmail.com' --> 'hkbuq@fmxrd.zqw', so range predicates and bounds in histograms and TopN of statistics still
+// cover the same values after anonymization. Literals are mapped per column, a literal compared with a column like
+// `email = 'alice@gmail.com'` uses the same mapping as values of the column in statistics. Date and time values are
+// kept to keep the selectivity of range predicates.
+// All table schemas, queries and statistics should be collected before anonymizing any of them, literals that are not
+// collected are mapped on demand and their order is kept as much as possible.
+// If identifiers are renamed, schemas, tables, columns and indexes are renamed to db1, t1, c1, idx1, etc.
+// Only identifiers defined in registered table schemas are renamed, so table schemas must be anonymized before queries.
+type Anonymizer struct {
+	renameIdentifiers bool
+	mapping           IdentifierMapping
+	domains           map[string]*literalDomain // lower case column name --> literals of the column
+	tables            map[string]TableSchema    // lower case schema.table --> original table schema
+	literals          map[string]string         // original free text --> synthetic text, e.g. comments
+	used              map[string]bool           // synthetic free texts
+	rand              *mrand.Rand
+}
+
+// NewAnonymizer creates an Anonymizer.
+func NewAnonymizer(renameIdentifiers bool) (*Anonymizer, error) {
+	var seed [8]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, fmt.Errorf("fail to generate the random seed: %v", err)
+	}
+	return &Anonymizer{
+		renameIdentifiers: renameIdentifiers,
+		mapping: IdentifierMapping{
+			Schemas: make(map[string]string),
+			Tables:  make(map[string]string),
+			Columns: make(map[string]string),
+			Indexes: make(map[string]string),
+		},
+		domains:  make(map[string]*literalDomain),
+		tables:   make(map[string]TableSchema),
+		literals: make(map[string]string),
+		used:     make(map[string]bool),
+		rand:     mrand.New(mrand.NewSource(int64(binary.LittleEndian.Uint64(seed[:])))),
+	}, nil
+}
+
+// Mapping returns the identifier mapping.
+func (a *Anonymizer) Mapping() IdentifierMapping {
+	return a.mapping
+}
+
+// SaveMapping saves the identifier mapping into the file in JSON format.
+func (a *Anonymizer) SaveMapping(fpath string) error {
+	data, err := json.MarshalIndent(a.mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return SaveContentTo(fpath, string(data))
+}
+
+// SchemaName returns the anonymized schema name.
+func (a *Anonymizer) SchemaName(name string) string {
+	return lookupIdentifier(a.mapping.Schemas, name)
+}
+
+// TableName returns the anonymized table name.
+func (a *Anonymizer) TableName(name string) string {
+	return lookupIdentifier(a.mapping.Tables, name)
+}
+
+func lookupIdentifier(m map[string]string, name string) string {
+	if v, ok := m[strings.ToLower(name)]; ok {
+		return v
+	}
+	return name
+}
+
+func (a *Anonymizer) register(m map[string]string, prefix, name string) {
+	if !a.renameIdentifiers || name == "" {
+		return
+	}
+	if _, ok := m[strings.ToLower(name)]; !ok {
+		m[strings.ToLower(name)] = fmt.Sprintf("%v%v", prefix, len(m)+1)
+	}
+}
+
+// CollectTableSchema collects literals in the table schema, e.g. ENUM values and default values, and registers the
+// table schema to know column types in its statistics.
+func (a *Anonymizer) CollectTableSchema(t TableSchema) error {
+	createTable, err := a.parseTableSchema(t)
+	if err != nil {
+		return err
+	}
+	for _, col := range createTable.Cols {
+		if col.Tp != nil {
+			for _, elem := range col.Tp.Elems {
+				a.stringText(a.domain(col.Name.Name.L), elem, false, true)
+			}
+		}
+	}
+	a.collectStmt(createTable)
+	return nil
+}
+
+// CollectQuery collects literals in the query.
+func (a *Anonymizer) CollectQuery(q Query) error {
+	stmt, err := ParseOneSQL(q.Text)
+	if err != nil {
+		return err
+	}
+	a.collectStmt(stmt)
+	return nil
+}
+
+// CollectStats collects values in histograms and TopN of the table statistics in JSON format.
+func (a *Anonymizer) CollectStats(data []byte) error {
+	stats, err := decodeStats(data)
+	if err != nil {
+		return err
+	}
+	return a.walkStats(stats, nil, true)
+}
+
+func (a *Anonymizer) parseTableSchema(t TableSchema) (*ast.CreateTableStmt, error) {
+	stmt, err := ParseOneSQL(t.CreateStmtText)
+	if err != nil {
+		return nil, err
+	}
+	createTable, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a create table statement", t.CreateStmtText)
+	}
+	a.tables[strings.ToLower(t.SchemaName+"."+t.TableName)] = t
+	return createTable, nil
+}
+
+func (a *Anonymizer) collectStmt(stmt ast.StmtNode) {
+	lits := findLiterals(stmt)
+	for v := range lits.values {
+		a.literalValue(v, lits.columns[v], lits.patterns[v], true)
+	}
+}
+
+// AnonymizeTableSchema anonymizes the table schema and registers its identifiers.
+func (a *Anonymizer) AnonymizeTableSchema(t TableSchema) (TableSchema, error) {
+	createTable, err := a.parseTableSchema(t)
+	if err != nil {
+		return TableSchema{}, err
+	}
+	a.register(a.mapping.Schemas, "db", t.SchemaName)
+	a.register(a.mapping.Tables, "t", createTable.Table.Name.O)
+	for _, col := range createTable.Cols {
+		a.register(a.mapping.Columns, "c", col.Name.Name.O)
+	}
+	for _, cons := range createTable.Constraints {
+		if cons.Tp != ast.ConstraintPrimaryKey {
+			a.register(a.mapping.Indexes, "idx", cons.Name)
+		}
+	}
+
+	text, err := a.anonymizeStmt(createTable)
+	if err != nil {
+		return TableSchema{}, err
+	}
+	return ParseCreateTableStmt(a.SchemaName(t.SchemaName), text)
+}
+
+// AnonymizeQuery anonymizes the query, its alias is replaced with the digest of the anonymized text.
+func (a *Anonymizer) AnonymizeQuery(q Query) (Query, error) {
+	stmt, err := ParseOneSQL(q.Text)
+	if err != nil {
+		return Query{}, err
+	}
+	text, err := a.anonymizeStmt(stmt)
+	if err != nil {
+		return Query{}, err
+	}
+	_, digest := NormalizeDigest(text)
+	q.Alias = digest
+	q.SchemaName = a.SchemaName(q.SchemaName)
+	q.Text = text
+	q.IndexableColumns = nil
+	return q, nil
+}
+
+func (a *Anonymizer) anonymizeStmt(stmt ast.StmtNode) (string, error) {
+	v := &anonymizeVisitor{a: a, aliases: make(map[string]bool), lits: findLiterals(stmt)}
+	stmt.Accept(&tableAliasCollector{aliases: v.aliases})
+	stmt.Accept(v)
+	var sb strings.Builder
+	ctx := format.NewRestoreCtx(format.RestoreStringSingleQuotes|format.RestoreKeyWordLowercase|format.RestoreNameBackQuotes|
+		format.RestoreSpacesAroundBinaryOperation|format.RestoreStringWithoutCharset, &sb)
+	if err := stmt.Restore(ctx); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// AnonymizeStats anonymizes the table statistics in JSON format. Identifiers are renamed, and values in histograms and
+// TopN are mapped in the same way as literals, while counts and NDVs are kept. Hash-based sketches are removed since
+// they can't be mapped.
+func (a *Anonymizer) AnonymizeStats(data []byte) ([]byte, error) {
+	stats, err := decodeStats(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.walkStats(stats, nil, false); err != nil {
+		return nil, err
+	}
+	return json.Marshal(stats)
+}
+
+func decodeStats(data []byte) (map[string]any, error) {
+	var stats map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep counts as they are
+	if err := decoder.Decode(&stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// walkStats collects or maps values in the table statistics, table is the schema of the table if known.
+func (a *Anonymizer) walkStats(stats map[string]any, table *TableSchema, collect bool) error {
+	db, _ := stats["database_name"].(string)
+	tbl, _ := stats["table_name"].(string)
+	if t, ok := a.tables[strings.ToLower(db+"."+tbl)]; ok && table == nil {
+		table = &t
+	}
+	if !collect {
+		stats["database_name"] = a.SchemaName(db)
+		stats["table_name"] = a.TableName(tbl)
+	}
+	for _, field := range []struct {
+		key     string
+		mapping map[string]string
+	}{{"columns", a.mapping.Columns}, {"indices", a.mapping.Indexes}} {
+		items, ok := stats[field.key].(map[string]any)
+		if !ok {
+			continue
+		}
+		anonymized := make(map[string]any, len(items))
+		for name, item := range items {
+			if itemStats, ok := item.(map[string]any); ok {
+				var err error
+				if field.key == "columns" {
+					err = a.walkStatsItem(itemStats, table, []string{name}, true, collect)
+				} else {
+					err = a.walkStatsItem(itemStats, table, indexColumnNames(table, name), false, collect)
+				}
+				if err != nil {
+					return fmt.Errorf("invalid statistics of %v.%v.%v: %v", db, tbl, name, err)
+				}
+			}
+			anonymized[lookupIdentifier(field.mapping, name)] = item
+		}
+		if !collect {
+			stats[field.key] = anonymized
+		}
+	}
+	if !collect {
+		stats["ext_stats"] = nil
+	}
+	if partitions, ok := stats["partitions"].(map[string]any); ok {
+		for _, p := range partitions {
+			if pStats, ok := p.(map[string]any); ok {
+				if err := a.walkStats(pStats, table, collect); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// walkStatsItem collects or maps values in the statistics of a column or an index. Bounds of column histograms are
+// raw values, while bounds of index histograms and TopN values are encoded keys.
+func (a *Anonymizer) walkStatsItem(item map[string]any, table *TableSchema, columns []string, rawBounds, collect bool) error {
+	mapKey := func(key []byte) ([]byte, error) { return a.statsKey(key, table, columns, collect) }
+	mapBound := mapKey
+	if rawBounds {
+		mapBound = func(raw []byte) ([]byte, error) { return a.statsRawValue(raw, table, columns[0], collect), nil }
+	}
+	if hist, ok := item["histogram"].(map[string]any); ok {
+		buckets, _ := hist["buckets"].([]any)
+		for _, b := range buckets {
+			if bucket, ok := b.(map[string]any); ok {
+				for _, key := range []string{"lower_bound", "upper_bound"} {
+					if err := mapStatsBytes(bucket, key, mapBound); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	if cm, ok := item["cm_sketch"].(map[string]any); ok {
+		topN, _ := cm["top_n"].([]any)
+		for _, t := range topN {
+			if top, ok := t.(map[string]any); ok {
+				if err := mapStatsBytes(top, "data", mapKey); err != nil {
+					return err
+				}
+			}
+		}
+		if !collect {
+			delete(cm, "rows") // counters of hashed values
+		}
+	}
+	if !collect {
+		item["fm_sketch"] = nil
+	}
+	return nil
+}
+
+// mapStatsBytes maps the base64 encoded value m[key], it's kept if f returns nil.
+func mapStatsBytes(m map[string]any, key string, f func([]byte) ([]byte, error)) error {
+	s, ok := m[key].(string)
+	if !ok {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	v, err := f(raw)
+	if err != nil || v == nil {
+		return err
+	}
+	m[key] = base64.StdEncoding.EncodeToString(v)
+	return nil
+}
+
+func indexColumnNames(table *TableSchema, indexName string) []string {
+	if table == nil {
+		return nil
+	}
+	for _, idx := range table.Indexes {
+		if strings.EqualFold(idx.IndexName, indexName) {
+			names := make([]string, 0, len(idx.Columns))
+			for _, col := range idx.Columns {
+				names = append(names, col.ColumnName)
+			}
+			return names
+		}
+	}
+	return nil
+}
+
+type statsValueKind int
+
+const (
+	statsValueUnknown statsValueKind = iota // the table schema is unknown
+	statsValueKept                          // e.g. times, ENUM and BIT values
+	statsValueNumber
+	statsValueString
+)
+
+func statsValueKindOf(table *TableSchema, column string) statsValueKind {
+	if table == nil {
+		return statsValueUnknown
+	}
+	for _, col := range table.Columns {
+		if !strings.EqualFold(col.ColumnName, column) || col.ColumnType == nil {
+			continue
+		}
+		switch col.ColumnType.Tp {
+		case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong,
+			mysql.TypeFloat, mysql.TypeDouble, mysql.TypeNewDecimal:
+			return statsValueNumber
+		case mysql.TypeVarchar, mysql.TypeString, mysql.TypeVarString,
+			mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob:
+			return statsValueString
+		default:
+			return statsValueKept
+		}
+	}
+	return statsValueUnknown
+}
+
+// statsRawValue collects or maps a raw value of the column in its histogram, e.g. "123" or "alice".
+func (a *Anonymizer) statsRawValue(raw []byte, table *TableSchema, column string, collect bool) []byte {
+	d := a.domain(column)
+	switch statsValueKindOf(table, column) {
+	case statsValueNumber:
+		s, _ := a.numberText(d, string(raw), collect)
+		return []byte(s)
+	case statsValueString:
+		return []byte(a.stringText(d, string(raw), false, collect))
+	case statsValueUnknown:
+		if s, ok := a.numberText(d, string(raw), collect); ok {
+			return []byte(s)
+		}
+		return []byte(a.stringText(d, string(raw), false, collect))
+	}
+	return raw
+}
+
+// statsKey collects or maps values in a key encoded by codec, columns are columns of values in the key.
+// It returns nil when collecting.
+func (a *Anonymizer) statsKey(key []byte, table *TableSchema, columns []string, collect bool) ([]byte, error) {
+	var datums []types.Datum
+	for i := 0; len(key) > 0; i++ {
+		var d types.Datum
+		var err error
+		if key, d, err = codec.DecodeOne(key); err != nil {
+			return nil, err
+		}
+		var column string
+		if i < len(columns) {
+			column = columns[i]
+		}
+		datums = append(datums, a.statsDatum(d, table, column, collect))
+	}
+	if collect {
+		return nil, nil
+	}
+	return codec.EncodeKey(nil, nil, datums...)
+}
+
+func (a *Anonymizer) statsDatum(datum types.Datum, table *TableSchema, column string, collect bool) types.Datum {
+	kind := statsValueKindOf(table, column)
+	d := a.domain(column)
+	number := kind == statsValueNumber || kind == statsValueUnknown
+	switch datum.Kind() {
+	case types.KindInt64:
+		if s, ok := a.numberText(d, strconv.FormatInt(datum.GetInt64(), 10), collect && number); ok && number {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				datum.SetInt64(i)
+			}
+		}
+	case types.KindUint64:
+		if s, ok := a.numberText(d, strconv.FormatUint(datum.GetUint64(), 10), collect && number); ok && number {
+			if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+				datum.SetUint64(u)
+			}
+		}
+	case types.KindFloat32, types.KindFloat64:
+		if s, ok := a.numberText(d, strconv.FormatFloat(datum.GetFloat64(), 'f', -1, 64), collect && number); ok && number {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				datum.SetFloat64(f)
+			}
+		}
+	case types.KindMysqlDecimal:
+		if s, ok := a.numberText(d, datum.GetMysqlDecimal().String(), collect && number); ok && number {
+			dec := new(types.MyDecimal)
+			if err := dec.FromString([]byte(s)); err == nil {
+				datum.SetMysqlDecimal(dec)
+				datum.SetLength(0) // the precision may change
+			}
+		}
+	case types.KindString, types.KindBytes:
+		if kind == statsValueString || kind == statsValueUnknown {
+			datum.SetBytes([]byte(a.stringText(d, string(datum.GetBytes()), false, collect)))
+		}
+	}
+	return datum
+}
+
+// domain returns literals of the column, literals that are not compared with any column share the empty column.
+func (a *Anonymizer) domain(column string) *literalDomain {
+	column = strings.ToLower(column)
+	d, ok := a.domains[column]
+	if !ok {
+		d = newLiteralDomain()
+		a.domains[column] = d
+	}
+	return d
+}
+
+// numberText collects or maps the number in text form, the number of decimals is kept. It returns false if s is not a
+// number. It returns s itself when collecting.
+func (a *Anonymizer) numberText(d *literalDomain, s string, collect bool) (string, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s, false
+	}
+	if collect {
+		d.addNumber(f)
+		return s, true
+	}
+	frac := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		frac = len(s) - i - 1
+	}
+	return strconv.FormatFloat(d.mapNumber(f, a.rand), 'f', frac, 64), true
+}
+
+// stringText collects or maps the string, only the prefix before wildcards of a LIKE pattern keeps its order while the
+// rest is anonymized as free text. It returns s itself when collecting.
+func (a *Anonymizer) stringText(d *literalDomain, s string, pattern, collect bool) string {
+	if dateTimePattern.MatchString(s) {
+		return s
+	}
+	prefix := s
+	if pattern {
+		if i := strings.IndexAny(s, `%_\`); i >= 0 {
+			prefix = s[:i]
+		}
+	}
+	if collect {
+		d.addString(prefix)
+		return s
+	}
+	return d.mapString(prefix, a.rand) + a.anonymizeString(s[len(prefix):])
+}
+
+var dateTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([ T]\d{2}:\d{2}(:\d{2}(\.\d+)?)?)?$|^\d{2}:\d{2}(:\d{2}(\.\d+)?)?$`)
+
+// anonymizeString returns a synthetic string with the same shape as s for free texts like comments, letters and digits
+// are replaced while other characters like '@', '.', '%' and '_' are kept, and date or time strings are kept.
+func (a *Anonymizer) anonymizeString(s string) string {
+	if s == "" || dateTimePattern.MatchString(s) {
+		return s
+	}
+	if v, ok := a.literals[s]; ok {
+		return v
+	}
+	gen := func() string {
+		var sb strings.Builder
+		for _, r := range s {
+			switch {
+			case r >= 'a' && r <= 'z':
+				sb.WriteRune('a' + rune(a.rand.Intn(26)))
+			case r >= 'A' && r <= 'Z':
+				sb.WriteRune('A' + rune(a.rand.Intn(26)))
+			case r >= '0' && r <= '9':
+				sb.WriteRune('0' + rune(a.rand.Intn(10)))
+			case r > 127: // non-ASCII characters
+				sb.WriteRune('a' + rune(a.rand.Intn(26)))
+			default:
+				sb.WriteRune(r)
+			}
+		}
+		return sb.String()
+	}
+	v := gen()
+	for i := 0; i < 10 && a.used[v]; i++ { // try to make different texts have different values
+		v = gen()
+	}
+	a.literals[s] = v
+	a.used[v] = true
+	return v
+}
+
+// literalValue collects or maps the literal, column is the column compared with the literal, and pattern is whether
+// it's a LIKE pattern.
+func (a *Anonymizer) literalValue(v *driver.ValueExpr, column string, pattern, collect bool) {
+	d := a.domain(column)
+	switch v.Kind() {
+	case types.KindInt64:
+		if v.Type.Flag&mysql.IsBooleanFlag != 0 {
+			return
+		}
+		s, _ := a.numberText(d, strconv.FormatInt(v.GetInt64(), 10), collect)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil && !collect {
+			v.SetInt64(i)
+		}
+	case types.KindUint64:
+		s, _ := a.numberText(d, strconv.FormatUint(v.GetUint64(), 10), collect)
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil && !collect {
+			v.SetUint64(u)
+		}
+	case types.KindFloat32, types.KindFloat64:
+		s, _ := a.numberText(d, strconv.FormatFloat(v.GetFloat64(), 'f', -1, 64), collect)
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !collect {
+			v.SetFloat64(f)
+		}
+	case types.KindMysqlDecimal:
+		s, _ := a.numberText(d, v.GetMysqlDecimal().String(), collect)
+		dec := new(types.MyDecimal)
+		if err := dec.FromString([]byte(s)); err == nil && !collect {
+			v.SetMysqlDecimal(dec)
+		}
+	case types.KindString, types.KindBytes:
+		if s := a.stringText(d, v.GetString(), pattern, collect); !collect {
+			v.SetString(s, v.Collation())
+		}
+	}
+}
+
+// literals are literals in a statement out of partition definitions.
+type literals struct {
+	values   map[*driver.ValueExpr]bool
+	columns  map[*driver.ValueExpr]string // the column compared with the literal, e.g. `a` for `a > 1` and `a in (1, 2)`
+	patterns map[*driver.ValueExpr]bool   // LIKE patterns
+}
+
+func findLiterals(stmt ast.StmtNode) *literals {
+	v := &literalVisitor{lits: &literals{
+		values:   make(map[*driver.ValueExpr]bool),
+		columns:  make(map[*driver.ValueExpr]string),
+		patterns: make(map[*driver.ValueExpr]bool),
+	}}
+	stmt.Accept(v)
+	return v.lits
+}
+
+// literalVisitor finds literals and the columns they are compared with, literals in a column definition belong to the
+// column, e.g. its default value.
+type literalVisitor struct {
+	lits        *literals
+	column      string // the column being defined
+	inPartition bool
+}
+
+func (v *literalVisitor) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
+	switch x := n.(type) {
+	case *ast.ColumnDef:
+		v.column = x.Name.Name.L
+	case *ast.PartitionOptions:
+		v.inPartition = true
+	case *ast.BinaryOperationExpr:
+		switch x.Op {
+		case opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+			v.compare(x.L, x.R)
+			v.compare(x.R, x.L)
+		}
+	case *ast.PatternInExpr:
+		for _, item := range x.List {
+			v.compare(x.Expr, item)
+		}
+	case *ast.BetweenExpr:
+		v.compare(x.Expr, x.Left)
+		v.compare(x.Expr, x.Right)
+	case *ast.PatternLikeExpr:
+		if val, ok := x.Pattern.(*driver.ValueExpr); ok && v.compare(x.Expr, val) {
+			v.lits.patterns[val] = true
+		}
+	case *driver.ValueExpr:
+		if !v.inPartition {
+			v.lits.values[x] = true
+			if _, ok := v.lits.columns[x]; !ok && v.column != "" {
+				v.lits.columns[x] = v.column
+			}
+		}
+	}
+	return n, false
+}
+
+func (v *literalVisitor) compare(col, val ast.ExprNode) bool {
+	c, ok1 := col.(*ast.ColumnNameExpr)
+	l, ok2 := val.(*driver.ValueExpr)
+	if ok1 && ok2 {
+		v.lits.columns[l] = c.Name.Name.L
+	}
+	return ok1 && ok2
+}
+
+func (v *literalVisitor) Leave(n ast.Node) (out ast.Node, ok bool) {
+	switch n.(type) {
+	case *ast.ColumnDef:
+		v.column = ""
+	case *ast.PartitionOptions:
+		v.inPartition = false
+	}
+	return n, true
+}
+
+// anonymizeVisitor renames identifiers and replaces literals in a statement.
+type anonymizeVisitor struct {
+	a       *Anonymizer
+	aliases map[string]bool // table aliases, which are not renamed
+	lits    *literals
+}
+
+func (v *anonymizeVisitor) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
+	m := &v.a.mapping
+	switch x := n.(type) {
+	case *ast.CreateDatabaseStmt:
+		x.Name = lookupIdentifier(m.Schemas, x.Name)
+	case *ast.UseStmt:
+		x.DBName = lookupIdentifier(m.Schemas, x.DBName)
+	case *ast.CreateTableStmt:
+		for _, opt := range x.Options {
+			if opt.Tp == ast.TableOptionComment {
+				opt.StrValue = v.a.anonymizeString(opt.StrValue)
+			}
+		}
+	case *ast.ColumnDef:
+		if x.Tp != nil {
+			for i, elem := range x.Tp.Elems { // ENUM and SET values
+				x.Tp.Elems[i] = v.a.stringText(v.a.domain(x.Name.Name.L), elem, false, false)
+			}
+		}
+	case *ast.Constraint:
+		x.Name = lookupIdentifier(m.Indexes, x.Name)
+	case *ast.CreateIndexStmt:
+		x.IndexName = lookupIdentifier(m.Indexes, x.IndexName)
+	case *ast.TableName:
+		x.Schema = renameCIStr(m.Schemas, x.Schema)
+		x.Name = renameCIStr(m.Tables, x.Name)
+		for _, hint := range x.IndexHints {
+			for i, idx := range hint.IndexNames {
+				hint.IndexNames[i] = renameCIStr(m.Indexes, idx)
+			}
+		}
+	case *ast.ColumnName:
+		x.Schema = renameCIStr(m.Schemas, x.Schema)
+		if !v.aliases[x.Table.L] {
+			x.Table = renameCIStr(m.Tables, x.Table)
+		}
+		x.Name = renameCIStr(m.Columns, x.Name)
+	}
+	return n, false
+}
+
+func (v *anonymizeVisitor) Leave(n ast.Node) (out ast.Node, ok bool) {
+	if x, ok := n.(*driver.ValueExpr); ok && v.lits.values[x] { // partition bounds are kept to keep them in order
+		v.a.literalValue(x, v.lits.columns[x], v.lits.patterns[x], false)
+	}
+	return n, true
+}
+func renameCIStr(m map[string]string, name model.CIStr) model.CIStr {
+	if v, ok := m[name.L]; ok {
+		return model.NewCIStr(v)
+	}
+	return name
+}
+
+// tableAliasCollector collects all table aliases in a statement.
+type tableAliasCollector struct {
+	aliases map[string]bool
+}
+
+func (c *tableAliasCollector) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
+	if x, ok := n.(*ast.TableSource); ok && x.AsName.L != "" {
+		c.aliases[x.AsName.L] = true
+	}
+	return n, false
+}
+
+func (c *tableAliasCollector) Leave(n ast.Node) (out ast.Node, ok bool) {
+	return n, true
+}
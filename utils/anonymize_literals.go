@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"math"
+	mrand "math/rand"
+	"sort"
+)
+
+// literalDomain maps literals of a column to synthetic ones while keeping their order, so range predicates in queries
+// and bounds in statistics still cover the same values after anonymization.
+// Literals are collected first, and the mapping is built on the first lookup. Literals that are not collected are
+// mapped on demand, their order is kept as much as possible.
+type literalDomain struct {
+	numbers map[float64]bool
+	anchors []float64           // sorted collected numbers
+	images  map[float64]float64 // number --> synthetic number
+	strings *charTrieNode
+	frozen  bool
+}
+
+func newLiteralDomain() *literalDomain {
+	return &literalDomain{
+		numbers: make(map[float64]bool),
+		images:  make(map[float64]float64),
+		strings: newCharTrieNode(),
+	}
+}
+
+func (d *literalDomain) addNumber(f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return
+	}
+	d.numbers[f] = true
+}
+
+func (d *literalDomain) addString(s string) {
+	node := d.strings
+	for _, c := range s {
+		node = node.child(c)
+	}
+}
+
+// freeze builds the mapping of all collected literals.
+func (d *literalDomain) freeze(r *mrand.Rand) {
+	if d.frozen {
+		return
+	}
+	d.frozen = true
+	for f := range d.numbers {
+		d.anchors = append(d.anchors, f)
+	}
+	sort.Float64s(d.anchors)
+	for i, v := range d.anchors {
+		lo, hi := numberCell(d.anchors, i)
+		d.images[v] = numberInCell(r, v, lo, hi)
+	}
+	d.strings.assign(r)
+}
+
+// numberCell returns the open interval that the image of anchors[i] must be in. Cells of different anchors don't
+// overlap, so images keep the order of anchors, and images keep the sign of anchors.
+func numberCell(anchors []float64, i int) (lo, hi float64) {
+	v := anchors[i]
+	edge := math.Max(math.Abs(v)*0.2, 2)
+	if len(anchors) > 1 {
+		if i > 0 {
+			edge = math.Min(edge, v-anchors[i-1])
+		} else {
+			edge = math.Min(edge, anchors[i+1]-v)
+		}
+	}
+	lo, hi = v-edge, v+edge
+	if i > 0 {
+		lo = (anchors[i-1] + v) / 2
+	}
+	if i+1 < len(anchors) {
+		hi = (v + anchors[i+1]) / 2
+	}
+	if v >= 0 {
+		lo = math.Max(lo, 0)
+	}
+	if v <= 0 {
+		hi = math.Min(hi, 0)
+	}
+	return lo, hi
+}
+
+// numberInCell returns a random number in the cell (lo, hi) of v, integers are mapped to other integers.
+func numberInCell(r *mrand.Rand, v, lo, hi float64) float64 {
+	if v == math.Trunc(v) {
+		l, h := math.Floor(lo)+1, math.Ceil(hi)-1
+		if v == 0 || h <= l {
+			return v
+		}
+		w := l + math.Floor(r.Float64()*(h-l+1))
+		if w == v { // try to avoid keeping the original value
+			if w < h {
+				w++
+			} else {
+				w--
+			}
+		}
+		return math.Max(l, math.Min(h, w))
+	}
+	u := r.Float64()*2 - 1
+	if u < 0 {
+		return v + u*0.9*(v-lo)
+	}
+	return v + u*0.9*(hi-v)
+}
+
+func (d *literalDomain) mapNumber(f float64, r *mrand.Rand) float64 {
+	d.freeze(r)
+	if w, ok := d.images[f]; ok {
+		return w
+	}
+	var w float64
+	i := sort.SearchFloat64s(d.anchors, f)
+	switch {
+	case len(d.anchors) == 0:
+		w = numberInCell(r, f, f-math.Max(math.Abs(f)*0.2, 2), f+math.Max(math.Abs(f)*0.2, 2))
+	case i == 0:
+		w = f + d.images[d.anchors[0]] - d.anchors[0]
+	case i == len(d.anchors):
+		w = f + d.images[d.anchors[i-1]] - d.anchors[i-1]
+	default: // interpolate between images of neighbors
+		lo, hi := d.anchors[i-1], d.anchors[i]
+		w = d.images[lo] + (f-lo)/(hi-lo)*(d.images[hi]-d.images[lo])
+		if f == math.Trunc(f) {
+			w = math.Round(w)
+		}
+	}
+	d.images[f] = w
+	return w
+}
+
+func (d *literalDomain) mapString(s string, r *mrand.Rand) string {
+	d.freeze(r)
+	node := d.strings
+	result := make([]rune, 0, len(s))
+	for _, c := range s {
+		result = append(result, node.imageOf(c, r))
+		node = node.child(c)
+	}
+	return string(result)
+}
+
+// charClass is a range of characters that are mapped to each other, characters out of classes are kept.
+type charClass struct {
+	lo, hi rune
+}
+
+var (
+	charClasses  = []charClass{{'0', '9'}, {'A', 'Z'}, {'a', 'z'}}
+	nonASCIIChar = charClass{0x4E00, 0x9FA5} // non-ASCII characters are mapped to CJK characters
+)
+
+func classOf(c rune) (charClass, bool) {
+	if c > 127 {
+		return nonASCIIChar, true
+	}
+	for _, cls := range charClasses {
+		if c >= cls.lo && c <= cls.hi {
+			return cls, true
+		}
+	}
+	return charClass{}, false
+}
+
+// charTrieNode is a node of the trie of strings. Characters following the same prefix are mapped to distinct characters
+// of the same class in the same order, so strings keep their order, length and shared prefixes after mapping.
+type charTrieNode struct {
+	children map[rune]*charTrieNode
+	images   map[rune]rune
+}
+
+func newCharTrieNode() *charTrieNode {
+	return &charTrieNode{children: make(map[rune]*charTrieNode), images: make(map[rune]rune)}
+}
+
+func (n *charTrieNode) child(c rune) *charTrieNode {
+	ch, ok := n.children[c]
+	if !ok {
+		ch = newCharTrieNode()
+		n.children[c] = ch
+	}
+	return ch
+}
+
+// assign maps all children of the node and its descendants.
+func (n *charTrieNode) assign(r *mrand.Rand) {
+	groups := make(map[charClass][]rune)
+	for c, ch := range n.children {
+		if cls, ok := classOf(c); ok {
+			groups[cls] = append(groups[cls], c)
+		} else {
+			n.images[c] = c
+		}
+		ch.assign(r)
+	}
+	for cls, chars := range groups {
+		size := int(cls.hi - cls.lo + 1)
+		if len(chars) > size {
+			for _, c := range chars {
+				n.images[c] = c
+			}
+			continue
+		}
+		sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+		images := sampleSorted(r, size, len(chars))
+		for i, c := range chars {
+			n.images[c] = cls.lo + rune(images[i])
+		}
+	}
+}
+
+// sampleSorted returns k distinct random numbers in [0, n) in ascending order.
+func sampleSorted(r *mrand.Rand, n, k int) []int {
+	chosen := make(map[int]bool, k)
+	for j := n - k; j < n; j++ { // Floyd's algorithm
+		if t := r.Intn(j + 1); chosen[t] {
+			chosen[j] = true
+		} else {
+			chosen[t] = true
+		}
+	}
+	result := make([]int, 0, k)
+	for v := range chosen {
+		result = append(result, v)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// imageOf returns the image of the child c, a child that is not collected is mapped to an unused character between
+// images of its neighbors if possible.
+func (n *charTrieNode) imageOf(c rune, r *mrand.Rand) rune {
+	if img, ok := n.images[c]; ok {
+		return img
+	}
+	n.child(c)
+	cls, ok := classOf(c)
+	if !ok {
+		n.images[c] = c
+		return c
+	}
+	lo, hi := cls.lo, cls.hi
+	used := make(map[rune]bool)
+	for o, img := range n.images {
+		if oc, ok := classOf(o); !ok || oc != cls {
+			continue
+		}
+		used[img] = true
+		if o < c && img >= lo {
+			lo = img + 1
+		}
+		if o > c && img <= hi {
+			hi = img - 1
+		}
+	}
+	if lo > hi { // no room between neighbors, give up the order
+		lo, hi = cls.lo, cls.hi
+	}
+	var candidates []rune
+	for x := lo; x <= hi; x++ {
+		if !used[x] {
+			candidates = append(candidates, x)
+		}
+	}
+	img := c
+	if len(candidates) > 0 {
+		img = candidates[r.Intn(len(candidates))]
+	}
+	n.images[c] = img
+	return img
+}
@@ -1,9 +1,13 @@
 package utils
 
 import (
-	"github.com/pingcap/parser/format"
+	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/pingcap/parser/format"
+
 	"github.com/pingcap/parser"
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/opcode"
@@ -23,40 +27,45 @@ const (
 )
 
 // GetStmtType returns the type of the given statement.
-func GetStmtType(stmt string) StmtType {
-	containAll := func(s string, substrs ...string) bool {
-		s = strings.ToLower(s)
-		for _, substr := range substrs {
-			if !strings.Contains(s, substr) {
-				return false
-			}
-		}
-		return true
+func GetStmtType(stmt string) (StmtType, error) {
+	node, err := ParseOneSQL(stmt)
+	if err != nil {
+		return StmtUnknown, err
 	}
-
-	if containAll(stmt, "create", "database") {
-		return StmtCreateDB
-	} else if containAll(stmt, "create", "table") {
-		return StmtCreateTable
-	} else if containAll(stmt, "create", "index") {
-		return StmtCreateIndex
-	} else if containAll(stmt, "select", "from") {
-		return StmtSelect
-	} else if containAll(stmt, "use") {
-		return StmtUseDB
+	switch node.(type) {
+	case *ast.CreateDatabaseStmt:
+		return StmtCreateDB, nil
+	case *ast.UseStmt:
+		return StmtUseDB, nil
+	case *ast.CreateTableStmt:
+		return StmtCreateTable, nil
+	case *ast.CreateIndexStmt:
+		return StmtCreateIndex, nil
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		return StmtSelect, nil
 	}
-	return StmtUnknown
+	return StmtUnknown, nil
 }
 
 // GetDBNameFromUseDBStmt returns the database name of the given `USE` statement.
 func GetDBNameFromUseDBStmt(stmt string) string {
-	db := strings.Split(stmt, " ")[1]
+	if node, err := ParseOneSQL(stmt); err == nil {
+		if use, ok := node.(*ast.UseStmt); ok {
+			return use.DBName
+		}
+	}
+	db := strings.Fields(stmt)[1]
 	db = strings.Trim(db, "` '\"")
 	return db
 }
 
 // GetDBNameFromCreateDBStmt returns the database name of the given `CREATE DATABASE` statement.
 func GetDBNameFromCreateDBStmt(stmt string) string {
+	if node, err := ParseOneSQL(stmt); err == nil {
+		if create, ok := node.(*ast.CreateDatabaseStmt); ok {
+			return create.Name
+		}
+	}
 	tmp := strings.Split(stmt, " ")
 	db := tmp[len(tmp)-1]
 	db = strings.Trim(db, "` '\"")
@@ -69,6 +78,180 @@ func ParseOneSQL(sqlText string) (ast.StmtNode, error) {
 	return p.ParseOneStmt(sqlText, "", "")
 }
 
+// ParseQuery parses the given Query text to analyze it, e.g. to find indexable columns and referenced tables.
+// `v MEMBER OF (arr)`, which is not supported by the parser yet, is parsed as the equivalent
+// `json_contains(arr, json_array(v))`, so the AST should not be restored to execute it.
+func ParseQuery(sqlText string) (ast.StmtNode, error) {
+	p := parser.New()
+	return p.ParseOneStmt(rewriteMemberOf(sqlText), "", "")
+}
+
+// rewriteMemberOf rewrites `v MEMBER OF (arr)` to `json_contains(arr, json_array(v))`. The value can be a constant,
+// a `?`, a column or a function call, and string literals, quoted identifiers and comments are kept as they are.
+func rewriteMemberOf(sqlText string) string {
+	for {
+		tokens := tokenizeSQL(sqlText)
+		i := findMemberOf(sqlText, tokens)
+		if i < 0 {
+			return sqlText
+		}
+		valueBegin := operandBegin(sqlText, tokens, i-1)
+		argEnd := matchingParen(sqlText, tokens, i+2)
+		if valueBegin < 0 || argEnd < 0 { // let the parser report the error
+			return sqlText
+		}
+		value := sqlText[tokens[valueBegin].begin:tokens[i-1].end]
+		arg := sqlText[tokens[i+2].end:tokens[argEnd].begin]
+		sqlText = fmt.Sprintf("%vjson_contains(%v, json_array(%v))%v",
+			sqlText[:tokens[valueBegin].begin], strings.TrimSpace(arg), value, sqlText[tokens[argEnd].end:])
+	}
+}
+
+// sqlToken is a token in a SQL text, comments and spaces are skipped.
+type sqlToken struct {
+	begin, end int
+	kind       byte // 'w' for words and numbers, 's' for strings, 'q' for quoted identifiers, '?' for parameter markers, 'p' for others
+}
+
+func tokenizeSQL(sqlText string) []sqlToken {
+	var tokens []sqlToken
+	isWord := func(c byte) bool {
+		return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+	}
+	for i := 0; i < len(sqlText); {
+		c := sqlText[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(sqlText[i:], "-- ")):
+			for i < len(sqlText) && sqlText[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sqlText[i:], "/*"):
+			if j := strings.Index(sqlText[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(sqlText)
+			}
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(sqlText) {
+				if sqlText[j] == '\\' && c != '`' {
+					j += 2
+					continue
+				}
+				if sqlText[j] == c {
+					if j+1 < len(sqlText) && sqlText[j+1] == c { // escaped by doubling
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			kind := byte('s')
+			if c == '`' {
+				kind = 'q'
+			}
+			end := Min(j+1, len(sqlText))
+			tokens = append(tokens, sqlToken{i, end, kind})
+			i = end
+		case isWord(c):
+			j := i
+			for j < len(sqlText) && isWord(sqlText[j]) {
+				j++
+			}
+			if c >= '0' && c <= '9' && j < len(sqlText) && sqlText[j] == '.' { // decimals like 1.5
+				for j++; j < len(sqlText) && isWord(sqlText[j]); j++ {
+				}
+			}
+			tokens = append(tokens, sqlToken{i, j, 'w'})
+			i = j
+		case c == '?':
+			tokens = append(tokens, sqlToken{i, i + 1, '?'})
+			i++
+		default:
+			tokens = append(tokens, sqlToken{i, i + 1, 'p'})
+			i++
+		}
+	}
+	return tokens
+}
+
+// findMemberOf returns the index of the `MEMBER` token of the first `MEMBER OF (`, or -1 if there is none.
+func findMemberOf(sqlText string, tokens []sqlToken) int {
+	text := func(t sqlToken) string { return sqlText[t.begin:t.end] }
+	for i := 1; i+2 < len(tokens); i++ {
+		if tokens[i].kind == 'w' && strings.EqualFold(text(tokens[i]), "member") &&
+			tokens[i+1].kind == 'w' && strings.EqualFold(text(tokens[i+1]), "of") && text(tokens[i+2]) == "(" {
+			return i
+		}
+	}
+	return -1
+}
+
+// operandBegin returns the index of the first token of the operand ending at tokens[end], e.g. `t.a`, `'abc'`, `-1`
+// or `json_extract(j, '$.a')`, or -1 if it's not an operand.
+func operandBegin(sqlText string, tokens []sqlToken, end int) int {
+	text := func(i int) string { return sqlText[tokens[i].begin:tokens[i].end] }
+	begin := end
+	switch {
+	case text(end) == ")":
+		depth := 0
+		for begin = end; begin >= 0; begin-- {
+			if text(begin) == ")" {
+				depth++
+			} else if text(begin) == "(" {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		if begin < 0 {
+			return -1
+		}
+		if begin > 0 && (tokens[begin-1].kind == 'w' || tokens[begin-1].kind == 'q') { // a function call
+			begin--
+		}
+	case tokens[end].kind == 'p':
+		return -1
+	}
+	for begin >= 2 && text(begin-1) == "." && (tokens[begin-2].kind == 'w' || tokens[begin-2].kind == 'q') { // qualified names
+		begin -= 2
+	}
+	if begin >= 1 && (text(begin-1) == "-" || text(begin-1) == "+") && tokens[begin].kind == 'w' &&
+		text(begin)[0] >= '0' && text(begin)[0] <= '9' { // signed numbers
+		if begin == 1 || (tokens[begin-2].kind == 'p' && text(begin-2) != ")") ||
+			(tokens[begin-2].kind == 'w' && unaryPrecedingKeywords[strings.ToLower(text(begin-2))]) {
+			begin--
+		}
+	}
+	return begin
+}
+
+// unaryPrecedingKeywords are keywords after which `-` and `+` are signs instead of binary operators.
+var unaryPrecedingKeywords = map[string]bool{"and": true, "or": true, "xor": true, "not": true, "where": true,
+	"having": true, "on": true, "when": true, "then": true, "else": true, "select": true}
+
+// matchingParen returns the index of the `)` matching the `(` at tokens[open], or -1 if it's unbalanced.
+func matchingParen(sqlText string, tokens []sqlToken, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		if tokens[i].kind != 'p' {
+			continue
+		}
+		switch sqlText[tokens[i].begin] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 // NormalizeDigest normalizes the given Query text and returns the normalized Query text and its digest.
 func NormalizeDigest(sqlText string) (string, string) {
 	return parser.NormalizeDigest(sqlText)
@@ -123,7 +306,7 @@ func (c *tableNameCollector) Leave(n ast.Node) (out ast.Node, ok bool) {
 // The returned format is `schemaName.tableName`.
 // TODO: handle views and CTEs.
 func CollectTableNamesFromSQL(defaultSchemaName, sqlText string) (Set[TableName], error) {
-	node, err := ParseOneSQL(sqlText)
+	node, err := ParseQuery(sqlText)
 	if err != nil {
 		return nil, err
 	}
@@ -157,171 +340,261 @@ func IsTiDBSystemTableName(t TableName) bool {
 		schemaName == "mysql"
 }
 
-type selectColExtractor struct {
-	selectCols       Set[Column]
-	t                TableName
-	underSelectField bool
+// QueryBlock represents the columns of a query block (a single SELECT) that index heuristics care about.
+// Every SELECT in a query is a query block, including SELECTs in UNIONs, derived tables, CTEs and subqueries.
+type QueryBlock struct {
+	SelectColumns  Set[Column] // columns in select fields, nil if they can't be resolved to a single table
+	OrderByColumns []Column    // columns in the order-by clause, nil if they can't be resolved to a single table
+	DNFColumns     Set[Column] // columns in DNF predicates like `c1=1 or c2=2`
 }
 
-func (e *selectColExtractor) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
-	switch x := n.(type) {
-	case *ast.SelectField:
-		e.underSelectField = true
-	case *ast.ColumnNameExpr:
-		if e.underSelectField {
-			e.selectCols.Add(Column{
-				SchemaName: e.t.SchemaName,
-				TableName:  e.t.TableName,
-				ColumnName: x.Name.Name.O})
-		}
+// ParseQueryBlocks parses the given Query and returns all its query blocks.
+func ParseQueryBlocks(q Query) ([]QueryBlock, error) {
+	node, err := ParseQuery(q.Text)
+	if err != nil {
+		return nil, err
 	}
-	return n, false
+	c := &queryBlockCollector{cteNames: NewSet[TableName]()}
+	node.Accept(c)
+
+	blocks := make([]QueryBlock, 0, len(c.stmts))
+	for _, stmt := range c.stmts {
+		r := newBlockResolver(q.SchemaName, stmt, c.cteNames)
+		blocks = append(blocks, QueryBlock{
+			SelectColumns:  r.selectColumns(),
+			OrderByColumns: r.orderByColumns(),
+			DNFColumns:     r.dnfColumns(),
+		})
+	}
+	return blocks, nil
 }
 
-func (e *selectColExtractor) Leave(n ast.Node) (out ast.Node, ok bool) {
-	switch n.(type) {
-	case *ast.SelectField:
-		e.underSelectField = false
+// ParseSelectColumnsFromQuery returns all column names in select field of each query block.
+// Query blocks whose select fields can't be resolved to a single table are skipped.
+func ParseSelectColumnsFromQuery(q Query) ([]Set[Column], error) {
+	blocks, err := ParseQueryBlocks(q)
+	if err != nil {
+		return nil, err
 	}
-	return n, true
+	var result []Set[Column]
+	for _, b := range blocks {
+		if b.SelectColumns != nil && b.SelectColumns.Size() > 0 {
+			result = append(result, b.SelectColumns)
+		}
+	}
+	return result, nil
 }
 
-// ParseSelectColumnsFromQuery returns all column names in select field.
-func ParseSelectColumnsFromQuery(q Query) (Set[Column], error) {
-	t, err := CollectTableNamesFromSQL(q.SchemaName, q.Text)
+// ParseOrderByColumnsFromQuery returns all column names in order by field of each query block.
+// For a query `select ... order by c1, c2, c3`, the order by columns are `c1`, `c2` and `c3`.
+func ParseOrderByColumnsFromQuery(q Query) ([][]Column, error) {
+	blocks, err := ParseQueryBlocks(q)
 	if err != nil {
 		return nil, err
 	}
-	if t.Size() != 1 { // unsupported yet
-		return nil, nil
+	var result [][]Column
+	for _, b := range blocks {
+		if len(b.OrderByColumns) > 0 {
+			result = append(result, b.OrderByColumns)
+		}
 	}
-	node, err := ParseOneSQL(q.Text)
+	return result, nil
+}
+
+// ParseDNFColumnsFromQuery parses the given Query text and returns the DNF columns of each query block.
+// For a query `select ... where c1=1 or c2=2 or c3=3`, the DNF columns are `c1`, `c2` and `c3`.
+func ParseDNFColumnsFromQuery(q Query) ([]Set[Column], error) {
+	blocks, err := ParseQueryBlocks(q)
 	if err != nil {
 		return nil, err
 	}
-	e := &selectColExtractor{
-		selectCols: NewSet[Column](),
-		t:          t.ToList()[0],
+	var result []Set[Column]
+	for _, b := range blocks {
+		if b.DNFColumns.Size() > 0 {
+			result = append(result, b.DNFColumns)
+		}
 	}
-	node.Accept(e)
-	return e.selectCols, nil
+	return result, nil
 }
 
-type orderByColExtractor struct {
-	orderByCols []Column
-	t           TableName
-	exit        bool
+// queryBlockCollector collects all SELECT statements and CTE names in a query.
+type queryBlockCollector struct {
+	stmts    []*ast.SelectStmt
+	cteNames Set[TableName]
 }
 
-func (e *orderByColExtractor) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
-	if e.exit {
-		return n, true
-	}
+func (c *queryBlockCollector) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
 	switch x := n.(type) {
-	case *ast.OrderByClause:
-		for _, byItem := range x.Items {
-			colExpr, ok := byItem.Expr.(*ast.ColumnNameExpr)
-			if !ok {
-				e.orderByCols = nil
-				e.exit = true
-				return n, true
-			}
-			e.orderByCols = append(e.orderByCols, Column{
-				SchemaName: e.t.SchemaName,
-				TableName:  e.t.TableName,
-				ColumnName: colExpr.Name.Name.O})
+	case *ast.WithClause:
+		for _, cte := range x.CTEs {
+			c.cteNames.Add(TableName{TableName: cte.Name.L})
 		}
+	case *ast.SelectStmt:
+		c.stmts = append(c.stmts, x)
 	}
 	return n, false
 }
 
-func (e *orderByColExtractor) Leave(n ast.Node) (out ast.Node, ok bool) {
+func (c *queryBlockCollector) Leave(n ast.Node) (out ast.Node, ok bool) {
 	return n, true
 }
 
-// ParseOrderByColumnsFromQuery returns all column names in order by field.
-// For a query `select ... order by c1, c2, c3`, the order by columns are `c1`, `c2` and `c3`.
-func ParseOrderByColumnsFromQuery(q Query) ([]Column, error) {
-	t, err := CollectTableNamesFromSQL(q.SchemaName, q.Text)
-	if err != nil {
-		return nil, err
-	}
-	if t.Size() != 1 { // unsupported yet
-		return nil, nil
+// blockResolver resolves columns in a query block to the tables in its FROM clause.
+type blockResolver struct {
+	stmt    *ast.SelectStmt
+	tables  map[string]TableName // alias or table name --> table, derived tables and CTEs are not included
+	sources int                  // the number of table sources in the FROM clause
+}
+
+func newBlockResolver(defaultSchemaName string, stmt *ast.SelectStmt, cteNames Set[TableName]) *blockResolver {
+	r := &blockResolver{stmt: stmt, tables: make(map[string]TableName)}
+	if stmt.From == nil || stmt.From.TableRefs == nil {
+		return r
 	}
-	node, err := ParseOneSQL(q.Text)
-	if err != nil {
-		return nil, err
+	var walk func(node ast.ResultSetNode)
+	walk = func(node ast.ResultSetNode) {
+		switch x := node.(type) {
+		case *ast.Join:
+			walk(x.Left)
+			if x.Right != nil {
+				walk(x.Right)
+			}
+		case *ast.TableSource:
+			r.sources++
+			tbl, ok := x.Source.(*ast.TableName)
+			if !ok { // derived table
+				return
+			}
+			if tbl.Schema.L == "" && cteNames.Contains(TableName{TableName: tbl.Name.L}) {
+				return
+			}
+			t := TableName{SchemaName: defaultSchemaName, TableName: tbl.Name.String()}
+			if tbl.Schema.L != "" {
+				t.SchemaName = tbl.Schema.O
+			}
+			alias := tbl.Name.L
+			if x.AsName.L != "" {
+				alias = x.AsName.L
+			}
+			r.tables[alias] = t
+		}
 	}
-	e := &orderByColExtractor{
-		t: t.ToList()[0],
+	walk(stmt.From.TableRefs)
+	return r
+}
+
+// resolve returns the column of the given column name, or false if it's ambiguous or not from a base table.
+func (r *blockResolver) resolve(x *ast.ColumnName) (Column, bool) {
+	var t TableName
+	if x.Table.L != "" {
+		tbl, ok := r.tables[x.Table.L]
+		if !ok || (x.Schema.L != "" && strings.ToLower(tbl.SchemaName) != x.Schema.L) {
+			return Column{}, false
+		}
+		t = tbl
+	} else {
+		if r.sources != 1 || len(r.tables) != 1 {
+			return Column{}, false
+		}
+		for _, tbl := range r.tables {
+			t = tbl
+		}
 	}
-	node.Accept(e)
-	return e.orderByCols, nil
+	return Column{SchemaName: t.SchemaName, TableName: t.TableName, ColumnName: x.Name.O}, true
 }
 
-// ParseDNFColumnsFromQuery parses the given Query text and returns the DNF columns.
-// For a query `select ... where c1=1 or c2=2 or c3=3`, the DNF columns are `c1`, `c2` and `c3`.
-func ParseDNFColumnsFromQuery(q Query) (Set[Column], error) {
-	t, err := CollectTableNamesFromSQL(q.SchemaName, q.Text)
-	if err != nil {
-		return nil, err
+// resolveSingleTable resolves all columns and returns nil if any of them can't be resolved or they are from different tables.
+func (r *blockResolver) resolveSingleTable(names []*ast.ColumnName) []Column {
+	var cols []Column
+	for _, name := range names {
+		col, ok := r.resolve(name)
+		if !ok || (len(cols) > 0 && (cols[0].SchemaName != col.SchemaName || cols[0].TableName != col.TableName)) {
+			return nil
+		}
+		cols = append(cols, col)
 	}
-	if t.Size() != 1 { // unsupported yet
-		return nil, nil
+	return cols
+}
+
+func (r *blockResolver) selectColumns() Set[Column] {
+	if r.stmt.Fields == nil {
+		return nil
 	}
-	node, err := ParseOneSQL(q.Text)
-	if err != nil {
-		return nil, err
+	var names []*ast.ColumnName
+	for _, f := range r.stmt.Fields.Fields {
+		if f.WildCard != nil {
+			return nil
+		}
+		c := &blockColumnCollector{}
+		f.Expr.Accept(c)
+		names = append(names, c.names...)
 	}
-	e := &dnfColExtractor{
-		dnfCols: NewSet[Column](),
-		t:       t.ToList()[0],
+	cols := r.resolveSingleTable(names)
+	if cols == nil {
+		return nil
 	}
-	node.Accept(e)
-	return e.dnfCols, nil
+	return ListToSet(cols...)
 }
 
-type dnfColExtractor struct {
-	dnfCols Set[Column]
-	t       TableName
+func (r *blockResolver) orderByColumns() []Column {
+	if r.stmt.OrderBy == nil {
+		return nil
+	}
+	var names []*ast.ColumnName
+	for _, byItem := range r.stmt.OrderBy.Items {
+		colExpr, ok := byItem.Expr.(*ast.ColumnNameExpr)
+		if !ok {
+			return nil
+		}
+		names = append(names, colExpr.Name)
+	}
+	return r.resolveSingleTable(names)
 }
 
-func (d *dnfColExtractor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
-	if d.dnfCols.Size() > 0 { // already collected
-		return n, true
+func (r *blockResolver) dnfColumns() Set[Column] {
+	dnfCols := NewSet[Column]()
+	if r.stmt.Where == nil {
+		return dnfCols
 	}
-	switch x := n.(type) {
-	case *ast.SelectStmt:
-		cnf := flattenCNF(x.Where)
-		for _, expr := range cnf {
-			dnf := flattenDNF(expr)
-			if len(dnf) <= 1 {
-				continue
-			}
-			// c1=1 or c2=2 or c3=3
-			var dnfCols []*ast.ColumnNameExpr
-			fail := false
-			for _, dnfExpr := range dnf {
-				col, _ := flattenColEQConst(dnfExpr)
-				if col == nil {
-					fail = true
-					break
-				}
-				dnfCols = append(dnfCols, col)
-			}
-			if fail {
-				continue
-			}
-			for _, col := range dnfCols {
-				d.dnfCols.Add(Column{SchemaName: d.t.SchemaName, TableName: d.t.TableName, ColumnName: col.Name.Name.O})
+	for _, expr := range flattenCNF(r.stmt.Where) {
+		dnf := flattenDNF(expr)
+		if len(dnf) <= 1 {
+			continue
+		}
+		// c1=1 or c2=2 or c3=3
+		var names []*ast.ColumnName
+		for _, dnfExpr := range dnf {
+			col, _ := flattenColEQConst(dnfExpr)
+			if col == nil {
+				names = nil
+				break
 			}
+			names = append(names, col.Name)
+		}
+		if len(names) == 0 {
+			continue
 		}
+		dnfCols.AddList(r.resolveSingleTable(names)...)
+	}
+	return dnfCols
+}
+
+// blockColumnCollector collects all columns in an expression, columns in subqueries are ignored since they belong to other query blocks.
+type blockColumnCollector struct {
+	names []*ast.ColumnName
+}
+
+func (c *blockColumnCollector) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
+	switch x := n.(type) {
+	case *ast.SubqueryExpr:
+		return n, true
+	case *ast.ColumnNameExpr:
+		c.names = append(c.names, x.Name)
 	}
 	return n, false
 }
 
-func (d *dnfColExtractor) Leave(n ast.Node) (node ast.Node, ok bool) {
+func (c *blockColumnCollector) Leave(n ast.Node) (out ast.Node, ok bool) {
 	return n, true
 }
 
@@ -375,3 +648,196 @@ func flattenDNF(expr ast.ExprNode) []ast.ExprNode {
 	}
 	return cnf
 }
+
+var preparedArgumentsPattern = regexp.MustCompile(`(?s)^(.*?)\s*\[arguments: (.*)\]\s*$`)
+
+// ExtractPreparedArguments extracts arguments from the sample text of a prepared statement recorded by TiDB,
+// e.g. `select * from t where a=? and b=? [arguments: (1, "abc")]` --> `select * from t where a=? and b=?`, [`1`, `'abc'`].
+// Arguments are returned as SQL literals, and nil is returned if there is no argument in the text.
+func ExtractPreparedArguments(sqlText string) (string, []string) {
+	m := preparedArgumentsPattern.FindStringSubmatch(sqlText)
+	if m == nil {
+		return sqlText, nil
+	}
+	argsText := strings.TrimSpace(m[2])
+	if strings.HasPrefix(argsText, "(") && strings.HasSuffix(argsText, ")") {
+		argsText = argsText[1 : len(argsText)-1]
+	}
+
+	var args []string
+	var quote byte
+	var cur strings.Builder
+	flush := func() {
+		args = append(args, toSQLLiteral(strings.TrimSpace(cur.String())))
+		cur.Reset()
+	}
+	for i := 0; i < len(argsText); i++ {
+		c := argsText[i]
+		switch {
+		case quote != 0 && c == '\\' && i+1 < len(argsText):
+			cur.WriteByte(c)
+			cur.WriteByte(argsText[i+1])
+			i++
+			continue
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			flush()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	flush()
+	return m[1], args
+}
+
+// toSQLLiteral converts an argument recorded by TiDB to a SQL literal, double-quoted strings are converted to
+// single-quoted ones.
+func toSQLLiteral(arg string) string {
+	if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+		return QuoteSQLString(strings.ReplaceAll(arg[1:len(arg)-1], `\"`, `"`))
+	}
+	return arg
+}
+
+// QuoteSQLString returns the single-quoted SQL literal of the given string.
+func QuoteSQLString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// QuoteSQLIdentifier returns the backquoted SQL identifier of the given name.
+func QuoteSQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// paramMarkerOffsets returns offsets of all `?` parameter markers in the given text, markers in strings,
+// quoted identifiers and comments are ignored.
+func paramMarkerOffsets(sqlText string) []int {
+	var offsets []int
+	for i := 0; i < len(sqlText); i++ {
+		switch c := sqlText[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(sqlText) && sqlText[i] != c; i++ {
+				if sqlText[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(sqlText[i:], "-- ")):
+			for ; i < len(sqlText) && sqlText[i] != '\n'; i++ {
+			}
+		case c == '/' && strings.HasPrefix(sqlText[i:], "/*"):
+			end := strings.Index(sqlText[i+2:], "*/")
+			if end == -1 {
+				return offsets
+			}
+			i += end + 3
+		case c == '?':
+			offsets = append(offsets, i)
+		}
+	}
+	return offsets
+}
+
+// HasParamMarkers returns whether the given text contains `?` parameter markers.
+func HasParamMarkers(sqlText string) bool {
+	return len(paramMarkerOffsets(sqlText)) > 0
+}
+
+// BindParams replaces `?` parameter markers in the given text with the given SQL literals in order.
+func BindParams(sqlText string, args []string) (string, error) {
+	offsets := paramMarkerOffsets(sqlText)
+	if len(offsets) != len(args) {
+		return "", fmt.Errorf("expect %v arguments for %v, got %v", len(offsets), sqlText, len(args))
+	}
+	var sb strings.Builder
+	last := 0
+	for i, offset := range offsets {
+		sb.WriteString(sqlText[last:offset])
+		sb.WriteString(args[i])
+		last = offset + 1
+	}
+	sb.WriteString(sqlText[last:])
+	return sb.String(), nil
+}
+
+// ParseParamMarkerColumns returns the column compared with each `?` parameter marker in the query, e.g.
+// `select * from t where a=? and b in (?, ?) limit ?` --> [t.a, t.b, t.b, {}].
+// An empty column is returned for the marker which is not compared with any column.
+func ParseParamMarkerColumns(q Query) ([]Column, error) {
+	stmt, err := ParseQuery(q.Text)
+	if err != nil {
+		return nil, err
+	}
+	c := &queryBlockCollector{cteNames: NewSet[TableName]()}
+	stmt.Accept(c)
+
+	markerCols := make(map[int]Column)
+	var offsets []int
+	for _, s := range c.stmts {
+		r := newBlockResolver(q.SchemaName, s, c.cteNames)
+		mc := &paramMarkerCollector{root: s, resolver: r, columns: markerCols}
+		s.Accept(mc)
+		offsets = append(offsets, mc.offsets...)
+	}
+	sort.Ints(offsets)
+	cols := make([]Column, 0, len(offsets))
+	for _, offset := range offsets {
+		cols = append(cols, markerCols[offset])
+	}
+	return cols, nil
+}
+
+// paramMarkerCollector collects parameter markers in a query block and the columns they are compared with.
+type paramMarkerCollector struct {
+	root     *ast.SelectStmt
+	resolver *blockResolver
+	offsets  []int
+	columns  map[int]Column // marker offset --> the column compared with it
+}
+
+func (c *paramMarkerCollector) Enter(n ast.Node) (out ast.Node, skipChildren bool) {
+	switch x := n.(type) {
+	case *ast.SelectStmt:
+		return n, x != c.root // other query blocks
+	case *ast.SubqueryExpr:
+		return n, true
+	case *driver.ParamMarkerExpr:
+		c.offsets = append(c.offsets, x.Offset)
+	case *ast.BinaryOperationExpr:
+		switch x.Op {
+		case opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+			c.bind(x.L, x.R)
+			c.bind(x.R, x.L)
+		}
+	case *ast.PatternInExpr:
+		c.bind(x.Expr, x.List...)
+	case *ast.BetweenExpr:
+		c.bind(x.Expr, x.Left, x.Right)
+	case *ast.PatternLikeExpr:
+		c.bind(x.Expr, x.Pattern)
+	}
+	return n, false
+}
+
+// bind records the column of colExpr for markers in exprs.
+func (c *paramMarkerCollector) bind(colExpr ast.ExprNode, exprs ...ast.ExprNode) {
+	colNameExpr, ok := colExpr.(*ast.ColumnNameExpr)
+	if !ok {
+		return
+	}
+	col, ok := c.resolver.resolve(colNameExpr.Name)
+	if !ok {
+		return
+	}
+	for _, expr := range exprs {
+		if marker, ok := expr.(*driver.ParamMarkerExpr); ok {
+			c.columns[marker.Offset] = col
+		}
+	}
+}
+
+func (c *paramMarkerCollector) Leave(n ast.Node) (out ast.Node, ok bool) {
+	return n, true
+}
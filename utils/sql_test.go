@@ -43,9 +43,15 @@ func TestParseOrderByColumnsFromQuery(t *testing.T) {
 			[]string{"test.t.a", "test.t.b"}},
 		{`select * from t where a = 1 and (b =1 or c=1) order by a, b, c`,
 			[]string{"test.t.a", "test.t.b", "test.t.c"}},
+		{`select * from t1, t2 where b =1 or c=1 order by t2.a, t2.b`,
+			[]string{"test.t2.a", "test.t2.b"}},
+		{`select * from (select * from t order by a) tt order by b`,
+			[]string{"test.t.a"}},
 		// unsupported
 		{`select * from t1, t2 where b =1 or c=1 order by a, b, c`,
 			[]string{}},
+		{`select * from t1, t2 where b =1 or c=1 order by t1.a, t2.b`,
+			[]string{}},
 		{`select * from t where a = 1 and b =1 order by a+1, b`,
 			[]string{}},
 	}
@@ -58,8 +64,10 @@ func TestParseOrderByColumnsFromQuery(t *testing.T) {
 		must(err)
 
 		var getColStrs []string
-		for _, col := range result {
-			getColStrs = append(getColStrs, col.Key())
+		for _, cols := range result {
+			for _, col := range cols {
+				getColStrs = append(getColStrs, col.Key())
+			}
 		}
 		get := strings.Join(getColStrs, ",")
 		expected := strings.Join(c.c, ",")
@@ -86,8 +94,18 @@ func TestParseSelectColumnsFromQuery(t *testing.T) {
 			[]string{"test.t.c"}},
 		{`select b, c from t where a = 1 and (b =1 or c=1)`,
 			[]string{"test.t.b", "test.t.c"}},
+		{`select x.a, x.b from t1 x, t2 y where x.c = y.c`,
+			[]string{"test.t1.a", "test.t1.b"}},
+		{`select a from t1 union all select b from t2`,
+			[]string{"test.t1.a", "test.t2.b"}},
+		{`with cte as (select a from t1 where b = 1) select * from cte`,
+			[]string{"test.t1.a"}},
+		{`select a from t1 where b in (select c from t2)`,
+			[]string{"test.t1.a", "test.t2.c"}},
 		{`select * from t1, t2 where b =1 or c=1`,
 			[]string{}}, // unsupported
+		{`select x.a, y.b from t1 x, t2 y where x.c = y.c`,
+			[]string{}}, // unsupported
 	}
 
 	for _, c := range cases {
@@ -96,7 +114,7 @@ func TestParseSelectColumnsFromQuery(t *testing.T) {
 			Text:       c.q,
 		})
 		must(err)
-		checkDNFColResult(result, c.c)
+		checkDNFColResult(UnionSet(result...), c.c)
 	}
 }
 
@@ -117,6 +135,12 @@ func TestParseDNFColumnsFromQuery(t *testing.T) {
 			[]string{"test.t.b", "test.t.c"}},
 		{`select * from t1, t2 where b =1 or c=1`,
 			[]string{}}, // unsupported
+		{`select * from t1, t2 where t2.b =1 or t2.c=1`,
+			[]string{"test.t2.b", "test.t2.c"}},
+		{`select * from t1 where a in (select a from t2 where b=1 or c=1)`,
+			[]string{"test.t2.b", "test.t2.c"}},
+		{`select * from t1 where a=1 or b=1 union select * from t2 where c=1 or d=1`,
+			[]string{"test.t1.a", "test.t1.b", "test.t2.c", "test.t2.d"}},
 		{
 			`SELECT * FROM t WHERE
   				timestamp >= 1647469098 AND timestamp <= 1679005097
@@ -141,7 +165,94 @@ func TestParseDNFColumnsFromQuery(t *testing.T) {
 			Text:       c.q,
 		})
 		must(err)
-		checkDNFColResult(result, c.c)
+		checkDNFColResult(UnionSet(result...), c.c)
+	}
+}
+
+func TestRewriteMemberOf(t *testing.T) {
+	cases := []struct {
+		q      string
+		result string
+	}{
+		{`select * from t where 1 member of (j->'$.ids')`,
+			`select * from t where json_contains(j->'$.ids', json_array(1))`},
+		{`select * from t where 'a' MEMBER OF(json_extract(j, '$.tags')) and ? member of (k)`,
+			`select * from t where json_contains(json_extract(j, '$.tags'), json_array('a')) and json_contains(k, json_array(?))`},
+		{`select * from t where a = 1`,
+			`select * from t where a = 1`},
+		{`select * from t where t.a member of (j->'$.ids') and -1 member of (json_extract(j, '$.ids'))`,
+			`select * from t where json_contains(j->'$.ids', json_array(t.a)) and json_contains(json_extract(j, '$.ids'), json_array(-1))`},
+		{"select * from t where lower(`b`) member of (j) and c = 'x member of (y)' /* 1 member of (j) */",
+			"select * from t where json_contains(j, json_array(lower(`b`))) and c = 'x member of (y)' /* 1 member of (j) */"},
+		{`select * from t where c = 'it''s' and a - 1 member of (j)`,
+			`select * from t where c = 'it''s' and a - json_contains(j, json_array(1))`},
+	}
+	for _, c := range cases {
+		if r := rewriteMemberOf(c.q); r != c.result {
+			t.Errorf("rewriteMemberOf(%s) = %s, expected %s", c.q, r, c.result)
+		}
+		_, err := ParseQuery(c.q)
+		must(err)
+	}
+	if _, err := ParseOneSQL(`select * from t where 1 member of (j)`); err == nil {
+		t.Errorf("MEMBER OF should only be rewritten when analyzing queries")
+	}
+}
+
+func TestExtractPreparedArguments(t *testing.T) {
+	cases := []struct {
+		text string
+		sql  string
+		args string
+	}{
+		{`select * from t where a=1`, `select * from t where a=1`, ``},
+		{`select * from t where a=? [arguments: 1]`, `select * from t where a=?`, `1`},
+		{`select * from t where a=? and b=? [arguments: (1, "a,b")]`, `select * from t where a=? and b=?`, `1|'a,b'`},
+		{`select * from t where a=? [arguments: ("it's \"x\"")]`, `select * from t where a=?`, `'it''s "x"'`},
+	}
+	for _, c := range cases {
+		sql, args := ExtractPreparedArguments(c.text)
+		if sql != c.sql || strings.Join(args, "|") != c.args {
+			t.Errorf("ExtractPreparedArguments(%s) = %s, %v, expected %s, %s", c.text, sql, args, c.sql, c.args)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	sql, err := BindParams(`select '?', "?", a from t where a=? /* ? */ and b in (?, ?) -- ?`, []string{"1", "'x'", "3"})
+	must(err)
+	if sql != `select '?', "?", a from t where a=1 /* ? */ and b in ('x', 3) -- ?` {
+		t.Errorf("unexpected result %s", sql)
+	}
+	if _, err := BindParams(`select * from t where a=?`, nil); err == nil {
+		t.Errorf("expect an error")
+	}
+}
+
+func TestParseParamMarkerColumns(t *testing.T) {
+	cases := []struct {
+		q    string
+		cols string
+	}{
+		{`select * from t where a=? and ?<b and c in (?, ?) limit ?`, `test.t.a,test.t.b,test.t.c,test.t.c,`},
+		{`select * from t1, t2 where t1.a=? and t2.b between ? and ?`, `test.t1.a,test.t2.b,test.t2.b`},
+		{`select * from t1 where a=? and b in (select b from t2 where c like ?)`, `test.t1.a,test.t2.c`},
+		{`select * from t where a+1=?`, ``},
+	}
+	for _, c := range cases {
+		cols, err := ParseParamMarkerColumns(Query{SchemaName: "test", Text: c.q})
+		must(err)
+		var keys []string
+		for _, col := range cols {
+			if col.ColumnName == "" {
+				keys = append(keys, "")
+			} else {
+				keys = append(keys, col.Key())
+			}
+		}
+		if strings.Join(keys, ",") != c.cols {
+			t.Errorf("ParseParamMarkerColumns(%s) = %v, expected %v", c.q, strings.Join(keys, ","), c.cols)
+		}
 	}
 }
 
@@ -80,34 +80,139 @@ func ParseStmtsFromDir(dirPath string) (sqls, fileNames []string, err error) {
 	return
 }
 
+// ScriptStmt is a statement in a SQL script.
+type ScriptStmt struct {
+	Text string
+	Line int // the line number where the statement begins, starting from 1
+}
+
 // ParseStmtsFromFile parses raw Queries from the given file.
-// It ignore all comments, and assume all Queries are separated by ';'.
+// See SplitSQLScript for more details.
 func ParseStmtsFromFile(fpath string) ([]string, error) {
+	stmts, err := ParseScriptFromFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	sqls := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		sqls = append(sqls, stmt.Text)
+	}
+	return sqls, nil
+}
+
+// ParseScriptFromFile parses statements with their line numbers from the given file.
+// See SplitSQLScript for more details.
+func ParseScriptFromFile(fpath string) ([]ScriptStmt, error) {
 	data, err := os.ReadFile(fpath)
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.Split(string(data), "\n")
-	var filteredLines []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "--") { // empty line or comment
-			continue
+	return SplitSQLScript(string(data)), nil
+}
+
+// SplitSQLScript splits the SQL script into statements like the MySQL client does.
+// Statements are separated by ';' or the delimiter specified by `DELIMITER`, and delimiters in string literals,
+// quoted identifiers and comments are ignored. Comments (`-- `, `#` and `/* */`) are removed from statements except
+// executable comments like `/*! */` and `/*T! */`.
+func SplitSQLScript(script string) []ScriptStmt {
+	var stmts []ScriptStmt
+	var cur strings.Builder
+	delimiter := ";"
+	line, stmtLine := 1, 0
+	atLineStart := true // whether only spaces are met in the current line
+
+	flush := func() {
+		if text := strings.TrimSpace(cur.String()); text != "" {
+			stmts = append(stmts, ScriptStmt{Text: text, Line: stmtLine})
 		}
-		filteredLines = append(filteredLines, line)
+		cur.Reset()
+		stmtLine = 0
+	}
+	write := func(s string) {
+		if stmtLine == 0 && strings.TrimSpace(s) != "" {
+			stmtLine = line
+		}
+		cur.WriteString(s)
+		line += strings.Count(s, "\n")
 	}
-	content := strings.Join(filteredLines, "\n")
 
-	tmp := strings.Split(content, ";")
-	var sqls []string
-	for _, sql := range tmp {
-		sql = strings.TrimSpace(sql)
-		if sql == "" {
+	for i := 0; i < len(script); {
+		c := script[i]
+		rest := script[i:]
+
+		// DELIMITER command, which must be at the beginning of a line and out of statements
+		if atLineStart && strings.TrimSpace(cur.String()) == "" && len(rest) > 10 &&
+			strings.EqualFold(rest[:10], "delimiter ") {
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			}
+			if d := strings.TrimSpace(rest[10:end]); d != "" {
+				delimiter = d
+			}
+			i += end
 			continue
 		}
-		sqls = append(sqls, sql)
+
+		switch {
+		case strings.HasPrefix(rest, delimiter):
+			flush()
+			i += len(delimiter)
+			atLineStart = false
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(script); j++ {
+				if script[j] == '\\' && c != '`' {
+					j++
+				} else if script[j] == c {
+					if j+1 < len(script) && script[j+1] == c { // escaped by doubling
+						j++
+					} else {
+						break
+					}
+				}
+			}
+			end := Min(j+1, len(script))
+			write(script[i:end])
+			i = end
+			atLineStart = false
+			continue
+		case c == '#' || (strings.HasPrefix(rest, "--") && (len(rest) == 2 || rest[2] == ' ' || rest[2] == '\t' || rest[2] == '\n' || rest[2] == '\r')):
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			}
+			i += end // the newline is kept
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end == -1 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			if strings.HasPrefix(rest, "/*!") || strings.HasPrefix(rest, "/*T!") || strings.HasPrefix(rest, "/*+") { // executable comments and hints
+				write(rest[:end])
+			} else {
+				write(" ")
+				line += strings.Count(rest[:end], "\n")
+			}
+			i += end
+			atLineStart = false
+			continue
+		}
+
+		write(string(c))
+		i++
+		if c == '\n' {
+			atLineStart = true
+		} else if c != ' ' && c != '\t' && c != '\r' {
+			atLineStart = false
+		}
 	}
-	return sqls, nil
+	flush()
+	return stmts
 }
 
 func Min[T int | float64](xs ...T) T {
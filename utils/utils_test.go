@@ -1,8 +1,18 @@
 package utils
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/codec"
 )
 
 func TestCollectTableNames(t *testing.T) {
@@ -54,3 +64,329 @@ func TestPlanCost(t *testing.T) {
 		t.Error("plan cost error")
 	}
 }
+
+func TestParseCreateTableIndexes(t *testing.T) {
+	tbl, err := ParseCreateTableStmt("test", `create table t (
+		a int primary key,
+		b varchar(64) unique,
+		c varchar(64),
+		d int,
+		j json,
+		key (c(10), d),
+		key idx_d (d) invisible,
+		unique key uk_c (c, b),
+		key idx_j ((cast(json_unquote(json_extract(j, '$.name')) as char(64)))),
+		key idx_lower ((lower(c))),
+		foreign key (d) references t2(id))`)
+	must(err)
+	var defs []string
+	for _, idx := range tbl.Indexes {
+		defs = append(defs, idx.Definition())
+	}
+	expected := []string{
+		"PRIMARY KEY (a) CLUSTERED",
+		"UNIQUE KEY b (b)",
+		"KEY c (c(10), d)",
+		"KEY idx_d (d) INVISIBLE",
+		"UNIQUE KEY uk_c (c, b)",
+		"KEY idx_j ((cast(json_unquote(json_extract(`j`, '$.name')) as char(64))))",
+		"KEY idx_lower ((lower(`c`)))",
+	}
+	if strings.Join(defs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got %v, expected %v", defs, expected)
+	}
+	if handle := tbl.HandleColumns(); len(handle) != 1 || handle[0].ColumnName != "a" {
+		t.Errorf("unexpected handle columns %v", handle)
+	}
+
+	cases := []struct {
+		stmt      string
+		clustered bool
+	}{
+		{`create table t (a varchar(10) primary key)`, false},
+		{`create table t (a int, b int, primary key (a, b))`, false},
+		{`create table t (a int, b int, primary key (a, b) /*T![clustered_index] CLUSTERED */)`, true},
+		{`create table t (a bigint, primary key (a) /*T![clustered_index] NONCLUSTERED */)`, false},
+		{`create table t (a bigint, primary key (a))`, true},
+	}
+	for _, c := range cases {
+		tbl, err := ParseCreateTableStmt("test", c.stmt)
+		must(err)
+		if (tbl.HandleColumns() != nil) != c.clustered {
+			t.Errorf("%v: expected clustered %v", c.stmt, c.clustered)
+		}
+	}
+}
+
+func TestSplitSQLScript(t *testing.T) {
+	script := `-- comment; with a semicolon
+use test; # another comment;
+create table t (a int, b varchar(10) default ';', primary key (a) /*T![clustered_index] CLUSTERED */);
+/* block
+   comment; */
+select * from t where b = 'it''s;' and a = 1; -- trailing comment;
+select "a\";b" from t
+where a = 2;
+DELIMITER //
+create procedure p() begin select 1; select 2; end//
+DELIMITER ;
+select /*+ use_index(t, idx_a) */ * from t /* comment */ where a = 1;
+select 3`
+	expected := []ScriptStmt{
+		{"use test", 2},
+		{"create table t (a int, b varchar(10) default ';', primary key (a) /*T![clustered_index] CLUSTERED */)", 3},
+		{"select * from t where b = 'it''s;' and a = 1", 6},
+		{"select \"a\\\";b\" from t\nwhere a = 2", 7},
+		{"create procedure p() begin select 1; select 2; end", 10},
+		{"select /*+ use_index(t, idx_a) */ * from t   where a = 1", 12},
+		{"select 3", 13},
+	}
+	stmts := SplitSQLScript(script)
+	if len(stmts) != len(expected) {
+		t.Fatalf("expect %v statements, got %v: %v", len(expected), len(stmts), stmts)
+	}
+	for i := range stmts {
+		if stmts[i] != expected[i] {
+			t.Errorf("expect %v, got %v", expected[i], stmts[i])
+		}
+	}
+}
+
+func TestGetStmtType(t *testing.T) {
+	cases := []struct {
+		stmt     string
+		stmtType StmtType
+	}{
+		{"use test", StmtUseDB},
+		{"create database `use`", StmtCreateDB},
+		{"create table users (a int)", StmtCreateTable},
+		{"create index idx on t(a)", StmtCreateIndex},
+		{"select * from users", StmtSelect},
+		{"select 1 union select 2", StmtSelect},
+		{"set @@tidb_cost_model_version = 2", StmtUnknown},
+	}
+	for _, c := range cases {
+		stmtType, err := GetStmtType(c.stmt)
+		must(err)
+		if stmtType != c.stmtType {
+			t.Errorf("GetStmtType(%s) = %v, expected %v", c.stmt, stmtType, c.stmtType)
+		}
+	}
+	if GetDBNameFromUseDBStmt("use `my db`") != "my db" || GetDBNameFromCreateDBStmt("create database if not exists db1") != "db1" {
+		t.Errorf("unexpected database names")
+	}
+}
+
+func TestWorkloadFileRoundTrip(t *testing.T) {
+	queries := ListToSet(
+		Query{Alias: "digest1", SchemaName: "db1", Text: "select * from t where a='x,\"y\"'", Frequency: 20, AvgLatency: 1.5},
+		Query{Alias: "digest2", SchemaName: "db2", Text: "select *\nfrom t where b=1", Frequency: 3, Weight: 2},
+		Query{Alias: "digest3", SchemaName: "db2", Text: "select * from t where a='x,\"y\"'", Frequency: 5}) // the same text in another schema
+	for _, ext := range []string{"json", "yaml", "csv"} {
+		fpath := path.Join(t.TempDir(), "queries."+ext)
+		must(SaveWorkloadFile(fpath, queries))
+		loaded, err := LoadQueries("test", fpath)
+		must(err)
+		if loaded.Size() != queries.Size() {
+			t.Fatalf("%v: expect %v queries, got %v", ext, queries.Size(), loaded.Size())
+		}
+		for _, q := range queries.ToList() {
+			lq, ok := loaded.Find(q)
+			if !ok || lq.Alias != q.Alias || lq.SchemaName != q.SchemaName || lq.Frequency != q.Frequency ||
+				lq.Weight != q.Weight || lq.AvgLatency != q.AvgLatency {
+				t.Errorf("%v: expect %v, got %v", ext, q, lq)
+			}
+		}
+	}
+
+	fpath := path.Join(t.TempDir(), "queries.csv")
+	must(SaveContentTo(fpath, "text,frequency\nselect * from t,\n"))
+	loaded, err := LoadQueries("test", fpath)
+	must(err)
+	if q := loaded.ToList()[0]; q.Alias != "q1" || q.SchemaName != "test" || q.Frequency != 1 {
+		t.Errorf("unexpected query %v", q)
+	}
+
+	fpath = path.Join(t.TempDir(), "queries.yml")
+	must(SaveContentTo(fpath, "queries:\n  - text: |\n      select *\n      from t;\n    frequency: 3\n"))
+	loaded, err = LoadQueries("test", fpath)
+	must(err)
+	if q := loaded.ToList()[0]; q.Alias != "q1" || q.Text != "select *\nfrom t" || q.Frequency != 3 {
+		t.Errorf("unexpected query %v", q)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	a, err := NewAnonymizer(true)
+	must(err)
+	tbl, err := ParseCreateTableStmt("shop", "create table users (id int primary key, email varchar(64) comment 'user email', "+
+		"status enum('active', 'banned') default 'active', key idx_email (email)) comment 'all users'")
+	must(err)
+	encode := func(values ...any) string {
+		key, err := codec.EncodeKey(nil, nil, types.MakeDatums(values...)...)
+		must(err)
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	raw := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	rawStats := []byte(`{"database_name": "shop", "table_name": "users", "count": 1000000, "columns": {` +
+		`"id": {"histogram": {"ndv": 3, "buckets": [{"count": 10, "lower_bound": "` + raw("100") + `", "upper_bound": "` + raw("20000") + `"}]}},` +
+		`"email": {"histogram": {"ndv": 3, "buckets": [{"lower_bound": "` + raw("alice@gmail.com") + `", "upper_bound": "` + raw("bob@gmail.com") + `"}]}, ` +
+		`"cm_sketch": {"rows": [{"counters": [1, 2]}], "top_n": [{"data": "` + encode("alice@gmail.com") + `", "count": 5}]}}}, ` +
+		`"indices": {"idx_email": {"histogram": {"buckets": [{"lower_bound": "` + encode("alice@gmail.com") + `", "upper_bound": "` + encode("bob@gmail.com") + `"}]}}}}`)
+	query1 := Query{SchemaName: "shop", Text: "select u.id from users u where u.email = 'alice@gmail.com' " +
+		"and status = 'active' and id > 12345 and created_at > '2023-08-01' and other = 1", Frequency: 3}
+	query2 := Query{SchemaName: "shop", Text: "select * from shop.users where email = 'alice@gmail.com' or email like 'bo%'"}
+	must(a.CollectTableSchema(tbl))
+	must(a.CollectQuery(query1))
+	must(a.CollectQuery(query2))
+	must(a.CollectStats(rawStats))
+
+	at, err := a.AnonymizeTableSchema(tbl)
+	must(err)
+	if at.SchemaName != "db1" || at.TableName != "t1" || len(at.Columns) != 3 || at.Columns[1].ColumnName != "c2" ||
+		len(at.Indexes) != 2 || at.Indexes[1].IndexName != "idx1" {
+		t.Errorf("unexpected anonymized table %v", at.CreateStmtText)
+	}
+	for _, word := range []string{"users", "email", "active", "banned", "shop"} {
+		if strings.Contains(at.CreateStmtText, word) {
+			t.Errorf("%v is not anonymized in %v", word, at.CreateStmtText)
+		}
+	}
+
+	q1, err := a.AnonymizeQuery(query1)
+	must(err)
+	q2, err := a.AnonymizeQuery(query2)
+	must(err)
+	for _, word := range []string{"users", "email", "alice", "gmail", "active", "12345", "shop"} {
+		if strings.Contains(q1.Text, word) || strings.Contains(q2.Text, word) {
+			t.Errorf("%v is not anonymized in %v or %v", word, q1.Text, q2.Text)
+		}
+	}
+	for _, kept := range []string{"`u`.`c1`", "`c3`", "'2023-08-01'", "`other`", "@", "`db1`.`t1`"} {
+		if !strings.Contains(q1.Text+q2.Text, kept) {
+			t.Errorf("%v is expected in %v or %v", kept, q1.Text, q2.Text)
+		}
+	}
+	mapString := func(column, s string) string { return a.stringText(a.domain(column), s, false, false) }
+	email := mapString("email", "alice@gmail.com")
+	if !strings.Contains(q1.Text, email) || !strings.Contains(q2.Text, email) || len(email) != len("alice@gmail.com") {
+		t.Errorf("literals are not anonymized consistently: %v, %v", q1.Text, q2.Text)
+	}
+	if bob := mapString("email", "bob@gmail.com"); bob <= email || !strings.Contains(q2.Text, "'"+bob[:2]+"%'") {
+		t.Errorf("the order or the prefix of literals is not kept: %v, %v, %v", email, bob, q2.Text)
+	}
+	if !strings.Contains(at.CreateStmtText, "default '"+mapString("status", "active")+"'") {
+		t.Errorf("ENUM values are not anonymized consistently: %v", at.CreateStmtText)
+	}
+	if q1.SchemaName != "db1" || q1.Frequency != 3 {
+		t.Errorf("unexpected query %v", q1)
+	}
+
+	stats, err := a.AnonymizeStats(rawStats)
+	must(err)
+	var anonymized struct {
+		Count   int64                     `json:"count"`
+		Columns map[string]map[string]any `json:"columns"`
+		Indices map[string]struct {
+			Histogram struct {
+				Buckets []struct {
+					LowerBound []byte `json:"lower_bound"`
+				} `json:"buckets"`
+			} `json:"histogram"`
+		} `json:"indices"`
+	}
+	must(json.Unmarshal(stats, &anonymized))
+	if anonymized.Count != 1000000 || anonymized.Columns["c2"]["fm_sketch"] != nil ||
+		!strings.Contains(string(stats), `"cm_sketch":{"top_n":[{"count":5,"data":"`+encode(email)+`"}]}`) ||
+		!strings.Contains(string(stats), raw(email)) {
+		t.Errorf("unexpected anonymized stats %v", string(stats))
+	}
+	if _, d, err := codec.DecodeOne(anonymized.Indices["idx1"].Histogram.Buckets[0].LowerBound); err != nil || string(d.GetBytes()) != email {
+		t.Errorf("unexpected index bound %v, %v in %v", d, err, string(stats))
+	}
+	lower, _ := a.numberText(a.domain("id"), "100", false)
+	upper, _ := a.numberText(a.domain("id"), "20000", false)
+	id, _ := a.numberText(a.domain("id"), "12345", false)
+	if !strings.Contains(string(stats), raw(lower)) || !strings.Contains(q1.Text, "`c1` > "+id) ||
+		!(atoi(lower) < atoi(id) && atoi(id) < atoi(upper)) {
+		t.Errorf("the order of numbers is not kept: %v, %v, %v, %v", lower, id, upper, q1.Text)
+	}
+}
+
+func atoi(s string) int {
+	i, err := strconv.Atoi(s)
+	must(err)
+	return i
+}
+
+func TestWorkloadBundle(t *testing.T) {
+	dir := t.TempDir()
+	must(SaveContentTo(path.Join(dir, "schema.sql"), "create database if not exists shop;\nuse shop;\n"+
+		"create table users (id int, name varchar(32));\ncreate table orders (id int, user_id int);\n"))
+	must(SaveWorkloadFile(path.Join(dir, "queries.json"), ListToSet(
+		Query{Alias: "q1", SchemaName: "shop", Text: "select * from users where id=1", Frequency: 1},
+		Query{Alias: "q2", SchemaName: "shop", Text: "select * from users u, orders o where u.id=o.user_id", Frequency: 2})))
+	must(os.MkdirAll(path.Join(dir, "stats"), 0755))
+	must(SaveContentTo(path.Join(dir, "stats", "shop_users.json"), `{"database_name":"shop","table_name":"users"}`))
+
+	m, err := BuildWorkloadManifest(dir, "v7.3.0")
+	must(err)
+	must(SaveWorkloadManifest(dir, m))
+	if m.QueryFile != "queries.json" || m.QueryCount != 2 || len(m.Tables) != 2 || len(m.Checksums) != 3 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	bundle := path.Join(t.TempDir(), "workload.tar.gz")
+	must(PackWorkloadBundle(dir, bundle))
+	unpacked := t.TempDir()
+	must(UnpackWorkloadBundle(bundle, unpacked))
+	loaded, err := LoadWorkloadManifest(unpacked)
+	must(err)
+	if loaded.SourceVersion != "v7.3.0" || !loaded.ExportTime.Equal(m.ExportTime) {
+		t.Errorf("unexpected manifest %+v", loaded)
+	}
+	problems, err := ValidateWorkloadDir(unpacked)
+	must(err)
+	if len(problems) != 1 || problems[0] != "table shop.orders has no stats" {
+		t.Errorf("unexpected problems %v", problems)
+	}
+
+	must(SaveContentTo(path.Join(unpacked, "schema.sql"), "use shop;\ncreate table users (id int, name varchar(32));\n"))
+	problems, err = ValidateWorkloadDir(unpacked)
+	must(err)
+	if len(problems) != 2 || problems[0] != "the checksum of file schema.sql mismatches" {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
+
+func TestLoadQueriesMultiSchema(t *testing.T) {
+	dir := t.TempDir()
+	must(SaveContentTo(path.Join(dir, "q1.sql"), "select * from t1 where a=1;"))
+	must(SaveContentTo(path.Join(dir, "q2.sql"), "-- schema: shop\nselect * from users where id=1;"))
+	must(SaveContentTo(path.Join(dir, "q3.sql"), "use `crm`;\nselect * from customers where id=1;"))
+	queries, err := LoadQueries("test", dir)
+	must(err)
+	expected := map[string]string{
+		"q1": "test|select * from t1 where a=1;",
+		"q2": "shop|-- schema: shop\nselect * from users where id=1;",
+		"q3": "crm|select * from customers where id=1",
+	}
+	for _, q := range queries.ToList() {
+		if got := q.SchemaName + "|" + q.Text; got != expected[q.Alias] {
+			t.Errorf("%v: expect %q, got %q", q.Alias, expected[q.Alias], got)
+		}
+	}
+
+	fpath := path.Join(t.TempDir(), "queries.sql")
+	must(SaveContentTo(fpath, "select * from t1;\nuse shop;\nselect * from users;\nuse crm;\nselect * from customers;\n"))
+	queries, err = LoadQueries("test", fpath)
+	must(err)
+	var schemas []string
+	for _, q := range queries.ToList() {
+		schemas = append(schemas, q.Alias+":"+q.SchemaName)
+	}
+	sort.Strings(schemas)
+	if strings.Join(schemas, ",") != "q1:test,q3:shop,q5:crm" {
+		t.Errorf("unexpected schemas %v", schemas)
+	}
+}
@@ -18,11 +18,21 @@ type Query struct { // DQL or DML
 	Text             string
 	Frequency        int
 	IndexableColumns Set[Column] // Indexable columns related to this Query
+	Weight           float64     // the weight of this Query in the workload cost, 0 is regarded as 1
+	AvgLatency       float64     // the average latency in milliseconds, 0 if unknown
 }
 
-// Key returns the key of the Query.
+// Key returns the key of the Query, the same text in different schemas are different queries.
 func (q Query) Key() string {
-	return q.Text
+	return strings.ToLower(q.SchemaName) + "|" + q.Text
+}
+
+// WeightedFrequency returns Frequency*Weight, which is used to calculate the workload cost.
+func (q Query) WeightedFrequency() float64 {
+	if q.Weight <= 0 {
+		return float64(q.Frequency)
+	}
+	return float64(q.Frequency) * q.Weight
 }
 
 // TableName returns a table name.
@@ -50,6 +60,17 @@ func (t TableSchema) Key() string {
 	return fmt.Sprintf("%v.%v", t.SchemaName, t.TableName)
 }
 
+// HandleColumns returns the columns of the clustered primary key, which are implicitly contained by all secondary indexes.
+// It returns nil if the table has no clustered primary key.
+func (t TableSchema) HandleColumns() []Column {
+	for _, idx := range t.Indexes {
+		if idx.Primary && idx.Clustered {
+			return idx.Columns
+		}
+	}
+	return nil
+}
+
 // TableStats represents the statistics of a table.
 type TableStats struct {
 	SchemaName    string
@@ -68,6 +89,16 @@ type Column struct {
 	TableName  string
 	ColumnName string
 	ColumnType *types.FieldType
+
+	// JSONPath is the path of a JSON array inside a JSON column, e.g. `$.tags`, it's empty for normal columns.
+	// A column with a JSON path is indexed as a multi-valued index part. Scalar JSON values are indexed by expressions
+	// in queries like `cast(j->>'$.name' as char(64))`, see Expr.
+	JSONPath    string
+	MultiValued bool   // whether this part is indexed as a multi-valued index part
+	ArrayType   string // the element type of a multi-valued index part, e.g. `char(64)`, `signed`, `double`
+
+	Length int    // the prefix length of an index part, e.g. 10 for `name(10)`, 0 means the whole column
+	Expr   string // the expression of an expression index part other than JSON paths, e.g. `lower(name)`
 }
 
 // NewColumn creates a new column.
@@ -86,12 +117,58 @@ func NewColumns(schemaName, tableName string, columnNames ...string) []Column {
 
 // Key returns the key of the column.
 func (c Column) Key() string {
-	return fmt.Sprintf("%v.%v.%v", c.SchemaName, c.TableName, c.ColumnName)
+	return fmt.Sprintf("%v.%v.%v", c.SchemaName, c.TableName, c.partName())
 }
 
 // String returns the string representation of the column.
 func (c Column) String() string {
-	return fmt.Sprintf("%v.%v.%v", c.SchemaName, c.TableName, c.ColumnName)
+	return fmt.Sprintf("%v.%v.%v", c.SchemaName, c.TableName, c.partName())
+}
+
+// partName returns the short name of this index part, e.g. `a`, `(lower(c))` or `j->'$.tags'[*] as signed`.
+func (c Column) partName() string {
+	if c.Expr != "" {
+		return fmt.Sprintf("(%v)", c.Expr)
+	}
+	if c.Length > 0 {
+		return fmt.Sprintf("%v(%v)", c.ColumnName, c.Length)
+	}
+	if c.JSONPath == "" {
+		return c.ColumnName
+	}
+	return fmt.Sprintf("%v->'%v'[*] as %v", c.ColumnName, c.JSONPath, c.arrayType())
+}
+
+// arrayType returns the element type of a multi-valued index part, `char(64)` by default.
+func (c Column) arrayType() string {
+	if c.ArrayType == "" {
+		return "char(64)"
+	}
+	return c.ArrayType
+}
+
+// IsExpression returns whether this column is indexed as an expression instead of a plain column.
+func (c Column) IsExpression() bool {
+	return c.JSONPath != "" || c.Expr != ""
+}
+
+// Expression returns the index expression of this column, e.g. `cast(json_extract(j, '$.tags') as char(64) array)`.
+func (c Column) Expression() string {
+	if c.Expr != "" {
+		return c.Expr
+	}
+	return fmt.Sprintf("cast(json_extract(%v, '%v') as %v array)", c.ColumnName, c.JSONPath, c.arrayType())
+}
+
+// IndexPart returns the index part definition of this column used in DDL, e.g. `a` or `(cast(... as char(64)))`.
+func (c Column) IndexPart() string {
+	if !c.IsExpression() {
+		if c.Length > 0 {
+			return fmt.Sprintf("%v(%v)", c.ColumnName, c.Length)
+		}
+		return c.ColumnName
+	}
+	return fmt.Sprintf("(%v)", c.Expression())
 }
 
 // Index represents an index.
@@ -100,6 +177,12 @@ type Index struct {
 	TableName  string
 	IndexName  string
 	Columns    []Column
+
+	// Flags below are only used by existing indexes parsed from table definitions.
+	Primary   bool // whether it's the primary key
+	Unique    bool // whether it's a unique index, the primary key is always unique
+	Clustered bool // whether it's a clustered primary key, whose columns are the handle of the table
+	Invisible bool // whether it's invisible to the optimizer
 }
 
 // NewIndex creates a new index.
@@ -107,12 +190,20 @@ func NewIndex(schemaName, tableName, indexName string, columns ...string) Index
 	return Index{SchemaName: strings.ToLower(schemaName), TableName: strings.ToLower(tableName), IndexName: strings.ToLower(indexName), Columns: NewColumns(schemaName, tableName, columns...)}
 }
 
+// NewIndexWithColumns creates a new index with the given columns, JSON paths and expressions of these columns are kept.
 func NewIndexWithColumns(indexName string, columns ...Column) Index {
 	names := make([]string, len(columns))
 	for i, col := range columns {
 		names[i] = col.ColumnName
 	}
-	return NewIndex(columns[0].SchemaName, columns[0].TableName, indexName, names...)
+	idx := NewIndex(columns[0].SchemaName, columns[0].TableName, indexName, names...)
+	for i, col := range columns {
+		idx.Columns[i].JSONPath = col.JSONPath
+		idx.Columns[i].MultiValued = col.MultiValued
+		idx.Columns[i].ArrayType = col.ArrayType
+		idx.Columns[i].Expr = col.Expr
+	}
+	return idx
 }
 
 // ColumnNames returns the column names of the index.
@@ -124,14 +215,59 @@ func (i Index) ColumnNames() []string {
 	return names
 }
 
+// IndexParts returns the index part definitions of the index, see Column.IndexPart.
+func (i Index) IndexParts() []string {
+	var parts []string
+	for _, col := range i.Columns {
+		parts = append(parts, col.IndexPart())
+	}
+	return parts
+}
+
 // DDL returns the DDL of the index.
 func (i Index) DDL() string {
-	return fmt.Sprintf("CREATE INDEX %v ON %v.%v (%v)", i.IndexName, i.SchemaName, i.TableName, strings.Join(i.ColumnNames(), ", "))
+	return fmt.Sprintf("CREATE INDEX %v ON %v.%v (%v)", i.IndexName, i.SchemaName, i.TableName, strings.Join(i.IndexParts(), ", "))
+}
+
+// Definition returns the definition of the index in a table definition, e.g. `PRIMARY KEY (a) CLUSTERED` or `UNIQUE KEY uk (b)`.
+func (i Index) Definition() string {
+	var def string
+	switch {
+	case i.Primary:
+		def = fmt.Sprintf("PRIMARY KEY (%v)", strings.Join(i.IndexParts(), ", "))
+		if i.Clustered {
+			def += " CLUSTERED"
+		} else {
+			def += " NONCLUSTERED"
+		}
+	case i.Unique:
+		def = fmt.Sprintf("UNIQUE KEY %v (%v)", i.IndexName, strings.Join(i.IndexParts(), ", "))
+	default:
+		def = fmt.Sprintf("KEY %v (%v)", i.IndexName, strings.Join(i.IndexParts(), ", "))
+	}
+	if i.Invisible {
+		def += " INVISIBLE"
+	}
+	return def
 }
 
 // Key returns the key of the index.
 func (i Index) Key() string {
-	return fmt.Sprintf("%v.%v(%v)", i.SchemaName, i.TableName, strings.Join(i.ColumnNames(), ","))
+	var names []string
+	for _, col := range i.Columns {
+		names = append(names, col.partName())
+	}
+	return fmt.Sprintf("%v.%v(%v)", i.SchemaName, i.TableName, strings.Join(names, ","))
+}
+
+// IsMultiValued returns whether this index is a multi-valued index, which contains a multi-valued index part.
+func (i Index) IsMultiValued() bool {
+	for _, col := range i.Columns {
+		if col.MultiValued {
+			return true
+		}
+	}
+	return false
 }
 
 // PrefixContain returns whether j is a prefix of i.
@@ -140,7 +276,7 @@ func (i Index) PrefixContain(j Index) bool {
 		return false
 	}
 	for k := range j.Columns {
-		if i.Columns[k].ColumnName != j.Columns[k].ColumnName {
+		if i.Columns[k].partName() != j.Columns[k].partName() {
 			return false
 		}
 	}
@@ -0,0 +1,391 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// WorkloadManifestFile is the name of the manifest file in workload bundles.
+	WorkloadManifestFile = "manifest.json"
+
+	workloadManifestVersion = 1
+)
+
+// WorkloadManifest describes the content of a workload bundle.
+type WorkloadManifest struct {
+	FormatVersion int                     `json:"format_version"`
+	SourceVersion string                  `json:"source_version"` // the version of the cluster the workload is exported from
+	ExportTime    time.Time               `json:"export_time"`
+	SchemaFile    string                  `json:"schema_file"`
+	QueryFile     string                  `json:"query_file"`
+	QueryCount    int                     `json:"query_count"`
+	Tables        []WorkloadManifestTable `json:"tables"`
+	Checksums     map[string]string       `json:"checksums"` // sha256 of all files, keyed by their paths relative to the bundle root
+}
+
+// WorkloadManifestTable is a table in the workload bundle.
+type WorkloadManifestTable struct {
+	SchemaName string `json:"schema"`
+	TableName  string `json:"table"`
+	StatsFile  string `json:"stats_file,omitempty"` // empty if the table has no statistics
+}
+
+// IsWorkloadBundle returns whether the file is a workload bundle (.tar.gz or .tgz).
+func IsWorkloadBundle(fpath string) bool {
+	fpath = strings.ToLower(fpath)
+	return strings.HasSuffix(fpath, ".tar.gz") || strings.HasSuffix(fpath, ".tgz")
+}
+
+// BuildWorkloadManifest builds the manifest for the workload directory exported by `workload-export`.
+func BuildWorkloadManifest(dir, sourceVersion string) (*WorkloadManifest, error) {
+	m := &WorkloadManifest{
+		FormatVersion: workloadManifestVersion,
+		SourceVersion: sourceVersion,
+		ExportTime:    time.Now().UTC().Truncate(time.Second),
+		SchemaFile:    "schema.sql",
+		QueryFile:     workloadQueryFile(dir),
+		Checksums:     make(map[string]string),
+	}
+
+	queries, err := LoadQueries("test", filepath.Join(dir, m.QueryFile))
+	if err != nil {
+		return nil, err
+	}
+	m.QueryCount = queries.Size()
+
+	tables, err := LoadTableSchemasFromFile(filepath.Join(dir, m.SchemaFile))
+	if err != nil {
+		return nil, err
+	}
+	statsFiles, err := workloadStatsFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tables.ToList() {
+		name := TableName{SchemaName: t.SchemaName, TableName: t.TableName}
+		m.Tables = append(m.Tables, WorkloadManifestTable{
+			SchemaName: t.SchemaName,
+			TableName:  t.TableName,
+			StatsFile:  statsFiles[name.Key()],
+		})
+	}
+
+	err = filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == WorkloadManifestFile {
+			return nil
+		}
+		m.Checksums[rel], err = fileChecksum(fpath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// workloadQueryFile returns the query file in the workload directory, 'queries.json' is preferred.
+func workloadQueryFile(dir string) string {
+	for _, f := range []string{"queries.json", "queries"} {
+		if exist, _ := FileExists(filepath.Join(dir, f)); exist {
+			return f
+		}
+	}
+	return "queries.sql"
+}
+
+// workloadStatsFiles returns all stats files in the workload directory keyed by their table names.
+func workloadStatsFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	if exist, isDir := FileExists(filepath.Join(dir, "stats")); !exist || !isDir {
+		return files, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "stats"))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "stats", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var stats struct {
+			DatabaseName string `json:"database_name"`
+			TableName    string `json:"table_name"`
+		}
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return nil, fmt.Errorf("invalid stats file %v: %v", e.Name(), err)
+		}
+		name := TableName{SchemaName: stats.DatabaseName, TableName: stats.TableName}
+		files[name.Key()] = "stats/" + e.Name()
+	}
+	return files, nil
+}
+
+func fileChecksum(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SaveWorkloadManifest saves the manifest into the workload directory.
+func SaveWorkloadManifest(dir string, m *WorkloadManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return SaveContentTo(filepath.Join(dir, WorkloadManifestFile), string(data))
+}
+
+// LoadWorkloadManifest loads the manifest from the workload directory, it returns nil if there is no manifest.
+func LoadWorkloadManifest(dir string) (*WorkloadManifest, error) {
+	fpath := filepath.Join(dir, WorkloadManifestFile)
+	if exist, _ := FileExists(fpath); !exist {
+		return nil, nil
+	}
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	m := new(WorkloadManifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %v: %v", fpath, err)
+	}
+	if m.FormatVersion > workloadManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %v, please upgrade the index advisor", m.FormatVersion)
+	}
+	return m, nil
+}
+
+// PackWorkloadBundle packs all files in the workload directory into a .tar.gz bundle.
+func PackWorkloadBundle(dir, bundlePath string) error {
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	var files []string
+	err = filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		files = append(files, fpath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files) // to make the bundle stable
+	for _, fpath := range files {
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	Infof("pack %d files from %v into the workload bundle %v", len(files), dir, bundlePath)
+	return nil
+}
+
+// UnpackWorkloadBundle unpacks the .tar.gz bundle into the directory.
+func UnpackWorkloadBundle(bundlePath, dir string) error {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("invalid workload bundle %v: %v", bundlePath, err)
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid workload bundle %v: %v", bundlePath, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid workload bundle %v: illegal file path %v", bundlePath, hdr.Name)
+		}
+		fpath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(fpath)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateWorkloadDir checks whether the workload directory is complete and returns all problems found:
+// files should match the checksums in the manifest, and every table referenced by queries should have schema and stats.
+// Directories without manifests are checked as if their manifests were just built.
+func ValidateWorkloadDir(dir string) ([]string, error) {
+	m, err := LoadWorkloadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	if m == nil {
+		problems = append(problems, fmt.Sprintf("no %v found", WorkloadManifestFile))
+		if m, err = BuildWorkloadManifest(dir, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	for f := range m.Checksums {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(f))
+		if exist, _ := FileExists(fpath); !exist {
+			problems = append(problems, fmt.Sprintf("file %v is missing", f))
+			continue
+		}
+		sum, err := fileChecksum(fpath)
+		if err != nil {
+			return nil, err
+		}
+		if sum != m.Checksums[f] {
+			problems = append(problems, fmt.Sprintf("the checksum of file %v mismatches", f))
+		}
+	}
+
+	queries, err := LoadQueries("test", filepath.Join(dir, m.QueryFile))
+	if err != nil {
+		return nil, err
+	}
+	if queries.Size() != m.QueryCount {
+		problems = append(problems, fmt.Sprintf("%v queries are expected but %v are found", m.QueryCount, queries.Size()))
+	}
+
+	tables := NewSet[TableName]()
+	for _, q := range queries.ToList() {
+		names, err := CollectTableNamesFromSQL(q.SchemaName, q.Text)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("query %v can't be parsed: %v", q.Alias, err))
+			continue
+		}
+		tables.AddSet(names)
+	}
+	manifestTables := make(map[string]WorkloadManifestTable)
+	for _, t := range m.Tables {
+		manifestTables[TableName{SchemaName: t.SchemaName, TableName: t.TableName}.Key()] = t
+	}
+	for _, t := range tables.ToList() {
+		if IsTiDBSystemTableName(t) {
+			continue
+		}
+		mt, ok := manifestTables[t.Key()]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("table %v has no schema", t.Key()))
+			continue
+		}
+		if mt.StatsFile == "" {
+			problems = append(problems, fmt.Sprintf("table %v has no stats", t.Key()))
+		} else if exist, _ := FileExists(filepath.Join(dir, filepath.FromSlash(mt.StatsFile))); !exist {
+			problems = append(problems, fmt.Sprintf("the stats file %v of table %v is missing", mt.StatsFile, t.Key()))
+		}
+	}
+	return problems, nil
+}
+
+// LoadTableSchemasFromFile parses all tables created in the schema file.
+func LoadTableSchemasFromFile(schemaFilePath string) (Set[TableSchema], error) {
+	tables := NewSet[TableSchema]()
+	if exist, _ := FileExists(schemaFilePath); !exist {
+		return tables, nil
+	}
+	stmts, err := ParseScriptFromFile(schemaFilePath)
+	if err != nil {
+		return nil, err
+	}
+	currentDB := "test" // the default DB `test`
+	for _, stmt := range stmts {
+		stmtType, err := GetStmtType(stmt.Text)
+		if err != nil {
+			Warningf("skip the statement at %v:%v: %v", schemaFilePath, stmt.Line, err)
+			continue
+		}
+		switch stmtType {
+		case StmtUseDB:
+			currentDB = GetDBNameFromUseDBStmt(stmt.Text)
+		case StmtCreateTable:
+			t, err := ParseCreateTableStmt(currentDB, stmt.Text)
+			if err != nil {
+				return nil, fmt.Errorf("%v:%v: %v", schemaFilePath, stmt.Line, err)
+			}
+			tables.Add(t)
+		}
+	}
+	return tables, nil
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WorkloadFileQuery is a query in structured workload files.
+type WorkloadFileQuery struct {
+	Alias      string  `json:"alias" yaml:"alias"`
+	SchemaName string  `json:"schema" yaml:"schema"`
+	Text       string  `json:"text" yaml:"text"`
+	Frequency  int     `json:"frequency" yaml:"frequency"`
+	Weight     float64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+	AvgLatency float64 `json:"avg_latency_ms,omitempty" yaml:"avg_latency_ms,omitempty"`
+}
+
+// WorkloadFile is the content of JSON and YAML workload files.
+type WorkloadFile struct {
+	Queries []WorkloadFileQuery `json:"queries" yaml:"queries"`
+}
+
+// workloadCSVHeader is the header of CSV workload files.
+var workloadCSVHeader = []string{"alias", "schema", "text", "frequency", "weight", "avg_latency_ms"}
+
+// IsWorkloadFile returns whether the file is a structured workload file (.json, .yaml, .yml or .csv).
+func IsWorkloadFile(fpath string) bool {
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".json", ".yaml", ".yml", ".csv":
+		return true
+	}
+	return false
+}
+
+// LoadWorkloadFile loads queries from the structured workload file, the format is determined by the file extension.
+// defaultSchemaName is used for queries without schema names.
+func LoadWorkloadFile(defaultSchemaName, fpath string) (Set[Query], error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var fileQueries []WorkloadFileQuery
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".json":
+		var w WorkloadFile
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("invalid workload file %v: %v", fpath, err)
+		}
+		fileQueries = w.Queries
+	case ".yaml", ".yml":
+		var w WorkloadFile
+		if err := yaml.UnmarshalStrict(data, &w); err != nil {
+			return nil, fmt.Errorf("invalid workload file %v: %v", fpath, err)
+		}
+		fileQueries = w.Queries
+	case ".csv":
+		if fileQueries, err = parseWorkloadCSV(data); err != nil {
+			return nil, fmt.Errorf("invalid workload file %v: %v", fpath, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported workload file %v, only .json, .yaml, .yml and .csv are supported", fpath)
+	}
+
+	queries := NewSet[Query]()
+	for i, fq := range fileQueries {
+		q := Query{
+			Alias:      fq.Alias,
+			SchemaName: fq.SchemaName,
+			Text:       strings.TrimSuffix(strings.TrimSpace(fq.Text), ";"),
+			Frequency:  fq.Frequency,
+			Weight:     fq.Weight,
+			AvgLatency: fq.AvgLatency,
+		}
+		if q.Text == "" {
+			return nil, fmt.Errorf("invalid workload file %v: the text of query %v is empty", fpath, i+1)
+		}
+		if q.Alias == "" {
+			q.Alias = fmt.Sprintf("q%v", i+1)
+		}
+		if q.SchemaName == "" {
+			q.SchemaName = defaultSchemaName
+		}
+		if q.Frequency <= 0 {
+			q.Frequency = 1
+		}
+		if existing, ok := queries.Find(q); ok {
+			q.Frequency += existing.Frequency
+		}
+		queries.Add(q)
+	}
+	Infof("load %d queries from %s", queries.Size(), fpath)
+	return queries, nil
+}
+
+func parseWorkloadCSV(data []byte) ([]WorkloadFileQuery, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	fieldIdx := make(map[string]int)
+	for i, field := range records[0] {
+		fieldIdx[strings.ToLower(strings.TrimSpace(field))] = i
+	}
+	if _, ok := fieldIdx["text"]; !ok {
+		return nil, fmt.Errorf("the header should contain 'text'")
+	}
+	get := func(record []string, field string) string {
+		if i, ok := fieldIdx[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var queries []WorkloadFileQuery
+	for i, record := range records[1:] {
+		fq := WorkloadFileQuery{
+			Alias:      get(record, "alias"),
+			SchemaName: get(record, "schema"),
+			Text:       get(record, "text"),
+		}
+		if v := get(record, "frequency"); v != "" {
+			if fq.Frequency, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("line %v: invalid frequency %v", i+2, v)
+			}
+		}
+		if v := get(record, "weight"); v != "" {
+			if fq.Weight, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("line %v: invalid weight %v", i+2, v)
+			}
+		}
+		if v := get(record, "avg_latency_ms"); v != "" {
+			if fq.AvgLatency, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("line %v: invalid latency %v", i+2, v)
+			}
+		}
+		queries = append(queries, fq)
+	}
+	return queries, nil
+}
+
+// SaveWorkloadFile saves queries into the structured workload file, the format is determined by the file extension.
+func SaveWorkloadFile(fpath string, queries Set[Query]) error {
+	var fileQueries []WorkloadFileQuery
+	for _, q := range queries.ToList() {
+		fileQueries = append(fileQueries, WorkloadFileQuery{
+			Alias:      q.Alias,
+			SchemaName: q.SchemaName,
+			Text:       q.Text,
+			Frequency:  q.Frequency,
+			Weight:     q.Weight,
+			AvgLatency: q.AvgLatency,
+		})
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(WorkloadFile{Queries: fileQueries}); err != nil {
+			return err
+		}
+	case ".yaml", ".yml":
+		data, err := yaml.Marshal(WorkloadFile{Queries: fileQueries})
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	case ".csv":
+		w := csv.NewWriter(&buf)
+		records := [][]string{workloadCSVHeader}
+		for _, fq := range fileQueries {
+			records = append(records, []string{fq.Alias, fq.SchemaName, fq.Text, strconv.Itoa(fq.Frequency),
+				strconv.FormatFloat(fq.Weight, 'f', -1, 64), strconv.FormatFloat(fq.AvgLatency, 'f', -1, 64)})
+		}
+		if err := w.WriteAll(records); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported workload file %v, only .json, .yaml, .yml and .csv are supported", fpath)
+	}
+	return SaveContentTo(fpath, buf.String())
+}
@@ -2,8 +2,13 @@ package utils
 
 import (
 	"fmt"
-	"github.com/pingcap/parser/ast"
+	"regexp"
 	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 )
 
 // FilterQueries filters Queries by their alias.
@@ -56,32 +61,40 @@ func CreateWorkloadFromRawStmt(schemaName string, createTableStmts, rawSQLs []st
 	}, nil
 }
 
-// LoadQueries loads queries from the given path.
+// LoadQueries loads queries from the given path, which can be a directory, a SQL file or a structured workload file.
 func LoadQueries(schemaName, queryPath string) (Set[Query], error) {
 	queries := NewSet[Query]()
+	if exist, isDir := FileExists(queryPath); exist && !isDir && IsWorkloadFile(queryPath) {
+		return LoadWorkloadFile(schemaName, queryPath)
+	}
 	if exist, isDir := FileExists(queryPath); exist && isDir {
 		rawSQLs, names, err := ParseStmtsFromDir(queryPath)
 		if err != nil {
 			return nil, err
 		}
 		for i, rawSQL := range rawSQLs {
+			querySchema, text := parseQueryFile(schemaName, rawSQL)
 			queries.Add(Query{
 				Alias:      strings.Split(names[i], ".")[0], // q1.sql, 2a.sql, etc.
-				SchemaName: schemaName,                      // Notice: for simplification, assume all Queries are under the same schema here.
-				Text:       rawSQL,
+				SchemaName: querySchema,
+				Text:       text,
 				Frequency:  1,
 			})
 		}
 		Infof("load %d queries from dir %s", len(rawSQLs), queryPath)
 	} else if exist, isDir := FileExists(queryPath); exist || !isDir {
-		rawSQLs, err := ParseStmtsFromFile(queryPath)
+		stmts, err := ParseScriptFromFile(queryPath)
 		if err != nil {
 			return nil, err
 		}
-		for i, rawSQL := range rawSQLs {
-			stmtType := GetStmtType(rawSQL)
+		for i, stmt := range stmts {
+			stmtType, err := GetStmtType(stmt.Text)
+			if err != nil { // unsupported by the parser
+				Warningf("skip the statement at %v:%v: %v", queryPath, stmt.Line, err)
+				continue
+			}
 			if stmtType == StmtUseDB {
-				schemaName = GetDBNameFromUseDBStmt(rawSQL)
+				schemaName = GetDBNameFromUseDBStmt(stmt.Text)
 			}
 			if stmtType != StmtSelect {
 				continue
@@ -89,18 +102,45 @@ func LoadQueries(schemaName, queryPath string) (Set[Query], error) {
 
 			queries.Add(Query{
 				Alias:      fmt.Sprintf("q%v", i+1),
-				SchemaName: schemaName, // Notice: for simplification, assume all Queries are under the same schema here.
-				Text:       rawSQL,
+				SchemaName: schemaName, // the database of the last `USE` statement
+				Text:       stmt.Text,
 				Frequency:  1,
 			})
 		}
-		Infof("load %d queries from %s", len(rawSQLs), queryPath)
+		Infof("load %d queries from %s", queries.Size(), queryPath)
 	} else {
 		return nil, fmt.Errorf("can not find queries directory or queries.sql file under %s", queryPath)
 	}
 	return queries, nil
 }
 
+// queryFileSchemaHeader matches schema headers in query files like `-- schema: tpch`.
+var queryFileSchemaHeader = regexp.MustCompile("(?im)^[ \t]*(?:--|#)[ \t]*schema[ \t]*:[ \t]*`?([^`\\s;]+)`?")
+
+// parseQueryFile parses the content of a query file in query directories.
+// The schema of the query can be specified by a header comment like `-- schema: tpch` or `USE` statements in the file,
+// otherwise defaultSchemaName is used.
+func parseQueryFile(defaultSchemaName, content string) (schemaName, text string) {
+	schemaName, text = defaultSchemaName, content
+	if m := queryFileSchemaHeader.FindStringSubmatch(content); m != nil {
+		schemaName = m[1]
+	}
+	var stmts []string
+	hasUseStmt := false
+	for _, stmt := range SplitSQLScript(content) {
+		if stmtType, err := GetStmtType(stmt.Text); err == nil && stmtType == StmtUseDB {
+			schemaName = GetDBNameFromUseDBStmt(stmt.Text)
+			hasUseStmt = true
+			continue
+		}
+		stmts = append(stmts, stmt.Text)
+	}
+	if hasUseStmt { // keep the original content if possible
+		text = strings.Join(stmts, ";\n")
+	}
+	return schemaName, text
+}
+
 // ParseCreateTableStmt parses a create table statement and returns a TableSchema.
 func ParseCreateTableStmt(schemaName, createTableStmt string) (TableSchema, error) {
 	stmt, err := ParseOneSQL(createTableStmt)
@@ -121,17 +161,161 @@ func ParseCreateTableStmt(schemaName, createTableStmt string) (TableSchema, erro
 			ColumnType: colDef.Tp.Clone(),
 		})
 	}
-	// TODO: parse indexes
+	t.Indexes, err = parseTableIndexes(t, createTable)
+	if err != nil {
+		return TableSchema{}, err
+	}
 	return t, nil
 }
 
+// parseTableIndexes parses all index definitions (PRIMARY KEY, UNIQUE KEY and KEY) in the create table statement.
+func parseTableIndexes(t TableSchema, createTable *ast.CreateTableStmt) ([]Index, error) {
+	var indexes []Index
+	usedNames := make(map[string]bool)
+	addIndex := func(idx Index) {
+		if idx.IndexName == "" { // unnamed indexes are named after their first column like MySQL, e.g. `a`, `a_2`
+			name := idx.Columns[0].ColumnName
+			for i := 2; usedNames[name]; i++ {
+				name = fmt.Sprintf("%v_%v", idx.Columns[0].ColumnName, i)
+			}
+			idx.IndexName = name
+		}
+		usedNames[idx.IndexName] = true
+		indexes = append(indexes, idx)
+	}
+
+	for _, colDef := range createTable.Cols { // column-level definitions, e.g. `a int primary key`
+		for _, opt := range colDef.Options {
+			idx := Index{
+				SchemaName: t.SchemaName,
+				TableName:  t.TableName,
+				Columns:    []Column{NewColumn(t.SchemaName, t.TableName, colDef.Name.Name.L)},
+			}
+			switch opt.Tp {
+			case ast.ColumnOptionPrimaryKey:
+				idx.IndexName, idx.Primary, idx.Unique = "primary", true, true
+				idx.Clustered = isClusteredPrimaryKey(t, opt.PrimaryKeyTp, idx.Columns)
+			case ast.ColumnOptionUniqKey:
+				idx.Unique = true
+			default:
+				continue
+			}
+			addIndex(idx)
+		}
+	}
+
+	for _, cons := range createTable.Constraints {
+		idx := Index{
+			SchemaName: t.SchemaName,
+			TableName:  t.TableName,
+			IndexName:  strings.ToLower(cons.Name),
+		}
+		switch cons.Tp {
+		case ast.ConstraintPrimaryKey:
+			idx.IndexName, idx.Primary, idx.Unique = "primary", true, true
+		case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+			idx.Unique = true
+		case ast.ConstraintKey, ast.ConstraintIndex:
+		default: // foreign keys, full-text indexes and checks are not considered
+			continue
+		}
+		cols, err := parseIndexParts(t.SchemaName, t.TableName, cons.Keys)
+		if err != nil {
+			return nil, err
+		}
+		idx.Columns = cols
+		if cons.Option != nil {
+			idx.Invisible = cons.Option.Visibility == ast.IndexVisibilityInvisible
+			if idx.Primary {
+				idx.Clustered = isClusteredPrimaryKey(t, cons.Option.PrimaryKeyTp, cols)
+			}
+		} else if idx.Primary {
+			idx.Clustered = isClusteredPrimaryKey(t, model.PrimaryKeyTypeDefault, cols)
+		}
+		addIndex(idx)
+	}
+	return indexes, nil
+}
+
+// isClusteredPrimaryKey returns whether this primary key is clustered.
+// If it's not specified explicitly, only a single integer column primary key is considered clustered, which
+// is the behavior of TiDB under both `tidb_enable_clustered_index=INT_ONLY` and `ON` for integer keys.
+func isClusteredPrimaryKey(t TableSchema, tp model.PrimaryKeyType, cols []Column) bool {
+	switch tp {
+	case model.PrimaryKeyTypeClustered:
+		return true
+	case model.PrimaryKeyTypeNonClustered:
+		return false
+	}
+	if len(cols) != 1 || cols[0].IsExpression() || cols[0].Length > 0 {
+		return false
+	}
+	for _, col := range t.Columns {
+		if col.ColumnName == cols[0].ColumnName {
+			return col.ColumnType != nil && mysql.IsIntegerType(col.ColumnType.Tp)
+		}
+	}
+	return false
+}
+
+// parseIndexParts parses index parts like `a`, `b(10)` or `(lower(c))` into columns.
+func parseIndexParts(schemaName, tableName string, parts []*ast.IndexPartSpecification) ([]Column, error) {
+	var cols []Column
+	for _, part := range parts {
+		if part.Expr == nil {
+			col := NewColumn(schemaName, tableName, part.Column.Name.L)
+			col.Length = part.Length
+			cols = append(cols, col)
+			continue
+		}
+		col, err := parseExpressionIndexPart(schemaName, tableName, part.Expr)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// parseExpressionIndexPart parses an expression index part like `(lower(c))`, the expression is kept as it is.
+func parseExpressionIndexPart(schemaName, tableName string, expr ast.ExprNode) (Column, error) {
+	text, err := RestoreIndexExpr(expr)
+	if err != nil {
+		return Column{}, err
+	}
+	// use the first referenced column as the column name of this part
+	c := &blockColumnCollector{}
+	expr.Accept(c)
+	if len(c.names) == 0 {
+		return Column{}, fmt.Errorf("no column in index expression %v", text)
+	}
+	col := NewColumn(schemaName, tableName, c.names[0].Name.L)
+	col.Expr = text
+	return col, nil
+}
+
+// RestoreIndexExpr restores the expression of an expression index part, expressions in queries are restored in the
+// same way to compare them with index parts.
+func RestoreIndexExpr(expr ast.ExprNode) (string, error) {
+	var sb strings.Builder
+	ctx := format.NewRestoreCtx(format.RestoreStringSingleQuotes|format.RestoreKeyWordLowercase|format.RestoreNameBackQuotes|
+		format.RestoreStringWithoutCharset, &sb)
+	if err := expr.Restore(ctx); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
 // ParseCreateIndexStmt parses a create index statement and returns an Index.
 func ParseCreateIndexStmt(createIndexStmt string) (Index, error) {
 	stmt, err := ParseOneSQL(createIndexStmt)
 	if err != nil {
 		return Index{}, err
 	}
-	createIndex := stmt.(*ast.CreateIndexStmt)
+	createIndex, ok := stmt.(*ast.CreateIndexStmt)
+	if !ok {
+		return Index{}, fmt.Errorf("not a create index statement: %v", createIndexStmt)
+	}
 	schemaName, tableName := createIndex.Table.Schema.O, createIndex.Table.Name.O
 	if schemaName == "" {
 		return Index{}, fmt.Errorf("schema name is empty")
@@ -141,12 +325,25 @@ func ParseCreateIndexStmt(createIndexStmt string) (Index, error) {
 		TableName:  tableName,
 		IndexName:  createIndex.IndexName,
 	}
-	for _, col := range createIndex.IndexPartSpecifications {
-		index.Columns = append(index.Columns, Column{
-			SchemaName: schemaName,
-			TableName:  tableName,
-			ColumnName: col.Column.Name.O,
-		})
+	for _, part := range createIndex.IndexPartSpecifications {
+		if part.Expr == nil {
+			index.Columns = append(index.Columns, Column{
+				SchemaName: schemaName,
+				TableName:  tableName,
+				ColumnName: part.Column.Name.O,
+				Length:     part.Length,
+			})
+			continue
+		}
+		col, err := parseExpressionIndexPart(schemaName, tableName, part.Expr)
+		if err != nil {
+			return Index{}, err
+		}
+		index.Columns = append(index.Columns, col)
+	}
+	index.Unique = createIndex.KeyType == ast.IndexKeyTypeUnique
+	if createIndex.IndexOption != nil {
+		index.Invisible = createIndex.IndexOption.Visibility == ast.IndexVisibilityInvisible
 	}
 	return index, nil
 }